@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/genterm/backend/internal/wire"
+)
+
+// maxEventBytes bounds a single Server-Sent Event of a chat stream
+const maxEventBytes = 16 << 20
+
+// imageExtensions are the files uploaded as images rather than documents
+var imageExtensions = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+}
+
+// client talks to the GenTerm server
+type client struct {
+	baseURL string
+	apiKey  string
+	http    *http.Client
+}
+
+// upload is a file stored on the server
+type upload struct {
+	ID    string
+	Name  string
+	Image bool
+}
+
+// newClient creates a client for the server at baseURL
+func newClient(baseURL, apiKey string) *client {
+	return &client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		http:    &http.Client{},
+	}
+}
+
+// session sends a session action
+func (c *client) session(ctx context.Context, req wire.SessionRequest) (*wire.SessionResponse, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.send(ctx, http.MethodPost, "/api/session", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result wire.SessionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid session response: %w", err)
+	}
+	return &result, nil
+}
+
+// upload stores a file in a session: images with /api/images, everything
+// else with /api/documents, where the server extracts the text
+func (c *client) upload(ctx context.Context, sessionID, path string) (*upload, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	name := filepath.Base(path)
+	mimeType, image := imageExtensions[strings.ToLower(filepath.Ext(name))]
+	endpoint := "/api/documents"
+	if image {
+		endpoint = "/api/images"
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("sessionId", sessionID)
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename=%q`, name))
+	if mimeType != "" {
+		header.Set("Content-Type", mimeType)
+	} else {
+		header.Set("Content-Type", "application/octet-stream")
+	}
+	part, err := form.CreatePart(header)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		return nil, err
+	}
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.send(ctx, http.MethodPost, endpoint, form.FormDataContentType(), &body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	defer resp.Body.Close()
+
+	if image {
+		var result wire.ImageResponse
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || result.Image == nil {
+			return nil, fmt.Errorf("%s: invalid upload response", name)
+		}
+		return &upload{ID: result.Image.ID, Name: name, Image: true}, nil
+	}
+
+	var result wire.DocumentResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || result.Document == nil {
+		return nil, fmt.Errorf("%s: invalid upload response", name)
+	}
+	return &upload{ID: result.Document.ID, Name: name}, nil
+}
+
+// chat sends a chat turn and streams the answer to out. onTool is called
+// for every tool the model runs. The final response holds the whole answer
+// and its sources.
+func (c *client) chat(ctx context.Context, req wire.ChatRequest, out io.Writer, onTool func(wire.ToolEvent)) (*wire.ChatResponse, error) {
+	req.Stream = true
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.send(ctx, http.MethodPost, "/api/chat", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), maxEventBytes)
+	event := ""
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			event = ""
+			continue
+		}
+		if name, found := strings.CutPrefix(line, "event: "); found {
+			event = name
+			continue
+		}
+		data, found := strings.CutPrefix(line, "data: ")
+		if !found {
+			continue
+		}
+
+		switch event {
+		case "":
+			var delta wire.StreamDelta
+			if err := json.Unmarshal([]byte(data), &delta); err != nil {
+				return nil, fmt.Errorf("invalid stream event: %w", err)
+			}
+			if _, err := io.WriteString(out, delta.Delta); err != nil {
+				return nil, err
+			}
+		case "tool":
+			var tool wire.ToolEvent
+			if err := json.Unmarshal([]byte(data), &tool); err == nil && onTool != nil {
+				onTool(tool)
+			}
+		case "error":
+			var failure wire.ErrorResponse
+			if err := json.Unmarshal([]byte(data), &failure); err != nil {
+				return nil, fmt.Errorf("invalid stream event: %w", err)
+			}
+			return nil, errors.New(failure.Error)
+		case "done":
+			var result wire.ChatResponse
+			if err := json.Unmarshal([]byte(data), &result); err != nil {
+				return nil, fmt.Errorf("invalid stream event: %w", err)
+			}
+			return &result, nil
+		}
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, errors.New("the stream ended without an answer")
+}
+
+// send makes an authenticated request. Responses with an error status are
+// turned into an error carrying the message of the server.
+func (c *client) send(ctx context.Context, method, path, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	// Most endpoints answer errors with JSON, some with plain text
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	var failure struct {
+		Error string `json:"error"`
+	}
+	message := strings.TrimSpace(string(data))
+	if json.Unmarshal(data, &failure) == nil && failure.Error != "" {
+		message = failure.Error
+	}
+	if message == "" {
+		message = resp.Status
+	}
+	return nil, fmt.Errorf("%s (%d)", message, resp.StatusCode)
+}
@@ -0,0 +1,254 @@
+// Command genterm is a command-line client for the GenTerm server. Without a
+// command it starts an interactive session; "ask" answers a single question.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/genterm/backend/internal/llm"
+	"github.com/genterm/backend/internal/session"
+	"github.com/genterm/backend/internal/wire"
+)
+
+// defaultServer is used when neither -server nor GENTERM_SERVER is set
+const defaultServer = "http://localhost:8080"
+
+const usage = `Usage:
+  genterm [flags]                        start an interactive session
+  genterm ask [flags] [-f file]... text  ask a single question
+  genterm sessions [flags]               list your sessions
+  genterm history [flags] <session-id>   print the messages of a session
+
+Input piped into "ask" is sent as context, for example:
+  git diff | genterm ask "write a commit message"
+
+Flags may come before or after the command:
+`
+
+// options are the flags shared by every command
+type options struct {
+	server  string
+	apiKey  string
+	session string
+	persona string
+	model   string
+	files   fileList
+}
+
+// fileList collects the files of repeated -f flags
+type fileList []string
+
+// String returns the files as a comma-separated list
+func (f *fileList) String() string {
+	return strings.Join(*f, ",")
+}
+
+// Set adds a file
+func (f *fileList) Set(path string) error {
+	*f = append(*f, path)
+	return nil
+}
+
+func main() {
+	opts := options{}
+	flags := flag.NewFlagSet("genterm", flag.ExitOnError)
+	flags.StringVar(&opts.server, "server", envOr("GENTERM_SERVER", defaultServer), "server URL (GENTERM_SERVER)")
+	flags.StringVar(&opts.apiKey, "key", os.Getenv("GENTERM_API_KEY"), "API key (GENTERM_API_KEY)")
+	flags.StringVar(&opts.session, "s", "", "ID of a session to resume instead of starting a new one")
+	flags.StringVar(&opts.persona, "persona", "", "persona of a new session")
+	flags.StringVar(&opts.model, "model", "", "model to answer with")
+	flags.Var(&opts.files, "f", "file to upload before asking; may be repeated")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flags.PrintDefaults()
+	}
+	// Flags may come before and after the command
+	flags.Parse(os.Args[1:])
+	command := flags.Arg(0)
+	if command != "" {
+		flags.Parse(flags.Args()[1:])
+	}
+
+	c := newClient(opts.server, opts.apiKey)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var err error
+	switch command {
+	case "":
+		stop()
+		err = runREPL(c, opts)
+	case "ask":
+		err = runAsk(ctx, c, opts, strings.Join(flags.Args(), " "))
+	case "sessions":
+		if flags.NArg() != 0 {
+			flags.Usage()
+			os.Exit(2)
+		}
+		err = runSessions(ctx, c)
+	case "history":
+		if flags.NArg() != 1 {
+			flags.Usage()
+			os.Exit(2)
+		}
+		err = runHistory(ctx, c, flags.Arg(0))
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", command)
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+// runAsk answers one question, with the files of -f uploaded first and
+// piped input sent as context. The session ID is printed to stderr, so the
+// conversation can be resumed.
+func runAsk(ctx context.Context, c *client, opts options, question string) error {
+	if strings.TrimSpace(question) == "" {
+		return errors.New("no question given")
+	}
+
+	var inputContext []string
+	if piped() {
+		input, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("reading stdin: %w", err)
+		}
+		if text := strings.TrimSpace(string(input)); text != "" {
+			inputContext = append(inputContext, "[File: stdin]\n"+text)
+		}
+	}
+
+	sessionID, err := openSession(ctx, c, opts)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "Session:", sessionID)
+
+	var imageIDs []string
+	for _, path := range opts.files {
+		uploaded, err := c.upload(ctx, sessionID, path)
+		if err != nil {
+			return err
+		}
+		if uploaded.Image {
+			imageIDs = append(imageIDs, uploaded.ID)
+		}
+	}
+
+	resp, err := c.chat(ctx, wire.ChatRequest{
+		SessionID: sessionID,
+		Query:     question,
+		Context:   inputContext,
+		ImageIDs:  imageIDs,
+		Params:    llm.Params{Model: opts.model},
+	}, os.Stdout, printTool)
+	if err != nil {
+		return err
+	}
+	fmt.Println()
+	printSources(os.Stdout, resp.Sources)
+	return nil
+}
+
+// runSessions lists the sessions of the user
+func runSessions(ctx context.Context, c *client) error {
+	resp, err := c.session(ctx, wire.SessionRequest{Action: "list"})
+	if err != nil {
+		return err
+	}
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "ID\tTITLE\tMESSAGES\tUPDATED")
+	for _, s := range resp.Sessions {
+		fmt.Fprintf(table, "%s\t%s\t%d\t%s\n", s.ID, s.Title, s.MessageCount, s.UpdatedAt.Local().Format("2006-01-02 15:04"))
+	}
+	return table.Flush()
+}
+
+// runHistory prints the messages of a session
+func runHistory(ctx context.Context, c *client, sessionID string) error {
+	resp, err := c.session(ctx, wire.SessionRequest{Action: "get", ID: sessionID})
+	if err != nil {
+		return err
+	}
+	printMessages(os.Stdout, resp.Messages)
+	return nil
+}
+
+// openSession resumes the session of -s, or creates one with the persona
+// of -persona
+func openSession(ctx context.Context, c *client, opts options) (string, error) {
+	if opts.session != "" {
+		if _, err := c.session(ctx, wire.SessionRequest{Action: "get", ID: opts.session}); err != nil {
+			return "", err
+		}
+		return opts.session, nil
+	}
+
+	resp, err := c.session(ctx, wire.SessionRequest{Action: "create", Persona: opts.persona})
+	if err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+// printMessages prints a conversation. Tool calls and results are left out.
+func printMessages(w io.Writer, messages []session.Message) {
+	for _, msg := range messages {
+		switch msg.Role {
+		case "user":
+			fmt.Fprintf(w, "> %s\n", msg.Content)
+			for _, part := range msg.Parts {
+				if part.Type == session.PartImage || part.Type == session.PartDocument {
+					fmt.Fprintf(w, "  [%s attached]\n", part.Type)
+				}
+			}
+		case "assistant":
+			if msg.Content == "" {
+				continue
+			}
+			fmt.Fprintf(w, "%s\n", msg.Content)
+			printSources(w, msg.Sources)
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+// printSources prints the cited document parts of an answer as footnotes
+func printSources(w io.Writer, sources []session.Source) {
+	for _, source := range sources {
+		fmt.Fprintf(w, "  [%d] %s: %s\n", source.Number, source.DocumentName, source.Snippet)
+	}
+}
+
+// printTool announces a tool call of the model on stderr
+func printTool(tool wire.ToolEvent) {
+	fmt.Fprintf(os.Stderr, "[Using tool: %s]\n", tool.Name)
+}
+
+// piped reports whether stdin is a pipe or a file rather than a terminal
+func piped() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice == 0
+}
+
+// envOr returns an environment variable, or fallback when it is not set
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
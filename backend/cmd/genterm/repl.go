@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/genterm/backend/internal/llm"
+	"github.com/genterm/backend/internal/wire"
+)
+
+const replHelp = `Commands:
+  /help             show this help
+  /upload <file>    upload a document or image to the session
+  /history          print the messages of the session
+  /sessions         list your sessions
+  /resume <id>      continue another session
+  /new [persona]    start a new session
+  /clear            delete the messages of the session
+  /quit             leave (or press Ctrl-D)
+Anything else is sent as a question; Ctrl-C stops an answer.
+`
+
+// repl is an interactive session
+type repl struct {
+	client    *client
+	opts      options
+	sessionID string
+
+	// images are uploaded images not yet sent with a question
+	images []string
+}
+
+// runREPL reads questions and commands from stdin until it ends
+func runREPL(c *client, opts options) error {
+	r := &repl{client: c, opts: opts}
+	ctx := context.Background()
+
+	sessionID, err := openSession(ctx, c, opts)
+	if err != nil {
+		return err
+	}
+	r.sessionID = sessionID
+	if opts.session != "" {
+		if err := runHistory(ctx, c, sessionID); err != nil {
+			return err
+		}
+	}
+	for _, path := range opts.files {
+		r.upload(ctx, path)
+	}
+	fmt.Printf("Session %s. Type /help for commands.\n", sessionID)
+
+	input := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Print("> ")
+		line, err := input.ReadString('\n')
+		if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+			fmt.Println()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+			continue
+		case line == "/quit" || line == "/exit":
+			return nil
+		case strings.HasPrefix(line, "/"):
+			r.command(ctx, line)
+		default:
+			r.ask(line)
+		}
+	}
+}
+
+// command runs a slash command
+func (r *repl) command(ctx context.Context, line string) {
+	name, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+
+	var err error
+	switch name {
+	case "/help":
+		fmt.Print(replHelp)
+	case "/upload":
+		if arg == "" {
+			err = errors.New("usage: /upload <file>")
+			break
+		}
+		r.upload(ctx, arg)
+	case "/history":
+		err = runHistory(ctx, r.client, r.sessionID)
+	case "/sessions":
+		err = runSessions(ctx, r.client)
+	case "/resume":
+		if arg == "" {
+			err = errors.New("usage: /resume <id>")
+			break
+		}
+		if err = runHistory(ctx, r.client, arg); err == nil {
+			r.switchTo(arg)
+		}
+	case "/new":
+		var resp *wire.SessionResponse
+		resp, err = r.client.session(ctx, wire.SessionRequest{Action: "create", Persona: arg})
+		if err == nil {
+			r.switchTo(resp.ID)
+		}
+	case "/clear":
+		_, err = r.client.session(ctx, wire.SessionRequest{Action: "clear", ID: r.sessionID})
+		if err == nil {
+			fmt.Println("Session cleared.")
+		}
+	default:
+		err = fmt.Errorf("unknown command %s, type /help for the list", name)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+	}
+}
+
+// ask sends a question and streams the answer. Ctrl-C cancels the answer
+// but not the session.
+func (r *repl) ask(question string) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	resp, err := r.client.chat(ctx, wire.ChatRequest{
+		SessionID: r.sessionID,
+		Query:     question,
+		ImageIDs:  r.images,
+		Params:    llm.Params{Model: r.opts.model},
+	}, os.Stdout, printTool)
+	fmt.Println()
+	if err != nil {
+		if ctx.Err() != nil {
+			fmt.Fprintln(os.Stderr, "Cancelled.")
+			return
+		}
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return
+	}
+
+	r.images = nil
+	printSources(os.Stdout, resp.Sources)
+}
+
+// upload stores a file in the session. Images are sent with the next
+// question; documents are searched by every question.
+func (r *repl) upload(ctx context.Context, path string) {
+	uploaded, err := r.client.upload(ctx, r.sessionID, path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return
+	}
+
+	if uploaded.Image {
+		r.images = append(r.images, uploaded.ID)
+		fmt.Printf("Uploaded image %s; it is sent with your next question.\n", uploaded.Name)
+		return
+	}
+	fmt.Printf("Uploaded %s.\n", uploaded.Name)
+}
+
+// switchTo continues another session
+func (r *repl) switchTo(sessionID string) {
+	r.sessionID = sessionID
+	r.images = nil
+	fmt.Printf("Session %s.\n", sessionID)
+}
@@ -9,16 +9,23 @@ import (
 	"strings"
 
 	"github.com/genterm/backend/internal/api"
+	"github.com/genterm/backend/internal/auth"
 	"github.com/genterm/backend/internal/config"
+	"github.com/genterm/backend/internal/document"
+	"github.com/genterm/backend/internal/media"
+	"github.com/genterm/backend/internal/prompt"
+	"github.com/genterm/backend/internal/quota"
+	"github.com/genterm/backend/internal/rag"
 	"github.com/genterm/backend/internal/session"
 	"github.com/joho/godotenv"
 )
 
 // These variables will be set during build via ldflags
 var (
-	LlmApiKey  string
-	LlmModel   string
-	LlmBaseUrl string
+	LlmProvider string
+	LlmApiKey   string
+	LlmModel    string
+	LlmBaseUrl  string
 )
 
 func main() {
@@ -28,6 +35,10 @@ func main() {
 	}
 
 	// Set environment variables from build-time values if not already set
+	if os.Getenv("LLM_PROVIDER") == "" && LlmProvider != "" {
+		os.Setenv("LLM_PROVIDER", LlmProvider)
+	}
+
 	if os.Getenv("LLM_API_KEY") == "" && LlmApiKey != "" {
 		os.Setenv("LLM_API_KEY", LlmApiKey)
 	}
@@ -46,11 +57,67 @@ func main() {
 		log.Fatalf("Failed to initialize configuration: %v", err)
 	}
 
-	// Initialize session manager
-	sessionManager := session.NewManager()
+	// Initialize session storage and manager
+	sessionStore, err := session.OpenStore(cfg.SessionStore, cfg.SessionDir)
+	if err != nil {
+		log.Fatalf("Failed to open session store: %v", err)
+	}
+
+	sessionManager, err := session.NewManager(sessionStore, session.Limits{
+		TTL:          cfg.SessionTTL,
+		MaxSessions:  cfg.MaxSessions,
+		MaxMessages:  cfg.MaxSessionMessages,
+		MaxBytes:     cfg.MaxSessionBytes,
+		MaxDocuments: cfg.MaxSessionDocuments,
+	})
+	if err != nil {
+		log.Fatalf("Failed to load sessions: %v", err)
+	}
+
+	// Expire idle sessions in the background
+	stopJanitor := sessionManager.StartJanitor(cfg.SessionJanitorInterval)
+	defer stopJanitor()
+
+	// Documents, their index entries and images are kept next to
+	// file-backed sessions, so the files of a session survive restarts with it
+	documentStore := document.NewStore()
+	index := rag.NewIndex()
+	imageStore := media.NewStore()
+	if cfg.SessionStore == session.StoreFile {
+		documentStore, err = document.OpenStore(filepath.Join(cfg.SessionDir, "documents"))
+		if err != nil {
+			log.Fatalf("Failed to load documents: %v", err)
+		}
+		index, err = rag.OpenIndex(filepath.Join(cfg.SessionDir, "index"))
+		if err != nil {
+			log.Fatalf("Failed to load document index: %v", err)
+		}
+		imageStore, err = media.OpenStore(filepath.Join(cfg.SessionDir, "images"))
+		if err != nil {
+			log.Fatalf("Failed to load images: %v", err)
+		}
+	}
+
+	// Load the system prompt of every persona
+	prompts, err := prompt.LoadRegistry(cfg.PromptDir)
+	if err != nil {
+		log.Fatalf("Failed to load prompts: %v", err)
+	}
+	log.Printf("Loaded personas: %s", strings.Join(prompts.Names(), ", "))
 
 	// Initialize API handlers
-	apiHandler := api.NewHandler(cfg, sessionManager)
+	apiHandler := api.NewHandler(cfg, sessionManager, documentStore, index, imageStore, prompts)
+
+	// Load API keys when authentication is enabled
+	var verifier *auth.Verifier
+	if cfg.AuthKeyFile != "" {
+		verifier, err = auth.LoadVerifier(cfg.AuthKeyFile)
+		if err != nil {
+			log.Fatalf("Failed to load auth key file: %v", err)
+		}
+	} else {
+		log.Println("Warning: AUTH_KEY_FILE not set, API is unauthenticated")
+	}
 
 	// Register common MIME types
 	mime.AddExtensionType(".js", "application/javascript")
@@ -63,9 +130,30 @@ func main() {
 	mime.AddExtensionType(".svg", "image/svg+xml")
 	mime.AddExtensionType(".ico", "image/x-icon")
 
-	// Set up API routes with CORS middleware
-	http.HandleFunc("/api/chat", api.EnableCors(apiHandler.HandleChat))
-	http.HandleFunc("/api/session", api.EnableCors(apiHandler.HandleSession))
+	// Every client shares the same request rate limit across all routes
+	limiter := quota.NewLimiter(cfg.RateLimitPerMinute, cfg.RateLimitBurst)
+	authorize := func(handler http.HandlerFunc) http.HandlerFunc {
+		return api.RequireAuth(verifier, api.RateLimit(limiter, handler))
+	}
+	protect := func(handler http.HandlerFunc) http.HandlerFunc {
+		return api.EnableCors(authorize(handler))
+	}
+
+	// Set up API routes with CORS, auth and rate limiting middleware
+	http.HandleFunc("/api/chat", protect(apiHandler.HandleChat))
+	http.HandleFunc("/api/chat/cancel", protect(apiHandler.HandleCancel))
+	http.HandleFunc("/api/session", protect(apiHandler.HandleSession))
+	http.HandleFunc("/api/documents", protect(apiHandler.HandleDocuments))
+	http.HandleFunc("/api/images", protect(apiHandler.HandleImages))
+	http.HandleFunc("/api/usage", protect(apiHandler.HandleUsage))
+	http.HandleFunc("/api/models", protect(apiHandler.HandleModels))
+
+	// The versioned REST API routes by method and path itself
+	http.HandleFunc(api.V1Prefix, api.EnableCors(apiHandler.V1(authorize).ServeHTTP))
+
+	// OpenAI-compatible endpoints for existing OpenAI clients
+	http.HandleFunc("/v1/chat/completions", protect(apiHandler.HandleChatCompletions))
+	http.HandleFunc("/v1/models", protect(apiHandler.HandleCompletionModels))
 
 	// Create a file server for static files
 	staticDir := "/app/frontend/build"
@@ -137,6 +225,7 @@ func main() {
 
 	// Start the server
 	log.Printf("Starting server on :%s", port)
+	log.Printf("PROVIDER: %s", cfg.LLMProvider)
 	log.Printf("MODEL: %s", model)
 	err = http.ListenAndServe(":"+port, nil)
 	if err != nil {
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// inflightRequests tracks the running chat request of each session so it
+// can be cancelled from a separate request
+type inflightRequests struct {
+	requests map[string]*inflightRequest
+	mutex    sync.Mutex
+}
+
+// inflightRequest is one registered request. Its address identifies the
+// registration, so a finished request never removes a newer one.
+type inflightRequest struct {
+	cancel context.CancelFunc
+}
+
+// newInflightRequests creates an empty registry
+func newInflightRequests() *inflightRequests {
+	return &inflightRequests{
+		requests: make(map[string]*inflightRequest),
+	}
+}
+
+// start registers a request for a session and returns its context and a
+// function to call when the request finishes. It fails if the session
+// already has a request in flight.
+func (f *inflightRequests) start(parent context.Context, sessionID string) (context.Context, func(), bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if _, busy := f.requests[sessionID]; busy {
+		return nil, nil, false
+	}
+
+	ctx, cancel := context.WithCancel(parent)
+	request := &inflightRequest{cancel: cancel}
+	f.requests[sessionID] = request
+
+	done := func() {
+		f.mutex.Lock()
+		// A cancelled request is already unregistered and the session may
+		// have a new request by now
+		if f.requests[sessionID] == request {
+			delete(f.requests, sessionID)
+		}
+		f.mutex.Unlock()
+		cancel()
+	}
+
+	return ctx, done, true
+}
+
+// cancel aborts the request in flight for a session
+func (f *inflightRequests) cancel(sessionID string) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	request, exists := f.requests[sessionID]
+	if !exists {
+		return false
+	}
+
+	request.cancel()
+	delete(f.requests, sessionID)
+	return true
+}
+
+// HandleCancel aborts the chat request currently running for a session
+func (h *Handler) HandleCancel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+		return
+	}
+
+	var req CancelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid request")
+		return
+	}
+
+	if _, exists := h.ownedSession(r.Context(), req.SessionID); !exists || !h.inflight.cancel(req.SessionID) {
+		writeError(w, http.StatusNotFound, "no_request_in_progress", "No request in progress for this session")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CancelResponse{
+		SessionID: req.SessionID,
+		Cancelled: true,
+	})
+}
@@ -0,0 +1,193 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/genterm/backend/internal/document"
+	"github.com/genterm/backend/internal/extract"
+	"github.com/genterm/backend/internal/llm"
+	"github.com/genterm/backend/internal/session"
+)
+
+// HandleDocuments handles uploading, listing and deleting session documents
+func (h *Handler) HandleDocuments(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		h.uploadDocument(w, r)
+	case http.MethodGet:
+		h.listDocuments(w, r)
+	case http.MethodDelete:
+		h.deleteDocument(w, r)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+	}
+}
+
+// uploadDocument stores a document sent either as multipart form data or JSON
+func (h *Handler) uploadDocument(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, h.config.MaxUploadBytes)
+
+	var req DocumentUploadRequest
+	var size int64
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		if err := r.ParseMultipartForm(h.config.MaxUploadBytes); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_request", "Invalid upload: "+err.Error())
+			return
+		}
+
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_request", "Missing file")
+			return
+		}
+		defer file.Close()
+
+		req.SessionID = r.FormValue("sessionId")
+		req.Name = filepath.Base(header.Filename)
+		req.MimeType = header.Header.Get("Content-Type")
+		req.Content = r.FormValue("content")
+		size = header.Size
+
+		// Without pre-extracted content the text is extracted from the file
+		if req.Content == "" {
+			data, err := io.ReadAll(file)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "invalid_request", "Error reading file")
+				return
+			}
+			req.Data = data
+		}
+	} else {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				writeError(w, http.StatusRequestEntityTooLarge, "too_large", "Document too large")
+				return
+			}
+			writeError(w, http.StatusBadRequest, "invalid_request", "Invalid request")
+			return
+		}
+		size = int64(len(req.Content))
+		if req.Content == "" {
+			size = int64(len(req.Data))
+		}
+	}
+
+	if req.Name == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Missing document name")
+		return
+	}
+
+	if _, exists := h.ownedSession(r.Context(), req.SessionID); !exists {
+		writeError(w, http.StatusBadRequest, "invalid_session", "Invalid session")
+		return
+	}
+
+	// Indexing embeds the document, which counts towards the token quota
+	client := clientKey(r)
+	if status, err := h.quotas.Check(client); err != nil {
+		writeQuotaExceeded(w, status)
+		return
+	}
+
+	// Browsers and curl label unknown files as generic binary data
+	if req.MimeType == "" || req.MimeType == "application/octet-stream" {
+		if byExtension := mime.TypeByExtension(filepath.Ext(req.Name)); byExtension != "" {
+			req.MimeType = byExtension
+		}
+	}
+
+	if req.Content == "" && len(req.Data) > 0 {
+		content, err := h.extractors.Extract(req.Name, req.MimeType, req.Data)
+		if errors.Is(err, extract.ErrUnsupported) {
+			writeError(w, http.StatusUnsupportedMediaType, "unsupported_type", "Unsupported file type: "+req.Name)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to extract %s: %v", req.Name, err)
+			writeError(w, http.StatusUnprocessableEntity, "unreadable_document", "Could not read "+err.Error())
+			return
+		}
+		// Scanned documents have no text layer to extract
+		if strings.TrimSpace(content) == "" {
+			writeError(w, http.StatusUnprocessableEntity, "unreadable_document", "No text found in "+req.Name)
+			return
+		}
+		req.Content = content
+	}
+
+	doc := h.documents.Add(req.SessionID, req.Name, req.MimeType, req.Content, size)
+	if err := h.sessionManager.AddDocument(req.SessionID, doc.ID); err != nil {
+		h.documents.Delete(doc.ID)
+		if errors.Is(err, session.ErrTooManyDocuments) {
+			writeError(w, http.StatusConflict, "too_many_documents", fmt.Sprintf("Session has reached its limit of %d documents", h.config.MaxSessionDocuments))
+			return
+		}
+		writeError(w, http.StatusBadRequest, "invalid_session", "Invalid session")
+		return
+	}
+
+	// Documents that fail to index are still usable as whole-text context
+	tokens, err := h.retriever.IndexDocument(r.Context(), doc.ID, doc.Name, doc.Content)
+	if err != nil {
+		log.Printf("Failed to index document %s: %v", doc.ID, err)
+	}
+	if tokens > 0 {
+		usage := h.recordUsage(client, h.config.EmbeddingModel, llm.Usage{PromptTokens: tokens, TotalTokens: tokens})
+		h.sessionManager.AddUsage(req.SessionID, usage)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(DocumentResponse{
+		Document: doc,
+	})
+}
+
+// listDocuments returns the documents attached to a session
+func (h *Handler) listDocuments(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.URL.Query().Get("sessionId")
+	if _, exists := h.ownedSession(r.Context(), sessionID); !exists {
+		writeError(w, http.StatusNotFound, "session_not_found", "Session not found")
+		return
+	}
+
+	docs := h.documents.List(sessionID)
+	if docs == nil {
+		docs = []*document.Document{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(DocumentListResponse{
+		Documents: docs,
+	})
+}
+
+// deleteDocument removes a document from a session
+func (h *Handler) deleteDocument(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.URL.Query().Get("sessionId")
+	documentID := r.URL.Query().Get("id")
+
+	if _, exists := h.ownedSession(r.Context(), sessionID); !exists {
+		writeError(w, http.StatusNotFound, "document_not_found", "Document not found")
+		return
+	}
+	if !h.sessionManager.RemoveDocument(sessionID, documentID) {
+		writeError(w, http.StatusNotFound, "document_not_found", "Document not found")
+		return
+	}
+	h.documents.Delete(documentID)
+	h.retriever.RemoveDocument(documentID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
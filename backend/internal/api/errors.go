@@ -0,0 +1,102 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/genterm/backend/internal/llm"
+	"github.com/genterm/backend/internal/quota"
+)
+
+// StatusClientClosedRequest is the non-standard status used for requests
+// that were cancelled before an answer was produced
+const StatusClientClosedRequest = 499
+
+// writeError writes a structured JSON error
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Error: message,
+		Code:  code,
+	})
+}
+
+// writeQuotaExceeded writes the error for a client that used up its token quota
+func writeQuotaExceeded(w http.ResponseWriter, status quota.Status) {
+	resp := ErrorResponse{
+		Error: "Token quota exceeded",
+		Code:  "quota_exceeded",
+		Quota: &status,
+	}
+	if status.ResetAt != nil {
+		resp.RetryAfter = int(math.Ceil(time.Until(*status.ResetAt).Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(resp.RetryAfter))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// writeLLMError maps an error from the LLM client to an HTTP status and a
+// structured JSON error
+func writeLLMError(w http.ResponseWriter, err error) {
+	status, resp := llmErrorResponse(err)
+	if resp.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(resp.RetryAfter))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// llmErrorResponse returns the status code and body for an LLM error
+func llmErrorResponse(err error) (int, ErrorResponse) {
+	resp := ErrorResponse{
+		Error: "Error generating response: " + err.Error(),
+	}
+
+	var apiErr *llm.APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		resp.RetryAfter = int(math.Ceil(apiErr.RetryAfter.Seconds()))
+	}
+
+	switch {
+	case errors.Is(err, llm.ErrRateLimited):
+		resp.Code = "rate_limited"
+		return http.StatusTooManyRequests, resp
+	case errors.Is(err, llm.ErrContextLength):
+		resp.Code = "context_length_exceeded"
+		return http.StatusBadRequest, resp
+	case errors.Is(err, llm.ErrInvalidRequest):
+		resp.Code = "invalid_request"
+		return http.StatusBadRequest, resp
+	case errors.Is(err, llm.ErrAuth):
+		// The server's own upstream credentials were rejected
+		resp.Code = "upstream_auth_failed"
+		return http.StatusBadGateway, resp
+	case errors.Is(err, errInvalidOutput):
+		resp.Code = "invalid_output"
+		return http.StatusBadGateway, resp
+	case errors.Is(err, llm.ErrUpstreamDown):
+		resp.Code = "upstream_unavailable"
+		return http.StatusServiceUnavailable, resp
+	case errors.Is(err, context.Canceled):
+		resp.Error = "Request cancelled"
+		resp.Code = "request_cancelled"
+		return StatusClientClosedRequest, resp
+	case errors.Is(err, llm.ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		resp.Code = "upstream_timeout"
+		return http.StatusGatewayTimeout, resp
+	default:
+		resp.Code = "internal_error"
+		return http.StatusInternalServerError, resp
+	}
+}
@@ -1,11 +1,23 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/genterm/backend/internal/auth"
 	"github.com/genterm/backend/internal/config"
+	"github.com/genterm/backend/internal/document"
+	"github.com/genterm/backend/internal/extract"
 	"github.com/genterm/backend/internal/llm"
+	"github.com/genterm/backend/internal/media"
+	"github.com/genterm/backend/internal/prompt"
+	"github.com/genterm/backend/internal/quota"
+	"github.com/genterm/backend/internal/rag"
 	"github.com/genterm/backend/internal/session"
 )
 
@@ -13,174 +25,524 @@ import (
 type Handler struct {
 	config         *config.Config
 	sessionManager *session.Manager
+	documents      *document.Store
+	images         *media.Store
+	extractors     *extract.Registry
 	llmClient      *llm.Client
+	retriever      *rag.Retriever
+	prompts        *prompt.Registry
+	inflight       *inflightRequests
+	quotas         *quota.Tracker
+	usage          *usageLedger
 }
 
-// MessageContent represents the different types of content in a message
-type MessageContent struct {
-	Type     string   `json:"type"`
-	Text     string   `json:"text,omitempty"`
-	ImageURL ImageURL `json:"image_url,omitempty"`
-}
+// NewHandler creates a new API handler. Documents and their chunks are kept
+// in documents and index, and images in images.
+func NewHandler(cfg *config.Config, sessionMgr *session.Manager, documents *document.Store, index *rag.Index, images *media.Store, prompts *prompt.Registry) *Handler {
+	llmClient := llm.NewClient(cfg)
 
-// ImageURL represents an image URL object
-type ImageURL struct {
-	URL string `json:"url"`
-}
+	h := &Handler{
+		config:         cfg,
+		sessionManager: sessionMgr,
+		documents:      documents,
+		images:         images,
+		extractors:     extract.Default(),
+		llmClient:      llmClient,
+		retriever: rag.NewRetriever(llmClient, index, rag.Options{
+			ChunkSize:    cfg.ChunkSize,
+			ChunkOverlap: cfg.ChunkOverlap,
+			TopK:         cfg.RetrievalTopK,
+		}),
+		prompts:  prompts,
+		inflight: newInflightRequests(),
+		quotas:   quota.NewTracker(cfg.DailyTokenQuota, cfg.MonthlyTokenQuota),
+		usage:    newUsageLedger(),
+	}
 
-// ChatRequest is the structure for chat requests
-type ChatRequest struct {
-	SessionID      string           `json:"sessionId"`
-	Query          string           `json:"query"`
-	Context        []string         `json:"context"`
-	MessageContent []MessageContent `json:"messageContent,omitempty"`
-}
+	// Drop the documents and images of sessions that expire or get evicted
+	sessionMgr.OnRemove(h.removeSessionFiles)
+	h.pruneSessionFiles()
 
-// ChatResponse is the structure for chat responses
-type ChatResponse struct {
-	SessionID string `json:"sessionId"`
-	Response  string `json:"response"`
+	return h
 }
 
-// SessionRequest is the structure for session requests
-type SessionRequest struct {
-	Action string `json:"action"`
-	ID     string `json:"id,omitempty"`
-}
+// pruneSessionFiles removes stored documents, index entries and images
+// whose session is gone, and detaches missing documents from sessions.
+// Sessions and their files can disagree when the server stopped in the
+// middle of a change, or when sessions were saved before their files were.
+func (h *Handler) pruneSessionFiles() {
+	h.images.Prune(h.sessionManager.HasSession)
 
-// SessionResponse is the structure for session responses
-type SessionResponse struct {
-	ID       string            `json:"id"`
-	Messages []session.Message `json:"messages,omitempty"`
-	Error    string            `json:"error,omitempty"`
+	removed := h.documents.Prune(func(doc *document.Document) bool {
+		return h.sessionManager.HasDocument(doc.SessionID, doc.ID)
+	})
+	h.retriever.Prune(func(documentID string) bool {
+		_, exists := h.documents.Get(documentID)
+		return exists
+	})
+	detached := h.sessionManager.PruneDocuments(func(sessionID, documentID string) bool {
+		doc, exists := h.documents.Get(documentID)
+		return exists && doc.SessionID == sessionID
+	})
+
+	if len(removed) > 0 || detached > 0 {
+		log.Printf("Removed %d documents without a session and detached %d missing documents from sessions", len(removed), detached)
+	}
 }
 
-// NewHandler creates a new API handler
-func NewHandler(cfg *config.Config, sessionMgr *session.Manager) *Handler {
-	return &Handler{
-		config:         cfg,
-		sessionManager: sessionMgr,
-		llmClient:      llm.NewClient(cfg),
+// removeSessionFiles deletes every document of a session with its index
+// entries, and releases the session's images
+func (h *Handler) removeSessionFiles(s *session.Session) {
+	for _, doc := range h.documents.List(s.ID) {
+		h.retriever.RemoveDocument(doc.ID)
 	}
+	h.documents.DeleteSession(s.ID)
+	h.images.DeleteSession(s.ID)
 }
 
 // HandleChat handles chat requests
 func (h *Handler) HandleChat(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
 		return
 	}
 
 	var req ChatRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid request")
 		return
 	}
 
 	// Ensure we have a valid session
-	session, exists := h.sessionManager.GetSession(req.SessionID)
+	s, exists := h.ownedSession(r.Context(), req.SessionID)
 	if !exists {
-		http.Error(w, "Invalid session", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "invalid_session", "Invalid session")
 		return
 	}
 
-	// Generate system prompt
-	systemPrompt := "You are a helpful assistant. Use the provided context to answer questions accurately."
+	h.chat(w, r, s, req)
+}
 
-	// Convert session messages to LLM messages
-	var sessionMessages []llm.Message
-	for _, msg := range session.Messages {
-		sessionMessages = append(sessionMessages, llm.Message{
-			Role:    msg.Role,
-			Content: msg.Content,
-		})
+// chat answers one turn of a session and stores it. The answer is streamed
+// as Server-Sent Events when the request asks for it. s is a copy, so the
+// turn is stored through the session manager.
+func (h *Handler) chat(w http.ResponseWriter, r *http.Request, s *session.Session, req ChatRequest) {
+	// Per-request parameters override those of the session
+	params := s.Params.Merge(req.Params)
+	if err := h.validateParams(params); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_params", "Invalid parameters: "+err.Error())
+		return
+	}
+
+	// Clients over their token quota are rejected before any upstream call
+	client := clientKey(r)
+	if status, err := h.quotas.Check(client); err != nil {
+		writeQuotaExceeded(w, status)
+		return
 	}
 
-	var response string
-	var err error
+	// Register the turn so it can be cancelled; the context also ends when
+	// the client disconnects
+	ctx, done, ok := h.inflight.start(r.Context(), s.ID)
+	if !ok {
+		writeError(w, http.StatusConflict, "request_in_progress", "A request is already in progress for this session")
+		return
+	}
+	defer done()
 
-	// Check if request contains image data
-	if len(req.MessageContent) > 0 {
-		// Add user message with image to session
-		h.sessionManager.AddMessage(session.ID, "user", req.Query+" [with image]")
+	// The query falls back to the text of multimodal message content
+	query := req.Query
+	if query == "" {
+		query = messageText(req.MessageContent)
+	}
 
-		// Convert MessageContent to ContentItem
-		contentItems := make([]llm.ContentItem, len(req.MessageContent))
-		for i, content := range req.MessageContent {
-			contentItems[i] = llm.ContentItem{
-				Type: content.Type,
-				Text: content.Text,
-				ImageURL: llm.ImageURL{
-					URL: content.ImageURL.URL,
-				},
-			}
+	// Resolve stored documents into context
+	ragContext, sources, err := h.documentContext(ctx, s, req.DocumentIDs, query)
+	if ctx.Err() != nil {
+		writeLLMError(w, ctx.Err())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid request: "+err.Error())
+		return
+	}
+	// Client context comes first, so document parts are numbered after it
+	for i := range sources {
+		sources[i].Number = len(req.Context) + i + 1
+	}
+	ragContext = append(req.Context, ragContext...)
+
+	// Images sent to a text-only model would fail upstream with an opaque error
+	model, _ := h.model(params.Model)
+	if (hasImage(req.MessageContent) || len(req.ImageIDs) > 0) && !model.Vision {
+		writeError(w, http.StatusBadRequest, "model_not_vision", "Model "+model.Name+" does not support images")
+		return
+	}
+	params.Model = model.Name
+
+	systemPrompt := h.systemPrompt(r.Context(), s, model.Name)
+
+	// Build the user turn. Inline images are stored and recorded in the
+	// session by ID, so follow-up turns can send them again.
+	imageParts, inlineImages, status, err := h.turnImages(s.ID, &req)
+	if err != nil {
+		code, message := imageError(err)
+		writeError(w, status, code, message)
+		return
+	}
+	// Nothing refers to the inline images of a failed or cancelled turn
+	stored := false
+	defer func() {
+		if !stored {
+			h.discardImages(s.ID, inlineImages)
 		}
+	}()
+	userMessage := session.Message{
+		Role:  "user",
+		Parts: append([]session.Part{session.TextPart(query)}, imageParts...),
+	}
+	for _, id := range req.DocumentIDs {
+		userMessage.Parts = append(userMessage.Parts, session.DocumentPart(id))
+	}
+	userContent := session.ToLLM(userMessage, h.resolver(s.ID, true)).Content
+
+	// Fit as much conversation history as the model's context window allows
+	// next to the prompt, context, query and the reserved completion tokens
+	budget := h.config.ContextWindow(model.Name) - params.CompletionTokens() -
+		llm.EstimateMessageTokens(llm.BuildMessages(nil, userContent, ragContext, systemPrompt))
+	sessionMessages, summaryUsage := h.fitHistory(ctx, s, budget, model)
+	if summaryUsage.TotalTokens > 0 {
+		h.sessionManager.AddUsage(s.ID, h.recordUsage(client, model.Name, summaryUsage))
+	}
 
-		// Get LLM response using multimodal API with conversation history
-		response, err = h.llmClient.GenerateMultimodalCompletionWithHistory(sessionMessages, contentItems, req.Context, systemPrompt)
-	} else {
-		// Add user message to session
-		h.sessionManager.AddMessage(session.ID, "user", req.Query)
+	messages := llm.BuildMessages(sessionMessages, userContent, ragContext, systemPrompt)
 
-		// Get LLM response using RAG with conversation history
-		response, err = h.llmClient.GenerateCompletionWithHistory(sessionMessages, req.Query, req.Context, systemPrompt)
+	if req.Stream {
+		stored = h.streamChat(ctx, w, client, s.ID, userMessage, messages, params, sources, len(ragContext))
+		return
 	}
 
+	// Get LLM response using RAG with conversation history
+	completion, data, err := h.answer(ctx, s.ID, messages, params, nil, nil)
 	if err != nil {
-		http.Error(w, "Error generating response: "+err.Error(), http.StatusInternalServerError)
+		if completion != nil {
+			h.recordUsage(client, model.Name, completion.Usage)
+		}
+		writeLLMError(w, err)
 		return
 	}
+	usage := h.recordUsage(client, model.Name, completion.Usage)
+	cited := citedSources(completion.Content, sources, len(ragContext))
 
-	// Add assistant message to session
-	h.sessionManager.AddMessage(session.ID, "assistant", response)
+	// Only completed turns are written to the session, so a cancelled or
+	// failed request leaves no dangling user message behind
+	stored = true
+	h.sessionManager.AppendMessage(s.ID, userMessage)
+	for _, step := range toolSteps(completion, model.Name) {
+		h.sessionManager.AppendMessage(s.ID, step)
+	}
+	h.sessionManager.AppendMessage(s.ID, session.Message{
+		Role:    "assistant",
+		Content: completion.Content,
+		Model:   model.Name,
+		Usage:   &usage,
+		Sources: cited,
+	})
 
 	// Send response
 	resp := ChatResponse{
-		SessionID: session.ID,
-		Response:  response,
+		SessionID: s.ID,
+		Response:  completion.Content,
+		Sources:   cited,
+		Data:      data,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
 
+// messageText joins the text items of message content
+func messageText(content []MessageContent) string {
+	var parts []string
+	for _, item := range content {
+		if item.Type == "text" && item.Text != "" {
+			parts = append(parts, item.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// hasImage reports whether message content contains an image
+func hasImage(content []MessageContent) bool {
+	for _, item := range content {
+		if item.Type == "image_url" && item.ImageURL.URL != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// documentContext returns the parts of the requested documents relevant to
+// the query as context strings, together with a source for each of them.
+// When no IDs are given, every document of the session is used. Documents
+// that could not be indexed are included whole.
+func (h *Handler) documentContext(ctx context.Context, s *session.Session, documentIDs []string, query string) ([]string, []session.Source, error) {
+	explicit := len(documentIDs) > 0
+	if !explicit {
+		documentIDs = s.DocumentIDs
+	}
+
+	var context []string
+	var sources []session.Source
+	wholeDocument := func(doc *document.Document) {
+		context = append(context, fmt.Sprintf("[File: %s]\n%s", doc.Name, doc.Content))
+		sources = append(sources, session.Source{
+			DocumentID:   doc.ID,
+			DocumentName: doc.Name,
+			Snippet:      snippet(doc.Content),
+		})
+	}
+
+	var indexed []string
+	for _, id := range documentIDs {
+		doc, exists := h.documents.Get(id)
+		if !exists || doc.SessionID != s.ID {
+			if !explicit {
+				// The document was deleted after the session was read
+				continue
+			}
+			return nil, nil, fmt.Errorf("unknown document %s", id)
+		}
+
+		if h.retriever.IsIndexed(id) {
+			indexed = append(indexed, id)
+			continue
+		}
+		wholeDocument(doc)
+	}
+
+	chunks, err := h.retriever.Retrieve(ctx, query, indexed)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		// Fall back to whole documents rather than answering without context
+		log.Printf("Retrieval failed, using full documents: %v", err)
+		for _, id := range indexed {
+			doc, _ := h.documents.Get(id)
+			wholeDocument(doc)
+		}
+		return context, sources, nil
+	}
+
+	for _, chunk := range chunks {
+		context = append(context, fmt.Sprintf("[File: %s, part %d]\n%s", chunk.DocumentName, chunk.Index+1, chunk.Text))
+		sources = append(sources, session.Source{
+			DocumentID:   chunk.DocumentID,
+			DocumentName: chunk.DocumentName,
+			ChunkIndex:   chunk.Index,
+			Offset:       chunk.Offset,
+			Snippet:      snippet(chunk.Text),
+		})
+	}
+
+	return context, sources, nil
+}
+
 // HandleSession handles session management
 func (h *Handler) HandleSession(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
 		return
 	}
 
 	var req SessionRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid request")
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 
+	// Actions on an existing session require it to belong to the caller
+	user := auth.UserFromContext(r.Context())
+	switch req.Action {
+	case "get", "delete", "rename", "clear", "fork", "set":
+		if _, exists := h.ownedSession(r.Context(), req.ID); !exists {
+			writeError(w, http.StatusNotFound, "session_not_found", "Session not found")
+			return
+		}
+	}
+
 	switch req.Action {
 	case "create":
-		session := h.sessionManager.NewSession()
+		persona := req.Persona
+		if persona == "" {
+			persona = prompt.DefaultPersona
+		}
+		if !h.prompts.Has(persona) {
+			writeError(w, http.StatusBadRequest, "unknown_persona", "Unknown persona: "+persona)
+			return
+		}
+		session := h.sessionManager.NewSession(user, persona)
 		json.NewEncoder(w).Encode(SessionResponse{
-			ID: session.ID,
+			ID:      session.ID,
+			Persona: session.Persona,
 		})
 
 	case "get":
-		session, exists := h.sessionManager.GetSession(req.ID)
+		session, exists := h.ownedSession(r.Context(), req.ID)
 		if !exists {
-			w.WriteHeader(http.StatusNotFound)
-			json.NewEncoder(w).Encode(SessionResponse{
-				Error: "Session not found",
-			})
+			writeError(w, http.StatusNotFound, "session_not_found", "Session not found")
 			return
 		}
 		json.NewEncoder(w).Encode(SessionResponse{
 			ID:       session.ID,
-			Messages: session.Messages,
+			Title:    session.Title,
+			Persona:  session.Persona,
+			Params:   &session.Params,
+			Messages: structuredMessages(session.Messages),
+		})
+
+	case "list":
+		json.NewEncoder(w).Encode(SessionResponse{
+			Sessions: h.sessionManager.ListSessions(user),
+		})
+
+	case "personas":
+		json.NewEncoder(w).Encode(SessionResponse{
+			Personas: h.prompts.Names(),
+		})
+
+	case "delete":
+		if !h.sessionManager.DeleteSession(req.ID) {
+			writeError(w, http.StatusNotFound, "session_not_found", "Session not found")
+			return
+		}
+		json.NewEncoder(w).Encode(SessionResponse{
+			ID: req.ID,
+		})
+
+	case "rename":
+		if !h.sessionManager.RenameSession(req.ID, req.Title) {
+			writeError(w, http.StatusNotFound, "session_not_found", "Session not found")
+			return
+		}
+		json.NewEncoder(w).Encode(SessionResponse{
+			ID:    req.ID,
+			Title: req.Title,
+		})
+
+	case "clear":
+		if !h.sessionManager.ClearSession(req.ID) {
+			writeError(w, http.StatusNotFound, "session_not_found", "Session not found")
+			return
+		}
+		json.NewEncoder(w).Encode(SessionResponse{
+			ID: req.ID,
+		})
+
+	case "set":
+		session, _ := h.ownedSession(r.Context(), req.ID)
+		params := llm.Params{}
+		if req.Params != nil {
+			params = session.Params.Merge(*req.Params)
+		}
+		if err := h.validateParams(params); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_params", "Invalid parameters: "+err.Error())
+			return
+		}
+		if !h.sessionManager.SetParams(req.ID, params) {
+			writeError(w, http.StatusNotFound, "session_not_found", "Session not found")
+			return
+		}
+		json.NewEncoder(w).Encode(SessionResponse{
+			ID:     req.ID,
+			Params: &params,
+		})
+
+	case "fork":
+		fork, exists := h.sessionManager.ForkSession(req.ID, req.UpTo, user)
+		if !exists {
+			writeError(w, http.StatusNotFound, "session_not_found", "Session not found")
+			return
+		}
+		h.copySessionDocuments(req.ID, fork.ID)
+		h.images.Share(req.ID, fork.ID)
+		json.NewEncoder(w).Encode(SessionResponse{
+			ID:       fork.ID,
+			Title:    fork.Title,
+			Persona:  fork.Persona,
+			Messages: structuredMessages(fork.Messages),
 		})
 
 	default:
-		http.Error(w, "Invalid action", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "invalid_action", "Invalid action")
+	}
+}
+
+// systemPrompt renders the system prompt of a session's persona for a turn
+// answered by model. A broken template falls back to the default persona
+// rather than failing the turn.
+func (h *Handler) systemPrompt(ctx context.Context, s *session.Session, model string) string {
+	data := prompt.Data{
+		Date:  time.Now().Format("2006-01-02"),
+		Now:   time.Now(),
+		Model: model,
+		User:  auth.UserFromContext(ctx),
+		Title: s.Title,
+	}
+	for _, doc := range h.documents.List(s.ID) {
+		data.Documents = append(data.Documents, doc.Name)
+	}
+
+	persona := s.Persona
+	if persona == "" {
+		// Sessions created before personas existed
+		persona = prompt.DefaultPersona
+	}
+
+	systemPrompt, err := h.prompts.Render(persona, data)
+	if err != nil {
+		log.Printf("Failed to render prompt for session %s: %v", s.ID, err)
+		systemPrompt, _ = h.prompts.Render(prompt.DefaultPersona, data)
+	}
+	return systemPrompt
+}
+
+// ownedSession returns a copy of a session if it belongs to the authenticated
+// user. Sessions of other users are reported as missing so their IDs cannot
+// be probed.
+func (h *Handler) ownedSession(ctx context.Context, id string) (*session.Session, bool) {
+	s, exists := h.sessionManager.GetSession(id)
+	if !exists || s.Owner != auth.UserFromContext(ctx) {
+		return nil, false
+	}
+	return s, true
+}
+
+// copySessionDocuments attaches copies of every document of one session to another
+func (h *Handler) copySessionDocuments(fromID, toID string) {
+	for _, doc := range h.documents.List(fromID) {
+		clone, ok := h.documents.Copy(doc.ID, toID)
+		if !ok {
+			continue
+		}
+		if err := h.sessionManager.AddDocument(toID, clone.ID); err != nil {
+			h.documents.Delete(clone.ID)
+			continue
+		}
+		h.retriever.CopyDocument(doc.ID, clone.ID)
+	}
+}
+
+// structuredMessages returns a copy of messages in which every message has
+// its content parts, including those stored before parts existed
+func structuredMessages(messages []session.Message) []session.Message {
+	result := make([]session.Message, len(messages))
+	for i, msg := range messages {
+		msg.Parts = msg.ContentParts()
+		result[i] = msg
 	}
+	return result
 }
@@ -0,0 +1,205 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/genterm/backend/internal/config"
+	"github.com/genterm/backend/internal/llm"
+	"github.com/genterm/backend/internal/session"
+)
+
+// summaryPrompt instructs the model when condensing old conversation turns
+const summaryPrompt = "Summarize the conversation below so it can replace the original messages. " +
+	"Keep facts, decisions, names, numbers and open questions. Be concise and write in the third person."
+
+// fitHistory converts a session's history into LLM messages that fit into
+// budget tokens. The oldest turns that do not fit are dropped or, with the
+// summarize strategy, folded into the session's running summary. It also
+// returns the tokens spent on summarizing, which is done by the same model.
+// Images of recent turns are attached again when the model accepts images.
+func (h *Handler) fitHistory(ctx context.Context, s *session.Session, budget int, model config.ModelInfo) ([]llm.Message, llm.Usage) {
+	start := s.SummarizedMessages
+	if start > len(s.Messages) {
+		start = len(s.Messages)
+	}
+	summary := s.HistorySummary
+
+	history, sourceIndex := h.toLLMMessages(s.ID, s.Messages[start:], model)
+	if llm.EstimateMessageTokens(withSummary(summary, history)) <= budget {
+		return withSummary(summary, history), llm.Usage{}
+	}
+
+	// Keep as many recent turns as fit, leaving a quarter of the budget for
+	// the summary of everything older
+	keepBudget := budget
+	if summary != "" || h.config.HistoryStrategy == "summarize" {
+		keepBudget = budget * 3 / 4
+	}
+	cut := len(history)
+	used := 0
+	for cut > 0 {
+		cost := llm.EstimateMessageTokens(history[cut-1 : cut])
+		if used+cost > keepBudget {
+			break
+		}
+		used += cost
+		cut--
+	}
+	// Tool results cannot be sent without the call they answer
+	for cut < len(history) && history[cut].Role == "tool" {
+		cut++
+	}
+
+	var usage llm.Usage
+	if h.config.HistoryStrategy == "summarize" && cut > 0 {
+		completion, err := h.summarize(ctx, summary, history[:cut], model.Name)
+		if err != nil {
+			log.Printf("Summarizing history of session %s failed, dropping old turns: %v", s.ID, err)
+		} else {
+			summary = completion.Content
+			usage = completion.Usage
+			// Messages left out of history still count as summarized when
+			// they come before the cut
+			summarized := len(s.Messages)
+			if cut < len(history) {
+				summarized = start + sourceIndex[cut]
+			}
+			h.sessionManager.SetHistorySummary(s.ID, summary, summarized)
+		}
+	}
+
+	kept := withSummary(summary, history[cut:])
+	if llm.EstimateMessageTokens(kept) > budget {
+		// The summary itself is too large for what is left of the window
+		kept = history[cut:]
+	}
+
+	return kept, usage
+}
+
+// summarize asks a model to fold older messages into the running summary
+func (h *Handler) summarize(ctx context.Context, summary string, messages []llm.Message, model string) (*llm.Completion, error) {
+	var transcript strings.Builder
+	if summary != "" {
+		fmt.Fprintf(&transcript, "Summary of the earlier conversation:\n%s\n\n", summary)
+	}
+	for _, msg := range messages {
+		fmt.Fprintf(&transcript, "%s: %s\n\n", msg.Role, llm.TextContent(msg.Content))
+	}
+
+	return h.llmClient.Complete(ctx, []llm.Message{
+		{
+			Role:    "system",
+			Content: summaryPrompt,
+		},
+		{
+			Role:    "user",
+			Content: transcript.String(),
+		},
+	}, llm.Params{Model: model})
+}
+
+// withSummary prepends the running summary to a list of messages
+func withSummary(summary string, messages []llm.Message) []llm.Message {
+	if summary == "" {
+		return messages
+	}
+
+	return append([]llm.Message{
+		{
+			Role:    "system",
+			Content: "Summary of the earlier conversation:\n" + summary,
+		},
+	}, messages...)
+}
+
+// toLLMMessages converts session messages into LLM messages. The images of
+// the last ImageHistoryTurns user turns are attached again when the model
+// accepts images; older images are only mentioned, since resending every
+// image with every turn would quickly fill the context window. Tool calls
+// and results are left out for models without tools, and results whose
+// call is no longer part of the history are always left out. The index in
+// messages of every converted message is returned alongside.
+func (h *Handler) toLLMMessages(sessionID string, messages []session.Message, model config.ModelInfo) ([]llm.Message, []int) {
+	attach := 0
+	if model.Vision {
+		attach = h.config.ImageHistoryTurns
+	}
+
+	converted := make([]llm.Message, len(messages))
+	userTurns := 0
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			userTurns++
+		}
+		converted[i] = session.ToLLM(messages[i], h.resolver(sessionID, userTurns <= attach))
+	}
+
+	tools := h.toolsEnabled(model)
+	calls := make(map[string]bool)
+	result := make([]llm.Message, 0, len(converted))
+	sourceIndex := make([]int, 0, len(converted))
+	for i, msg := range converted {
+		if msg.Role == "tool" {
+			if tools && calls[msg.ToolCallID] {
+				result = append(result, msg)
+				sourceIndex = append(sourceIndex, i)
+			}
+			continue
+		}
+		if !tools && len(msg.ToolCalls) > 0 {
+			msg.ToolCalls = nil
+			if llm.TextContent(msg.Content) == "" {
+				continue
+			}
+		}
+		for _, call := range msg.ToolCalls {
+			calls[call.ID] = true
+		}
+		result = append(result, msg)
+		sourceIndex = append(sourceIndex, i)
+	}
+	return result, sourceIndex
+}
+
+// partResolver resolves the image and document parts of the messages of a
+// session against the handler's stores
+type partResolver struct {
+	h         *Handler
+	sessionID string
+	images    bool
+}
+
+// resolver returns a part resolver for a session; images are only sent to
+// the model when images is true
+func (h *Handler) resolver(sessionID string, images bool) partResolver {
+	return partResolver{h: h, sessionID: sessionID, images: images}
+}
+
+// ImageURL returns stored images as data URLs and remote images as is
+func (r partResolver) ImageURL(part session.Part) (string, bool) {
+	if !r.images {
+		return "", false
+	}
+	if part.ImageID == "" {
+		return part.URL, part.URL != ""
+	}
+
+	img, exists := r.h.images.Get(part.ImageID, r.sessionID)
+	if !exists {
+		return "", false
+	}
+	return img.DataURL(), true
+}
+
+// DocumentName returns the name of a document of the session
+func (r partResolver) DocumentName(documentID string) (string, bool) {
+	doc, exists := r.h.documents.Get(documentID)
+	if !exists || doc.SessionID != r.sessionID {
+		return "", false
+	}
+	return doc.Name, true
+}
@@ -0,0 +1,239 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/genterm/backend/internal/media"
+	"github.com/genterm/backend/internal/session"
+)
+
+// HandleImages handles uploading, fetching, listing and deleting session images
+func (h *Handler) HandleImages(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		h.uploadImage(w, r)
+	case http.MethodGet:
+		if r.URL.Query().Get("id") != "" {
+			h.serveImage(w, r)
+			return
+		}
+		h.listImages(w, r)
+	case http.MethodDelete:
+		h.deleteImage(w, r)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+	}
+}
+
+// uploadImage stores an image sent either as multipart form data or JSON
+func (h *Handler) uploadImage(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, h.config.MaxUploadBytes)
+
+	var req ImageUploadRequest
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		if err := r.ParseMultipartForm(h.config.MaxUploadBytes); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_request", "Invalid upload: "+err.Error())
+			return
+		}
+
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_request", "Missing file")
+			return
+		}
+		defer file.Close()
+
+		req.SessionID = r.FormValue("sessionId")
+		req.Name = filepath.Base(header.Filename)
+		req.Data, err = io.ReadAll(file)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_request", "Error reading file")
+			return
+		}
+	} else {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				writeError(w, http.StatusRequestEntityTooLarge, "too_large", "Image too large")
+				return
+			}
+			writeError(w, http.StatusBadRequest, "invalid_request", "Invalid request")
+			return
+		}
+	}
+
+	if _, exists := h.ownedSession(r.Context(), req.SessionID); !exists {
+		writeError(w, http.StatusBadRequest, "invalid_session", "Invalid session")
+		return
+	}
+
+	img, status, err := h.storeImage(req.SessionID, req.Name, req.Data)
+	if err != nil {
+		code, message := imageError(err)
+		writeError(w, status, code, message)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(ImageResponse{
+		Image: img,
+	})
+}
+
+// storeImage normalizes and stores an image for a session. On failure it
+// returns the HTTP status that describes the error.
+func (h *Handler) storeImage(sessionID, name string, data []byte) (*media.Image, int, error) {
+	normalized, err := media.Normalize(data, h.config.ImageMaxDimension)
+	if errors.Is(err, media.ErrUnsupported) {
+		return nil, http.StatusUnsupportedMediaType, fmt.Errorf("%w (use JPEG, PNG or GIF)", err)
+	}
+	if err != nil {
+		log.Printf("Failed to process image %q: %v", name, err)
+		return nil, http.StatusUnprocessableEntity, err
+	}
+
+	img, err := h.images.Add(sessionID, name, normalized, h.config.MaxSessionImages)
+	if err != nil {
+		return nil, http.StatusConflict, fmt.Errorf("%w (at most %d)", err, h.config.MaxSessionImages)
+	}
+	return img, 0, nil
+}
+
+// serveImage returns the stored bytes of an image
+func (h *Handler) serveImage(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.URL.Query().Get("sessionId")
+	if _, exists := h.ownedSession(r.Context(), sessionID); !exists {
+		writeError(w, http.StatusNotFound, "image_not_found", "Image not found")
+		return
+	}
+
+	img, exists := h.images.Get(r.URL.Query().Get("id"), sessionID)
+	if !exists {
+		writeError(w, http.StatusNotFound, "image_not_found", "Image not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", img.MimeType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(img.Data)))
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.Write(img.Data)
+}
+
+// listImages returns the images of a session
+func (h *Handler) listImages(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.URL.Query().Get("sessionId")
+	if _, exists := h.ownedSession(r.Context(), sessionID); !exists {
+		writeError(w, http.StatusNotFound, "session_not_found", "Session not found")
+		return
+	}
+
+	images := h.images.List(sessionID)
+	if images == nil {
+		images = []*media.Image{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ImageListResponse{
+		Images: images,
+	})
+}
+
+// deleteImage removes an image from a session
+func (h *Handler) deleteImage(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.URL.Query().Get("sessionId")
+	if _, exists := h.ownedSession(r.Context(), sessionID); !exists {
+		writeError(w, http.StatusNotFound, "image_not_found", "Image not found")
+		return
+	}
+	if !h.images.Delete(r.URL.Query().Get("id"), sessionID) {
+		writeError(w, http.StatusNotFound, "image_not_found", "Image not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// turnImages returns the image parts of a chat turn: images referenced by
+// ID, and images sent inline as data URLs, which are stored first so that
+// later turns can refer to them. Remote image URLs are kept as URLs. The
+// IDs of the stored inline images are returned, so they can be discarded
+// if the turn is not stored.
+func (h *Handler) turnImages(sessionID string, req *ChatRequest) ([]session.Part, []string, int, error) {
+	var parts []session.Part
+	for _, id := range req.ImageIDs {
+		if _, exists := h.images.Get(id, sessionID); !exists {
+			return nil, nil, http.StatusBadRequest, fmt.Errorf("unknown image %s", id)
+		}
+		parts = append(parts, session.ImagePart(id))
+	}
+
+	var inline []string
+
+	for _, item := range req.MessageContent {
+		if item.Type != "image_url" || item.ImageURL.URL == "" {
+			continue
+		}
+		if !strings.HasPrefix(item.ImageURL.URL, "data:") {
+			parts = append(parts, session.Part{Type: session.PartImage, URL: item.ImageURL.URL})
+			continue
+		}
+
+		data, err := decodeDataURL(item.ImageURL.URL)
+		if err != nil {
+			h.discardImages(sessionID, inline)
+			return nil, nil, http.StatusBadRequest, err
+		}
+		img, status, err := h.storeImage(sessionID, "", data)
+		if err != nil {
+			h.discardImages(sessionID, inline)
+			return nil, nil, status, err
+		}
+		inline = append(inline, img.ID)
+		parts = append(parts, session.ImagePart(img.ID))
+	}
+
+	return parts, inline, 0, nil
+}
+
+// discardImages removes images stored for a turn that was never stored
+func (h *Handler) discardImages(sessionID string, ids []string) {
+	for _, id := range ids {
+		h.images.Delete(id, sessionID)
+	}
+}
+
+// decodeDataURL returns the payload of a base64 data URL
+func decodeDataURL(url string) ([]byte, error) {
+	header, payload, found := strings.Cut(strings.TrimPrefix(url, "data:"), ",")
+	if !found || !strings.HasSuffix(header, ";base64") {
+		return nil, errors.New("invalid image data URL")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, errors.New("invalid image data URL")
+	}
+	return data, nil
+}
+
+// imageError returns the error code and message for an image that could
+// not be stored
+func imageError(err error) (string, string) {
+	if errors.Is(err, media.ErrTooManyImages) {
+		return "too_many_images", "Image not stored: " + err.Error()
+	}
+	return "invalid_image", "Invalid image: " + err.Error()
+}
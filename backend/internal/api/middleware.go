@@ -1,8 +1,15 @@
 package api
 
 import (
+	"encoding/json"
 	"log"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+
+	"github.com/genterm/backend/internal/auth"
+	"github.com/genterm/backend/internal/quota"
 )
 
 // CorsMiddleware wraps an http.Handler to add CORS headers
@@ -22,8 +29,8 @@ func CorsMiddleware(next http.Handler) http.Handler {
 			w.Header().Set("Access-Control-Allow-Origin", "*")
 		}
 
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, X-Session-ID, X-Document-IDs")
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 
 		// Handle preflight requests
@@ -55,8 +62,8 @@ func EnableCors(handler http.HandlerFunc) http.HandlerFunc {
 			w.Header().Set("Access-Control-Allow-Origin", "*")
 		}
 
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, X-Session-ID, X-Document-IDs")
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 
 		// Handle preflight requests
@@ -69,3 +76,64 @@ func EnableCors(handler http.HandlerFunc) http.HandlerFunc {
 		handler(w, r)
 	}
 }
+
+// RequireAuth is a wrapper that rejects requests without valid credentials
+// and stores the authenticated user in the request context. A nil verifier
+// disables authentication.
+func RequireAuth(verifier *auth.Verifier, handler http.HandlerFunc) http.HandlerFunc {
+	if verifier == nil {
+		return handler
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := verifier.Authenticate(r)
+		if err != nil {
+			log.Printf("Rejected request to %s: %v", r.URL.Path, err)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="genterm"`)
+			writeError(w, http.StatusUnauthorized, "unauthorized", "Authentication required")
+			return
+		}
+
+		handler(w, r.WithContext(auth.WithUser(r.Context(), user)))
+	}
+}
+
+// RateLimit is a wrapper that rejects clients sending requests faster than
+// the limiter allows. It must run after RequireAuth so authenticated users
+// are limited by user rather than by address. A nil limiter disables it.
+func RateLimit(limiter *quota.Limiter, handler http.HandlerFunc) http.HandlerFunc {
+	if limiter == nil {
+		return handler
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if ok, wait := limiter.Allow(clientKey(r)); !ok {
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(ErrorResponse{
+				Error:      "Too many requests",
+				Code:       "rate_limited",
+				RetryAfter: retryAfter,
+			})
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+// clientKey identifies the client of a request for rate limits and quotas:
+// the authenticated user, or the remote address without authentication
+func clientKey(r *http.Request) string {
+	if user := auth.UserFromContext(r.Context()); user != "" {
+		return "user:" + user
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/genterm/backend/internal/config"
+)
+
+// HandleModels lists the models clients may choose for a session or request
+func (h *Handler) HandleModels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ModelsResponse{
+		Default: h.config.LLMModel,
+		Models:  h.config.Models,
+	})
+}
+
+// model returns the catalog entry of the model chosen in params, or of the
+// default model
+func (h *Handler) model(name string) (config.ModelInfo, bool) {
+	if name == "" {
+		name = h.config.LLMModel
+	}
+	return h.config.Model(name)
+}
@@ -0,0 +1,564 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/genterm/backend/internal/llm"
+	"github.com/genterm/backend/internal/session"
+	"github.com/google/uuid"
+)
+
+// Headers that select the session and documents of a chat completion; the
+// same values may be sent as session_id and document_ids in the metadata
+const (
+	SessionHeader   = "X-Session-ID"
+	DocumentsHeader = "X-Document-IDs"
+)
+
+// CompletionRequest is the body of POST /v1/chat/completions, in the shape
+// of the OpenAI Chat Completions API
+type CompletionRequest struct {
+	Model               string              `json:"model"`
+	Messages            []CompletionMessage `json:"messages"`
+	MaxTokens           int                 `json:"max_tokens,omitempty"`
+	MaxCompletionTokens int                 `json:"max_completion_tokens,omitempty"`
+	Temperature         *float64            `json:"temperature,omitempty"`
+	TopP                *float64            `json:"top_p,omitempty"`
+	Stop                stopSequences       `json:"stop,omitempty"`
+	Seed                *int                `json:"seed,omitempty"`
+	N                   int                 `json:"n,omitempty"`
+	ResponseFormat      *CompletionFormat   `json:"response_format,omitempty"`
+	Tools               []llm.Tool          `json:"tools,omitempty"`
+	ToolChoice          json.RawMessage     `json:"tool_choice,omitempty"`
+	Stream              bool                `json:"stream,omitempty"`
+	StreamOptions       *llm.StreamOptions  `json:"stream_options,omitempty"`
+	Metadata            map[string]string   `json:"metadata,omitempty"`
+}
+
+// CompletionMessage is a message of a chat completion request. Content is
+// a string, an array of content parts or null.
+type CompletionMessage struct {
+	Role       string          `json:"role"`
+	Content    json.RawMessage `json:"content"`
+	Name       string          `json:"name,omitempty"`
+	ToolCalls  []llm.ToolCall  `json:"tool_calls,omitempty"`
+	ToolCallID string          `json:"tool_call_id,omitempty"`
+}
+
+// CompletionFormat is the response format of a chat completion request
+type CompletionFormat struct {
+	Type       string `json:"type"`
+	JSONSchema *struct {
+		Schema json.RawMessage `json:"schema"`
+	} `json:"json_schema,omitempty"`
+}
+
+// CompletionResponse is a chat completion, or a chunk of one when streamed.
+// Sources lists the document parts cited in the answer.
+type CompletionResponse struct {
+	ID      string             `json:"id"`
+	Object  string             `json:"object"`
+	Created int64              `json:"created"`
+	Model   string             `json:"model"`
+	Choices []CompletionChoice `json:"choices"`
+	Usage   *llm.Usage         `json:"usage,omitempty"`
+	Sources []session.Source   `json:"sources,omitempty"`
+}
+
+// CompletionChoice is the only choice of a chat completion. Message is set
+// in completions and Delta in chunks.
+type CompletionChoice struct {
+	Index        int              `json:"index"`
+	Message      *llm.Message     `json:"message,omitempty"`
+	Delta        *CompletionDelta `json:"delta,omitempty"`
+	FinishReason *string          `json:"finish_reason"`
+}
+
+// CompletionDelta is the part of the answer carried by a chunk
+type CompletionDelta struct {
+	Role      string               `json:"role,omitempty"`
+	Content   string               `json:"content,omitempty"`
+	ToolCalls []CompletionToolCall `json:"tool_calls,omitempty"`
+}
+
+// CompletionToolCall is a tool call in a chunk
+type CompletionToolCall struct {
+	Index int `json:"index"`
+	llm.ToolCall
+}
+
+// CompletionError is the error body of the chat completions API
+type CompletionError struct {
+	Error struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+		Code    string `json:"code"`
+	} `json:"error"`
+}
+
+// stopSequences accepts a single stop sequence or a list of them
+type stopSequences []string
+
+// UnmarshalJSON decodes a string or an array of strings
+func (s *stopSequences) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*s = stopSequences{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return errors.New("stop must be a string or an array of strings")
+	}
+	*s = list
+	return nil
+}
+
+// HandleChatCompletions serves the OpenAI Chat Completions API, so existing
+// OpenAI clients can use the server. The conversation is sent by the client
+// and is not stored. When a session is given, the parts of its documents
+// relevant to the last user message are added as context and the tokens
+// are added to its usage.
+func (h *Handler) HandleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeCompletionError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+		return
+	}
+
+	var req CompletionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeCompletionError(w, http.StatusBadRequest, "invalid_request", "Invalid request: "+err.Error())
+		return
+	}
+	if len(req.Messages) == 0 {
+		writeCompletionError(w, http.StatusBadRequest, "invalid_request", "messages must not be empty")
+		return
+	}
+	if req.N > 1 {
+		writeCompletionError(w, http.StatusBadRequest, "invalid_request", "Only one choice is supported")
+		return
+	}
+
+	model, ok := h.model(req.Model)
+	if !ok {
+		writeCompletionError(w, http.StatusNotFound, "model_not_found", "Unknown model "+req.Model)
+		return
+	}
+	params, err := completionParams(req)
+	if err == nil {
+		params.Model = model.Name
+		err = h.validateParams(params)
+	}
+	if err != nil {
+		writeCompletionError(w, http.StatusBadRequest, "invalid_params", "Invalid parameters: "+err.Error())
+		return
+	}
+	toolChoice, err := completionToolChoice(req)
+	if err != nil {
+		writeCompletionError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	messages, hasImages, err := completionMessages(req.Messages)
+	if err != nil {
+		writeCompletionError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if hasImages && !model.Vision {
+		writeCompletionError(w, http.StatusBadRequest, "model_not_vision", "Model "+model.Name+" does not support images")
+		return
+	}
+
+	// The session and documents come from headers, or else from the metadata
+	sessionID := r.Header.Get(SessionHeader)
+	if sessionID == "" {
+		sessionID = req.Metadata["session_id"]
+	}
+	documentIDs := splitIDs(r.Header.Get(DocumentsHeader))
+	if len(documentIDs) == 0 {
+		documentIDs = splitIDs(req.Metadata["document_ids"])
+	}
+
+	var s *session.Session
+	if sessionID != "" {
+		if s, ok = h.ownedSession(r.Context(), sessionID); !ok {
+			writeCompletionError(w, http.StatusNotFound, "session_not_found", "Session not found")
+			return
+		}
+	} else if len(documentIDs) > 0 {
+		writeCompletionError(w, http.StatusBadRequest, "invalid_request", "Documents can only be used with a session")
+		return
+	}
+
+	client := clientKey(r)
+	if status, err := h.quotas.Check(client); err != nil {
+		if status.ResetAt != nil {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(*status.ResetAt).Seconds()))))
+		}
+		writeCompletionError(w, http.StatusTooManyRequests, "quota_exceeded", "Token quota exceeded")
+		return
+	}
+
+	ctx := r.Context()
+	var sources []session.Source
+	if s != nil {
+		ragContext, found, err := h.documentContext(ctx, s, documentIDs, lastUserText(messages))
+		if ctx.Err() != nil {
+			writeCompletionLLMError(w, ctx.Err())
+			return
+		}
+		if err != nil {
+			writeCompletionError(w, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+		if len(ragContext) > 0 {
+			messages = withContext(messages, ragContext)
+		}
+		for i := range found {
+			found[i].Number = i + 1
+		}
+		sources = found
+	}
+
+	// record charges the tokens of a finished completion to the client and
+	// the session
+	record := func(usage llm.Usage) {
+		priced := h.recordUsage(client, model.Name, usage)
+		if s != nil {
+			h.sessionManager.AddUsage(s.ID, priced)
+		}
+	}
+
+	base := CompletionResponse{
+		ID:      "chatcmpl-" + uuid.New().String(),
+		Created: time.Now().Unix(),
+		Model:   model.Name,
+	}
+	if req.Stream {
+		h.streamCompletion(w, r, base, messages, params, req.Tools, toolChoice, sources, req.StreamOptions, record)
+		return
+	}
+
+	completion, err := h.llmClient.Forward(ctx, messages, params, req.Tools, toolChoice, nil)
+	if err != nil {
+		writeCompletionLLMError(w, err)
+		return
+	}
+	record(completion.Usage)
+
+	message := llm.Message{Role: "assistant", ToolCalls: completion.ToolCalls}
+	if completion.Content != "" || len(completion.ToolCalls) == 0 {
+		message.Content = completion.Content
+	}
+	finishReason := completionFinishReason(completion)
+
+	resp := base
+	resp.Object = "chat.completion"
+	resp.Choices = []CompletionChoice{{Message: &message, FinishReason: &finishReason}}
+	resp.Usage = &completion.Usage
+	resp.Sources = citedSources(completion.Content, sources, len(sources))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// streamCompletion sends a chat completion as chunks in Server-Sent Events,
+// ending with a [DONE] message like the OpenAI API
+func (h *Handler) streamCompletion(w http.ResponseWriter, r *http.Request, base CompletionResponse, messages []llm.Message, params llm.Params, tools []llm.Tool, toolChoice string, sources []session.Source, options *llm.StreamOptions, record func(llm.Usage)) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeCompletionError(w, http.StatusInternalServerError, "internal_error", "Streaming not supported")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	base.Object = "chat.completion.chunk"
+	chunk := func(delta CompletionDelta, finishReason *string) CompletionResponse {
+		c := base
+		c.Choices = []CompletionChoice{{Delta: &delta, FinishReason: finishReason}}
+		return c
+	}
+
+	writeEvent(w, "", chunk(CompletionDelta{Role: "assistant"}, nil))
+	flusher.Flush()
+
+	completion, err := h.llmClient.Forward(r.Context(), messages, params, tools, toolChoice, func(delta string) error {
+		if err := writeEvent(w, "", chunk(CompletionDelta{Content: delta}, nil)); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	})
+	if err != nil {
+		status, resp := llmErrorResponse(err)
+		writeEvent(w, "", completionError(resp.Code, resp.Error, status))
+		flusher.Flush()
+		return
+	}
+	record(completion.Usage)
+
+	if len(completion.ToolCalls) > 0 {
+		calls := make([]CompletionToolCall, len(completion.ToolCalls))
+		for i, call := range completion.ToolCalls {
+			calls[i] = CompletionToolCall{Index: i, ToolCall: call}
+		}
+		writeEvent(w, "", chunk(CompletionDelta{ToolCalls: calls}, nil))
+	}
+
+	finishReason := completionFinishReason(completion)
+	last := chunk(CompletionDelta{}, &finishReason)
+	last.Sources = citedSources(completion.Content, sources, len(sources))
+	writeEvent(w, "", last)
+
+	if options != nil && options.IncludeUsage {
+		usage := base
+		usage.Choices = []CompletionChoice{}
+		usage.Usage = &completion.Usage
+		writeEvent(w, "", usage)
+	}
+
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	flusher.Flush()
+}
+
+// HandleCompletionModels lists the catalog in the shape of the OpenAI
+// models API
+func (h *Handler) HandleCompletionModels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeCompletionError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+		return
+	}
+
+	type model struct {
+		ID      string `json:"id"`
+		Object  string `json:"object"`
+		Created int64  `json:"created"`
+		OwnedBy string `json:"owned_by"`
+	}
+	models := make([]model, len(h.config.Models))
+	for i, m := range h.config.Models {
+		models[i] = model{ID: m.Name, Object: "model", OwnedBy: m.Provider}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Object string  `json:"object"`
+		Data   []model `json:"data"`
+	}{"list", models})
+}
+
+// completionParams converts the generation parameters of a request
+func completionParams(req CompletionRequest) (llm.Params, error) {
+	params := llm.Params{
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		Stop:        req.Stop,
+		Seed:        req.Seed,
+	}
+	if req.MaxCompletionTokens > 0 {
+		params.MaxTokens = req.MaxCompletionTokens
+	}
+
+	if req.ResponseFormat != nil {
+		switch req.ResponseFormat.Type {
+		case "text":
+			params.ResponseFormat = llm.ResponseFormatText
+		case "json_object":
+			params.ResponseFormat = llm.ResponseFormatJSON
+		case "json_schema":
+			if req.ResponseFormat.JSONSchema == nil || len(req.ResponseFormat.JSONSchema.Schema) == 0 {
+				return params, errors.New("response_format json_schema needs a schema")
+			}
+			params.ResponseSchema = req.ResponseFormat.JSONSchema.Schema
+		default:
+			return params, fmt.Errorf("unsupported response_format %q", req.ResponseFormat.Type)
+		}
+	}
+
+	return params, nil
+}
+
+// completionToolChoice returns the tool choice of a request. Only "auto"
+// and "none" work with every provider.
+func completionToolChoice(req CompletionRequest) (string, error) {
+	for _, tool := range req.Tools {
+		if tool.Type != "function" || tool.Function.Name == "" {
+			return "", errors.New("tools must be functions with a name")
+		}
+	}
+	if len(req.ToolChoice) == 0 || bytes.Equal(req.ToolChoice, []byte("null")) {
+		return llm.ToolChoiceAuto, nil
+	}
+
+	var choice string
+	if err := json.Unmarshal(req.ToolChoice, &choice); err != nil || (choice != llm.ToolChoiceAuto && choice != llm.ToolChoiceNone) {
+		return "", errors.New(`tool_choice must be "auto" or "none"`)
+	}
+	return choice, nil
+}
+
+// completionMessages converts the messages of a request and reports whether
+// they contain images. Images are only accepted in user messages; the
+// content parts of other messages are joined into text.
+func completionMessages(messages []CompletionMessage) ([]llm.Message, bool, error) {
+	result := make([]llm.Message, 0, len(messages))
+	hasImages := false
+	for i, msg := range messages {
+		role := msg.Role
+		switch role {
+		case "developer":
+			role = "system"
+		case "system", "user", "assistant", "tool":
+		default:
+			return nil, false, fmt.Errorf("messages[%d]: unknown role %q", i, msg.Role)
+		}
+
+		converted := llm.Message{
+			Role:       role,
+			ToolCalls:  msg.ToolCalls,
+			ToolCallID: msg.ToolCallID,
+			Name:       msg.Name,
+		}
+
+		var text string
+		var parts []struct {
+			Type     string       `json:"type"`
+			Text     string       `json:"text"`
+			ImageURL llm.ImageURL `json:"image_url"`
+		}
+		switch {
+		case len(msg.Content) == 0 || bytes.Equal(msg.Content, []byte("null")):
+			if role != "assistant" || len(msg.ToolCalls) == 0 {
+				return nil, false, fmt.Errorf("messages[%d]: content is required", i)
+			}
+		case json.Unmarshal(msg.Content, &text) == nil:
+			converted.Content = text
+		case json.Unmarshal(msg.Content, &parts) == nil:
+			var items []llm.ContentItem
+			var texts []string
+			for _, part := range parts {
+				switch {
+				case part.Type == "text":
+					items = append(items, llm.ContentItem{Type: "text", Text: part.Text})
+					texts = append(texts, part.Text)
+				case part.Type == "image_url" && role == "user" && part.ImageURL.URL != "":
+					items = append(items, llm.ContentItem{Type: "image_url", ImageURL: part.ImageURL})
+					hasImages = true
+				default:
+					return nil, false, fmt.Errorf("messages[%d]: unsupported content part %q", i, part.Type)
+				}
+			}
+			if role == "user" {
+				converted.Content = items
+			} else {
+				converted.Content = strings.Join(texts, "\n")
+			}
+		default:
+			return nil, false, fmt.Errorf("messages[%d]: content must be a string or an array of parts", i)
+		}
+
+		result = append(result, converted)
+	}
+	return result, hasImages, nil
+}
+
+// lastUserText returns the text of the last user message, the query used
+// to find relevant document parts
+func lastUserText(messages []llm.Message) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			return llm.TextContent(messages[i].Content)
+		}
+	}
+	return ""
+}
+
+// withContext inserts the context message after the leading system
+// messages, where the chat API puts it too
+func withContext(messages []llm.Message, ragContext []string) []llm.Message {
+	at := 0
+	for at < len(messages) && messages[at].Role == "system" {
+		at++
+	}
+
+	result := make([]llm.Message, 0, len(messages)+1)
+	result = append(result, messages[:at]...)
+	result = append(result, llm.ContextMessage(ragContext))
+	return append(result, messages[at:]...)
+}
+
+// completionFinishReason translates the finish reason of a provider into
+// one of the OpenAI API
+func completionFinishReason(completion *llm.Completion) string {
+	switch completion.FinishReason {
+	case "length", "max_tokens":
+		return "length"
+	case "content_filter":
+		return "content_filter"
+	}
+	if len(completion.ToolCalls) > 0 {
+		return "tool_calls"
+	}
+	return "stop"
+}
+
+// splitIDs splits a comma-separated list of IDs
+func splitIDs(list string) []string {
+	var ids []string
+	for _, id := range strings.Split(list, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// completionError builds the error body of the chat completions API
+func completionError(code, message string, status int) CompletionError {
+	var resp CompletionError
+	resp.Error.Message = message
+	resp.Error.Code = code
+	switch {
+	case status == http.StatusUnauthorized:
+		resp.Error.Type = "authentication_error"
+	case status == http.StatusTooManyRequests:
+		resp.Error.Type = "rate_limit_error"
+	case status < http.StatusInternalServerError:
+		resp.Error.Type = "invalid_request_error"
+	default:
+		resp.Error.Type = "api_error"
+	}
+	return resp
+}
+
+// writeCompletionError writes an error in the format of the chat
+// completions API
+func writeCompletionError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(completionError(code, message, status))
+}
+
+// writeCompletionLLMError writes an error from the LLM client in the
+// format of the chat completions API
+func writeCompletionLLMError(w http.ResponseWriter, err error) {
+	status, resp := llmErrorResponse(err)
+	if resp.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(resp.RetryAfter))
+	}
+	writeCompletionError(w, status, resp.Code, resp.Error)
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/genterm/backend/internal/llm"
+	"github.com/genterm/backend/internal/schema"
+)
+
+// maxStopSequences is the most stop sequences any supported provider accepts
+const maxStopSequences = 4
+
+// validateParams checks generation parameters against the server's limits
+func (h *Handler) validateParams(p llm.Params) error {
+	if _, ok := h.model(p.Model); !ok {
+		return fmt.Errorf("unknown model %s", p.Model)
+	}
+	if p.MaxTokens < 0 || p.MaxTokens > h.config.MaxCompletionTokens {
+		return fmt.Errorf("maxTokens must be between 1 and %d", h.config.MaxCompletionTokens)
+	}
+	if p.Temperature != nil && (*p.Temperature < 0 || *p.Temperature > h.config.MaxTemperature) {
+		return fmt.Errorf("temperature must be between 0 and %g", h.config.MaxTemperature)
+	}
+	if p.TopP != nil && (*p.TopP <= 0 || *p.TopP > 1) {
+		return errors.New("topP must be greater than 0 and at most 1")
+	}
+	if len(p.Stop) > maxStopSequences {
+		return fmt.Errorf("at most %d stop sequences are allowed", maxStopSequences)
+	}
+	for _, stop := range p.Stop {
+		if stop == "" {
+			return errors.New("stop sequences must not be empty")
+		}
+	}
+
+	switch p.ResponseFormat {
+	case "", llm.ResponseFormatText, llm.ResponseFormatJSON:
+	default:
+		return fmt.Errorf("responseFormat must be %q or %q", llm.ResponseFormatText, llm.ResponseFormatJSON)
+	}
+	if len(p.ResponseSchema) > 0 {
+		if _, err := schema.Parse(p.ResponseSchema); err != nil {
+			return fmt.Errorf("responseSchema: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/genterm/backend/internal/llm"
+	"github.com/genterm/backend/internal/session"
+)
+
+// snippetLength is the number of runes of a cited chunk returned as snippet
+const snippetLength = 200
+
+// citedSources returns the sources cited in an answer. sources holds the
+// document parts of the context, numbered as the model saw them; context
+// items sent by the client have no source and are never returned.
+func citedSources(answer string, sources []session.Source, contextItems int) []session.Source {
+	byNumber := make(map[int]session.Source, len(sources))
+	for _, source := range sources {
+		byNumber[source.Number] = source
+	}
+
+	var cited []session.Source
+	for _, n := range llm.Citations(answer, contextItems) {
+		if source, exists := byNumber[n]; exists {
+			cited = append(cited, source)
+		}
+	}
+	return cited
+}
+
+// snippet shortens text to about snippetLength runes, cutting at a word
+func snippet(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) <= snippetLength {
+		return text
+	}
+
+	cut := snippetLength
+	if space := strings.LastIndex(string(runes[:cut]), " "); space > snippetLength/2 {
+		return text[:space] + "…"
+	}
+	return string(runes[:cut]) + "…"
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/genterm/backend/internal/llm"
+	"github.com/genterm/backend/internal/session"
+)
+
+// streamChat forwards a completion to the client as Server-Sent Events and
+// stores the turn in the session once the stream has completed. Tokens are
+// charged to the client's quota, and the cited sources are sent with the
+// final event. Tool calls are announced with tool events. Answers that must
+// follow a response schema are only sent with the final event. It reports
+// whether the turn was stored.
+func (h *Handler) streamChat(ctx context.Context, w http.ResponseWriter, client, sessionID string, userMessage session.Message, messages []llm.Message, params llm.Params, sources []session.Source, contextItems int) bool {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming_unsupported", "Streaming not supported")
+		return false
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	completion, data, err := h.answer(ctx, sessionID, messages, params, func(delta string) error {
+		if err := writeEvent(w, "", StreamDelta{Delta: delta}); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}, func(call llm.ToolCall) {
+		writeEvent(w, "tool", ToolEvent{Name: call.Function.Name, Arguments: call.Function.Arguments})
+		flusher.Flush()
+	})
+	if err != nil {
+		if completion != nil {
+			h.recordUsage(client, params.Model, completion.Usage)
+		}
+		log.Printf("Streaming failed for session %s: %v", sessionID, err)
+		_, resp := llmErrorResponse(err)
+		writeEvent(w, "error", resp)
+		flusher.Flush()
+		return false
+	}
+	usage := h.recordUsage(client, params.Model, completion.Usage)
+	cited := citedSources(completion.Content, sources, contextItems)
+
+	// Partial answers of cancelled streams are never stored
+	h.sessionManager.AppendMessage(sessionID, userMessage)
+	for _, step := range toolSteps(completion, params.Model) {
+		h.sessionManager.AppendMessage(sessionID, step)
+	}
+	h.sessionManager.AppendMessage(sessionID, session.Message{
+		Role:    "assistant",
+		Content: completion.Content,
+		Model:   params.Model,
+		Usage:   &usage,
+		Sources: cited,
+	})
+
+	writeEvent(w, "done", ChatResponse{
+		SessionID: sessionID,
+		Response:  completion.Content,
+		Sources:   cited,
+		Data:      data,
+	})
+	flusher.Flush()
+	return true
+}
+
+// writeEvent writes a single Server-Sent Event with a JSON payload
+func writeEvent(w http.ResponseWriter, event string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	if event != "" {
+		if _, err := fmt.Fprintf(w, "event: %s\n", event); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+	return err
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/genterm/backend/internal/llm"
+	"github.com/genterm/backend/internal/schema"
+)
+
+// errInvalidOutput is returned when an answer does not match the response
+// schema even after the model was asked to correct it
+var errInvalidOutput = errors.New("answer does not match the response schema")
+
+// schemaRetryPrompt asks the model to correct an answer that does not match
+// the response schema
+const schemaRetryPrompt = "Your reply does not match the required JSON Schema: %v. Reply again with only the corrected JSON."
+
+// answer generates the answer of a turn. When the parameters carry a
+// response schema the answer is validated against it and returned parsed;
+// an answer that does not match is sent back once with the validation
+// error. Such answers are not streamed, since a rejected attempt would
+// already have reached the client. When the first attempt was rejected, its
+// completion is returned along with any later error, so the tokens spent can
+// be charged.
+func (h *Handler) answer(ctx context.Context, sessionID string, messages []llm.Message, params llm.Params, onDelta func(string) error, onToolCall func(llm.ToolCall)) (*llm.Completion, json.RawMessage, error) {
+	if len(params.ResponseSchema) == 0 {
+		completion, err := h.complete(ctx, sessionID, messages, params, onDelta, onToolCall)
+		return completion, nil, err
+	}
+
+	responseSchema, err := schema.Parse(params.ResponseSchema)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", llm.ErrInvalidRequest, err)
+	}
+
+	completion, err := h.complete(ctx, sessionID, messages, params, nil, onToolCall)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := structuredData(responseSchema, completion.Content)
+	if err == nil {
+		return completion, data, nil
+	}
+
+	retry := append(messages[:len(messages):len(messages)], completion.Steps...)
+	retry = append(retry,
+		llm.Message{Role: "assistant", Content: completion.Content},
+		llm.Message{Role: "user", Content: fmt.Sprintf(schemaRetryPrompt, err)},
+	)
+	corrected, err := h.complete(ctx, sessionID, retry, params, nil, onToolCall)
+	if err != nil {
+		return completion, nil, err
+	}
+	corrected.Usage = completion.Usage.Add(corrected.Usage)
+	corrected.Steps = append(completion.Steps, corrected.Steps...)
+
+	data, err = structuredData(responseSchema, corrected.Content)
+	if err != nil {
+		return corrected, nil, fmt.Errorf("%w: %v", errInvalidOutput, err)
+	}
+	return corrected, data, nil
+}
+
+// structuredData validates an answer against a schema and returns it as
+// compact JSON. Models sometimes wrap JSON in a Markdown code fence even
+// when asked not to, so a fence is removed first.
+func structuredData(s *schema.Schema, content string) (json.RawMessage, error) {
+	text := strings.TrimSpace(content)
+	if strings.HasPrefix(text, "```") && strings.HasSuffix(text, "```") {
+		text = strings.TrimSuffix(text, "```")
+		if newline := strings.Index(text, "\n"); newline >= 0 {
+			text = text[newline+1:]
+		} else {
+			text = strings.TrimPrefix(text, "```")
+		}
+	}
+
+	if err := s.Validate([]byte(text)); err != nil {
+		return nil, err
+	}
+
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, []byte(text)); err != nil {
+		return nil, err
+	}
+	return compact.Bytes(), nil
+}
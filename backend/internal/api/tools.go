@@ -0,0 +1,118 @@
+package api
+
+import (
+	"context"
+	"log"
+
+	"github.com/genterm/backend/internal/config"
+	"github.com/genterm/backend/internal/document"
+	"github.com/genterm/backend/internal/llm"
+	"github.com/genterm/backend/internal/media"
+	"github.com/genterm/backend/internal/rag"
+	"github.com/genterm/backend/internal/session"
+	"github.com/genterm/backend/internal/tools"
+)
+
+// toolsEnabled reports whether a model is offered the server-side tools
+func (h *Handler) toolsEnabled(model config.ModelInfo) bool {
+	return h.config.ToolMaxIterations > 0 && model.Tools
+}
+
+// complete generates the answer of a turn. Models that support tools may
+// call them on the files of the session; onToolCall is told about every
+// call. The answer is streamed when onDelta is set.
+func (h *Handler) complete(ctx context.Context, sessionID string, messages []llm.Message, params llm.Params, onDelta func(string) error, onToolCall func(llm.ToolCall)) (*llm.Completion, error) {
+	model, _ := h.model(params.Model)
+	if !h.toolsEnabled(model) {
+		if onDelta != nil {
+			return h.llmClient.StreamCompletion(ctx, messages, params, onDelta)
+		}
+		return h.llmClient.Complete(ctx, messages, params)
+	}
+
+	return h.llmClient.CompleteWithTools(ctx, messages, params, llm.ToolLoop{
+		Runner:        tools.ForSession(sessionFiles{h: h, sessionID: sessionID}),
+		MaxIterations: h.config.ToolMaxIterations,
+		OnDelta:       onDelta,
+		OnToolCall:    onToolCall,
+	})
+}
+
+// toolSteps converts the tool calls and results of a completion into
+// session messages, stored between the user turn and the answer
+func toolSteps(completion *llm.Completion, model string) []session.Message {
+	steps := make([]session.Message, 0, len(completion.Steps))
+	for _, step := range completion.Steps {
+		message := session.FromLLM(step)
+		if message.Role == "assistant" {
+			message.Model = model
+		}
+		steps = append(steps, message)
+	}
+	return steps
+}
+
+// sessionFiles gives the tools access to the files of one session
+type sessionFiles struct {
+	h         *Handler
+	sessionID string
+}
+
+// Documents returns the documents of the session
+func (f sessionFiles) Documents() []*document.Document {
+	return f.h.documents.List(f.sessionID)
+}
+
+// Images returns the images of the session
+func (f sessionFiles) Images() []*media.Image {
+	return f.h.images.List(f.sessionID)
+}
+
+// Search finds the relevant parts of indexed documents by their embeddings,
+// and those of documents without embeddings by keywords
+func (f sessionFiles) Search(ctx context.Context, query string, documentIDs []string) ([]rag.Chunk, error) {
+	var indexed []*document.Document
+	var unindexed []*document.Document
+	for _, id := range documentIDs {
+		doc, exists := f.h.documents.Get(id)
+		if !exists || doc.SessionID != f.sessionID {
+			continue
+		}
+		if f.h.retriever.IsIndexed(id) {
+			indexed = append(indexed, doc)
+		} else {
+			unindexed = append(unindexed, doc)
+		}
+	}
+
+	var chunks []rag.Chunk
+	if len(indexed) > 0 {
+		ids := make([]string, len(indexed))
+		for i, doc := range indexed {
+			ids[i] = doc.ID
+		}
+
+		found, err := f.h.retriever.Retrieve(ctx, query, ids)
+		switch {
+		case ctx.Err() != nil:
+			return nil, ctx.Err()
+		case err != nil:
+			log.Printf("Retrieval failed, searching by keywords: %v", err)
+			unindexed = append(unindexed, indexed...)
+		default:
+			chunks = found
+		}
+	}
+
+	var candidates []rag.Chunk
+	for _, doc := range unindexed {
+		split := rag.Split(doc.Content, f.h.config.ChunkSize, f.h.config.ChunkOverlap)
+		for i := range split {
+			split[i].DocumentID = doc.ID
+			split[i].DocumentName = doc.Name
+		}
+		candidates = append(candidates, split...)
+	}
+
+	return append(chunks, rag.MatchKeywords(candidates, query, f.h.config.RetrievalTopK)...), nil
+}
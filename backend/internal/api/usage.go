@@ -0,0 +1,148 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/genterm/backend/internal/auth"
+	"github.com/genterm/backend/internal/llm"
+	"github.com/genterm/backend/internal/session"
+)
+
+// usageLedger totals the usage of all requests per client and model, with
+// clients keyed like quotas. Unlike session totals it survives the deletion
+// of sessions, but not a server restart.
+type usageLedger struct {
+	clients map[string]map[string]session.Usage
+	since   time.Time
+	mutex   sync.Mutex
+}
+
+// newUsageLedger creates an empty ledger
+func newUsageLedger() *usageLedger {
+	return &usageLedger{
+		clients: make(map[string]map[string]session.Usage),
+		since:   time.Now(),
+	}
+}
+
+// record adds the usage of a request of a client to a model
+func (l *usageLedger) record(client, model string, usage session.Usage) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	models, exists := l.clients[client]
+	if !exists {
+		models = make(map[string]session.Usage)
+		l.clients[client] = models
+	}
+	total := models[model]
+	total.Add(usage)
+	models[model] = total
+}
+
+// totals returns the usage of a client summed over all models and per model
+func (l *usageLedger) totals(client string) (session.Usage, map[string]session.Usage) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	var total session.Usage
+	models := make(map[string]session.Usage, len(l.clients[client]))
+	for model, usage := range l.clients[client] {
+		total.Add(usage)
+		models[model] = usage
+	}
+	return total, models
+}
+
+// serverTotals returns the usage of all clients summed over everything, per
+// model and per client
+func (l *usageLedger) serverTotals() (session.Usage, map[string]session.Usage, map[string]session.Usage) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	var total session.Usage
+	models := make(map[string]session.Usage)
+	clients := make(map[string]session.Usage, len(l.clients))
+	for client, usages := range l.clients {
+		var clientTotal session.Usage
+		for model, usage := range usages {
+			clientTotal.Add(usage)
+			modelTotal := models[model]
+			modelTotal.Add(usage)
+			models[model] = modelTotal
+		}
+		total.Add(clientTotal)
+		clients[client] = clientTotal
+	}
+	return total, models, clients
+}
+
+// recordUsage prices the tokens of a completion and charges them to the
+// client's quota and its totals in the ledger
+func (h *Handler) recordUsage(client, model string, usage llm.Usage) session.Usage {
+	priced := session.Usage{
+		Requests:         1,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TotalTokens:      usage.TotalTokens,
+		Cost:             h.config.Cost(model, usage.PromptTokens, usage.CompletionTokens),
+	}
+
+	h.quotas.Record(client, usage.TotalTokens)
+	h.usage.record(client, model, priced)
+
+	return priced
+}
+
+// HandleUsage reports token usage and cost for a session given by the
+// sessionId query parameter, or for all requests of the client. With
+// scope=server, usage admins get the totals of all clients.
+func (h *Handler) HandleUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if sessionID := r.URL.Query().Get("sessionId"); sessionID != "" {
+		s, exists := h.ownedSession(r.Context(), sessionID)
+		if !exists {
+			writeError(w, http.StatusNotFound, "session_not_found", "Session not found")
+			return
+		}
+
+		usage, _ := h.sessionManager.GetUsage(s.ID)
+		json.NewEncoder(w).Encode(UsageResponse{
+			SessionID: s.ID,
+			Usage:     usage,
+		})
+		return
+	}
+
+	if r.URL.Query().Get("scope") == "server" {
+		if !h.config.IsUsageAdmin(auth.UserFromContext(r.Context())) {
+			writeError(w, http.StatusForbidden, "forbidden", "Server usage is only available to usage admins")
+			return
+		}
+
+		total, models, clients := h.usage.serverTotals()
+		json.NewEncoder(w).Encode(UsageResponse{
+			Usage:   total,
+			Models:  models,
+			Clients: clients,
+			Since:   &h.usage.since,
+		})
+		return
+	}
+
+	total, models := h.usage.totals(clientKey(r))
+	json.NewEncoder(w).Encode(UsageResponse{
+		Usage:  total,
+		Models: models,
+		Since:  &h.usage.since,
+	})
+}
@@ -0,0 +1,179 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/genterm/backend/internal/auth"
+	"github.com/genterm/backend/internal/prompt"
+	"github.com/genterm/backend/internal/session"
+)
+
+// V1Prefix is the path under which the versioned REST API is served
+const V1Prefix = "/api/v1/"
+
+// V1 returns the handler of the versioned REST API. Every route is wrapped
+// in wrap, typically authentication and rate limiting. Unknown paths and
+// methods get the same JSON error envelope as every other failure.
+func (h *Handler) V1(wrap func(http.HandlerFunc) http.HandlerFunc) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/sessions", wrap(h.listSessions))
+	mux.HandleFunc("POST /api/v1/sessions", wrap(h.createSession))
+	mux.HandleFunc("GET /api/v1/sessions/{id}", wrap(h.getSession))
+	mux.HandleFunc("DELETE /api/v1/sessions/{id}", wrap(h.deleteSession))
+	mux.HandleFunc("GET /api/v1/sessions/{id}/messages", wrap(h.listMessages))
+	mux.HandleFunc("POST /api/v1/sessions/{id}/messages", wrap(h.postMessage))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler, pattern := mux.Handler(r)
+		if pattern != "" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		// The mux answers unmatched requests in plain text; only its status
+		// and Allow header are kept
+		unmatched := &statusRecorder{header: make(http.Header)}
+		handler.ServeHTTP(unmatched, r)
+		if unmatched.status == http.StatusMethodNotAllowed {
+			w.Header().Set("Allow", unmatched.header.Get("Allow"))
+			writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+			return
+		}
+		writeError(w, http.StatusNotFound, "not_found", "Not found")
+	})
+}
+
+// listSessions handles GET /api/v1/sessions
+func (h *Handler) listSessions(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, SessionResponse{
+		Sessions: h.sessionManager.ListSessions(auth.UserFromContext(r.Context())),
+	})
+}
+
+// createSession handles POST /api/v1/sessions. The body is optional.
+func (h *Handler) createSession(w http.ResponseWriter, r *http.Request) {
+	var req CreateSessionRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_request", "Invalid request")
+			return
+		}
+	}
+
+	persona := req.Persona
+	if persona == "" {
+		persona = prompt.DefaultPersona
+	}
+	if !h.prompts.Has(persona) {
+		writeError(w, http.StatusBadRequest, "unknown_persona", "Unknown persona: "+persona)
+		return
+	}
+
+	s := h.sessionManager.NewSession(auth.UserFromContext(r.Context()), persona)
+	w.Header().Set("Location", V1Prefix+"sessions/"+s.ID)
+	writeJSON(w, http.StatusCreated, SessionResponse{
+		ID:      s.ID,
+		Persona: s.Persona,
+		Params:  &s.Params,
+	})
+}
+
+// getSession handles GET /api/v1/sessions/{id}
+func (h *Handler) getSession(w http.ResponseWriter, r *http.Request) {
+	s, exists := h.ownedSession(r.Context(), r.PathValue("id"))
+	if !exists {
+		writeV1SessionNotFound(w)
+		return
+	}
+	writeJSON(w, http.StatusOK, SessionResponse{
+		ID:       s.ID,
+		Title:    s.Title,
+		Persona:  s.Persona,
+		Params:   &s.Params,
+		Messages: structuredMessages(s.Messages),
+	})
+}
+
+// deleteSession handles DELETE /api/v1/sessions/{id}
+func (h *Handler) deleteSession(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, exists := h.ownedSession(r.Context(), id); !exists || !h.sessionManager.DeleteSession(id) {
+		writeV1SessionNotFound(w)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listMessages handles GET /api/v1/sessions/{id}/messages
+func (h *Handler) listMessages(w http.ResponseWriter, r *http.Request) {
+	s, exists := h.ownedSession(r.Context(), r.PathValue("id"))
+	if !exists {
+		writeV1SessionNotFound(w)
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Messages []session.Message `json:"messages"`
+	}{structuredMessages(s.Messages)})
+}
+
+// postMessage handles POST /api/v1/sessions/{id}/messages: it takes the body
+// of a chat request and answers the turn like /api/chat
+func (h *Handler) postMessage(w http.ResponseWriter, r *http.Request) {
+	s, exists := h.ownedSession(r.Context(), r.PathValue("id"))
+	if !exists {
+		writeV1SessionNotFound(w)
+		return
+	}
+
+	var req ChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Invalid request")
+		return
+	}
+	if req.SessionID != "" && req.SessionID != s.ID {
+		writeError(w, http.StatusBadRequest, "invalid_session", "sessionId does not match the session in the path")
+		return
+	}
+	req.SessionID = s.ID
+
+	h.chat(w, r, s, req)
+}
+
+// writeJSON writes a JSON response with the given status
+func writeJSON(w http.ResponseWriter, status int, payload interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(payload)
+}
+
+// writeV1SessionNotFound writes the error for an unknown session
+func writeV1SessionNotFound(w http.ResponseWriter) {
+	writeError(w, http.StatusNotFound, "session_not_found", "Session not found")
+}
+
+// statusRecorder is a response writer that only keeps the status and headers
+type statusRecorder struct {
+	header http.Header
+	status int
+}
+
+// Header returns the recorded headers
+func (r *statusRecorder) Header() http.Header {
+	return r.header
+}
+
+// Write discards the body
+func (r *statusRecorder) Write(data []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return len(data), nil
+}
+
+// WriteHeader records the status
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
@@ -0,0 +1,28 @@
+package api
+
+import "github.com/genterm/backend/internal/wire"
+
+// The request and response bodies are defined in package wire, which
+// clients share with the server
+type (
+	SessionRequest        = wire.SessionRequest
+	SessionResponse       = wire.SessionResponse
+	MessageContent        = wire.MessageContent
+	ImageURL              = wire.ImageURL
+	ChatRequest           = wire.ChatRequest
+	ChatResponse          = wire.ChatResponse
+	StreamDelta           = wire.StreamDelta
+	ToolEvent             = wire.ToolEvent
+	CancelRequest         = wire.CancelRequest
+	CancelResponse        = wire.CancelResponse
+	ErrorResponse         = wire.ErrorResponse
+	DocumentUploadRequest = wire.DocumentUploadRequest
+	DocumentResponse      = wire.DocumentResponse
+	DocumentListResponse  = wire.DocumentListResponse
+	ImageUploadRequest    = wire.ImageUploadRequest
+	ImageResponse         = wire.ImageResponse
+	ImageListResponse     = wire.ImageListResponse
+	UsageResponse         = wire.UsageResponse
+	ModelsResponse        = wire.ModelsResponse
+	CreateSessionRequest  = wire.CreateSessionRequest
+)
@@ -0,0 +1,180 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Errors returned by Authenticate
+var (
+	ErrMissingCredentials = errors.New("missing credentials")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// KeyFile is the on-disk format of the auth key file
+type KeyFile struct {
+	// Keys maps API keys to users. A key is either stored in plain text or
+	// as "sha256:" followed by the hex SHA-256 digest of the key.
+	Keys []KeyEntry `json:"keys"`
+
+	// JWTSecret enables HS256 bearer tokens whose "sub" claim names the user
+	JWTSecret string `json:"jwtSecret,omitempty"`
+}
+
+// KeyEntry assigns an API key to a user
+type KeyEntry struct {
+	User string `json:"user"`
+	Key  string `json:"key"`
+}
+
+// Verifier authenticates requests against the keys of a key file
+type Verifier struct {
+	keys      map[[sha256.Size]byte]string
+	jwtSecret []byte
+}
+
+// LoadVerifier reads a key file and creates a verifier for it
+func LoadVerifier(path string) (*Verifier, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading key file: %w", err)
+	}
+
+	var keyFile KeyFile
+	if err := json.Unmarshal(data, &keyFile); err != nil {
+		return nil, fmt.Errorf("error decoding key file: %w", err)
+	}
+
+	v := &Verifier{
+		keys:      make(map[[sha256.Size]byte]string, len(keyFile.Keys)),
+		jwtSecret: []byte(keyFile.JWTSecret),
+	}
+
+	for _, entry := range keyFile.Keys {
+		if entry.User == "" || entry.Key == "" {
+			return nil, errors.New("key file entries need a user and a key")
+		}
+
+		var digest [sha256.Size]byte
+		if hexDigest, hashed := strings.CutPrefix(entry.Key, "sha256:"); hashed {
+			raw, err := hex.DecodeString(hexDigest)
+			if err != nil || len(raw) != sha256.Size {
+				return nil, fmt.Errorf("invalid sha256 key for user %s", entry.User)
+			}
+			copy(digest[:], raw)
+		} else {
+			digest = sha256.Sum256([]byte(entry.Key))
+		}
+		v.keys[digest] = entry.User
+	}
+
+	if len(v.keys) == 0 && len(v.jwtSecret) == 0 {
+		return nil, errors.New("key file contains no keys and no JWT secret")
+	}
+
+	return v, nil
+}
+
+// Authenticate returns the user a request's credentials belong to. The
+// credentials are read from an "Authorization: Bearer" or "X-API-Key" header.
+func (v *Verifier) Authenticate(r *http.Request) (string, error) {
+	token := r.Header.Get("X-API-Key")
+	if bearer, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); found {
+		token = strings.TrimSpace(bearer)
+	}
+	if token == "" {
+		return "", ErrMissingCredentials
+	}
+
+	if strings.Count(token, ".") == 2 && len(v.jwtSecret) > 0 {
+		return v.verifyJWT(token)
+	}
+
+	// Look up by digest so the comparison does not leak key contents
+	digest := sha256.Sum256([]byte(token))
+	for stored, user := range v.keys {
+		if subtle.ConstantTimeCompare(stored[:], digest[:]) == 1 {
+			return user, nil
+		}
+	}
+
+	return "", ErrInvalidCredentials
+}
+
+// jwtHeader is the header of a JSON Web Token
+type jwtHeader struct {
+	Alg string `json:"alg"`
+}
+
+// jwtClaims are the claims of a JSON Web Token used here
+type jwtClaims struct {
+	Subject   string `json:"sub"`
+	ExpiresAt int64  `json:"exp"`
+	NotBefore int64  `json:"nbf"`
+}
+
+// verifyJWT checks an HS256 token and returns its subject
+func (v *Verifier) verifyJWT(token string) (string, error) {
+	parts := strings.Split(token, ".")
+
+	mac := hmac.New(sha256.New, v.jwtSecret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, mac.Sum(nil)) {
+		return "", ErrInvalidCredentials
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil || header.Alg != "HS256" {
+		return "", ErrInvalidCredentials
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil || claims.Subject == "" {
+		return "", ErrInvalidCredentials
+	}
+
+	now := time.Now().Unix()
+	if claims.ExpiresAt != 0 && now >= claims.ExpiresAt {
+		return "", ErrInvalidCredentials
+	}
+	if claims.NotBefore != 0 && now < claims.NotBefore {
+		return "", ErrInvalidCredentials
+	}
+
+	return claims.Subject, nil
+}
+
+// decodeSegment decodes a base64url JSON segment of a token
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// userKey is the context key for the authenticated user
+type userKey struct{}
+
+// WithUser returns a context carrying the authenticated user
+func WithUser(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// UserFromContext returns the authenticated user, or "" when authentication is disabled
+func UserFromContext(ctx context.Context) string {
+	user, _ := ctx.Value(userKey{}).(string)
+	return user
+}
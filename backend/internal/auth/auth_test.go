@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "test-secret"
+
+// writeKeyFile writes a key file to a temporary directory and returns its path
+func writeKeyFile(t *testing.T, keyFile string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "keys.json")
+	if err := os.WriteFile(path, []byte(keyFile), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// signToken builds a JWT from a header and claims, signed with secret
+func signToken(header, claims map[string]interface{}, secret string) string {
+	encode := func(v interface{}) string {
+		data, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := encode(header) + "." + encode(claims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// hs256 returns a token for claims signed with the test secret
+func hs256(claims map[string]interface{}) string {
+	return signToken(map[string]interface{}{"alg": "HS256", "typ": "JWT"}, claims, testSecret)
+}
+
+func TestAuthenticate(t *testing.T) {
+	hashed := sha256.Sum256([]byte("bob-key"))
+	v, err := LoadVerifier(writeKeyFile(t, `{
+		"keys": [
+			{"user": "alice", "key": "alice-key"},
+			{"user": "bob", "key": "sha256:`+hex.EncodeToString(hashed[:])+`"}
+		],
+		"jwtSecret": "`+testSecret+`"
+	}`))
+	if err != nil {
+		t.Fatalf("LoadVerifier: %v", err)
+	}
+
+	now := time.Now().Unix()
+	tamperedParts := strings.Split(hs256(map[string]interface{}{"sub": "carol"}), ".")
+	tamperedParts[1] = base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"mallory"}`))
+
+	tests := []struct {
+		name          string
+		apiKey        string
+		authorization string
+		user          string
+		err           error
+	}{
+		{"plain key", "alice-key", "", "alice", nil},
+		{"hashed key", "bob-key", "", "bob", nil},
+		{"digest is not a key", "sha256:" + hex.EncodeToString(hashed[:]), "", "", ErrInvalidCredentials},
+		{"unknown key", "nope", "", "", ErrInvalidCredentials},
+		{"no credentials", "", "", "", ErrMissingCredentials},
+		{"bearer key", "", "Bearer alice-key", "alice", nil},
+		{"bearer before X-API-Key", "alice-key", "Bearer bob-key", "bob", nil},
+		{"invalid bearer is not rescued by X-API-Key", "alice-key", "Bearer nope", "", ErrInvalidCredentials},
+		{"other schemes fall back to X-API-Key", "alice-key", "Basic Ym9iOmtleQ==", "alice", nil},
+
+		{"token", "", "Bearer " + hs256(map[string]interface{}{"sub": "carol"}), "carol", nil},
+		{"token as API key", hs256(map[string]interface{}{"sub": "carol"}), "", "carol", nil},
+		{"token within its validity", "", "Bearer " + hs256(map[string]interface{}{"sub": "carol", "nbf": now - 60, "exp": now + 60}), "carol", nil},
+		{"expired token", "", "Bearer " + hs256(map[string]interface{}{"sub": "carol", "exp": now - 1}), "", ErrInvalidCredentials},
+		{"token not yet valid", "", "Bearer " + hs256(map[string]interface{}{"sub": "carol", "nbf": now + 60}), "", ErrInvalidCredentials},
+		{"token without subject", "", "Bearer " + hs256(map[string]interface{}{"exp": now + 60}), "", ErrInvalidCredentials},
+		{"token with wrong secret", "", "Bearer " + signToken(map[string]interface{}{"alg": "HS256"}, map[string]interface{}{"sub": "carol"}, "other"), "", ErrInvalidCredentials},
+		{"token with changed claims", "", "Bearer " + strings.Join(tamperedParts, "."), "", ErrInvalidCredentials},
+		{"token with alg none", "", "Bearer " + signToken(map[string]interface{}{"alg": "none"}, map[string]interface{}{"sub": "carol"}, testSecret), "", ErrInvalidCredentials},
+		{"token with alg HS512", "", "Bearer " + signToken(map[string]interface{}{"alg": "HS512"}, map[string]interface{}{"sub": "carol"}, testSecret), "", ErrInvalidCredentials},
+		{"unsigned token", "", "Bearer " + strings.Join(tamperedParts[:2], ".") + ".", "", ErrInvalidCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/session", nil)
+			if tt.apiKey != "" {
+				r.Header.Set("X-API-Key", tt.apiKey)
+			}
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+
+			user, err := v.Authenticate(r)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Authenticate = %q, %v, want error %v", user, err, tt.err)
+			}
+			if user != tt.user {
+				t.Errorf("Authenticate = %q, want %q", user, tt.user)
+			}
+		})
+	}
+}
+
+func TestAuthenticateWithoutJWTSecret(t *testing.T) {
+	v, err := LoadVerifier(writeKeyFile(t, `{"keys": [{"user": "alice", "key": "alice-key"}]}`))
+	if err != nil {
+		t.Fatalf("LoadVerifier: %v", err)
+	}
+
+	// Without a secret, even a correctly signed token is just an unknown key
+	r := httptest.NewRequest("GET", "/api/session", nil)
+	r.Header.Set("Authorization", "Bearer "+hs256(map[string]interface{}{"sub": "carol"}))
+	if user, err := v.Authenticate(r); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Authenticate = %q, %v, want %v", user, err, ErrInvalidCredentials)
+	}
+}
+
+func TestLoadVerifierErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		keyFile string
+		err     string
+	}{
+		{"not JSON", `{`, "error decoding key file"},
+		{"empty", `{}`, "no keys and no JWT secret"},
+		{"missing user", `{"keys": [{"key": "k"}]}`, "need a user and a key"},
+		{"missing key", `{"keys": [{"user": "alice"}]}`, "need a user and a key"},
+		{"digest not hex", `{"keys": [{"user": "alice", "key": "sha256:xyz"}]}`, "invalid sha256 key for user alice"},
+		{"digest too short", `{"keys": [{"user": "alice", "key": "sha256:abcd"}]}`, "invalid sha256 key for user alice"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadVerifier(writeKeyFile(t, tt.keyFile))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("LoadVerifier(%s) = %v, want error containing %q", tt.keyFile, err, tt.err)
+			}
+		})
+	}
+}
@@ -2,26 +2,122 @@ package config
 
 import (
 	"errors"
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Config holds application configuration
 type Config struct {
-	LLMBaseURL string
-	LLMAPIKey  string
-	LLMModel   string
-	Port       string
+	LLMProvider    string
+	LLMBaseURL     string
+	LLMAPIKey      string
+	LLMModel       string
+	LLMTimeout     time.Duration
+	LLMMaxRetries  int
+	Port           string
+	AuthKeyFile    string
+	MaxUploadBytes int64
+	EmbeddingModel string
+	ChunkSize      int
+	ChunkOverlap   int
+	RetrievalTopK  int
+
+	// Images are scaled down to fit ImageMaxDimension pixels, and those of
+	// the last ImageHistoryTurns user turns are sent again with later turns
+	ImageMaxDimension int
+	ImageHistoryTurns int
+
+	// Rounds of tool calls the model may make in one turn; zero disables tools
+	ToolMaxIterations int
+
+	// Whether the default model is offered tools when the model catalog
+	// does not describe it
+	LLMTools bool
+
+	// Models clients may choose; LLMModel is the default
+	Models []ModelInfo
+
+	// Context window sizes in tokens, per model with a default for the rest
+	ContextWindows       map[string]int
+	DefaultContextWindow int
+	HistoryStrategy      string
+
+	// Upper bounds for generation parameters chosen by clients
+	MaxCompletionTokens int
+	MaxTemperature      float64
+
+	// Directory of system prompt templates, one per persona
+	PromptDir string
+
+	// Prices per model used for cost accounting
+	Pricing map[string]Price
+
+	SessionStore string
+	SessionDir   string
+
+	// Session limits; zero disables a limit
+	SessionTTL             time.Duration
+	SessionJanitorInterval time.Duration
+	MaxSessions            int
+	MaxSessionMessages     int
+	MaxSessionBytes        int
+	MaxSessionDocuments    int
+	MaxSessionImages       int
+
+	// Per-client request rate and LLM token quotas; zero disables a limit
+	RateLimitPerMinute int
+	RateLimitBurst     int
+	DailyTokenQuota    int64
+	MonthlyTokenQuota  int64
+
+	// Authenticated users who may read the usage totals of all clients
+	UsageAdmins []string
+
+	// Azure OpenAI addresses models by deployment name
+	AzureAPIVersion          string
+	AzureDeployment          string
+	AzureEmbeddingDeployment string
+}
+
+// Price is what a model charges in USD per million prompt and completion tokens
+type Price struct {
+	Prompt     float64
+	Completion float64
+}
+
+// defaultBaseURLs holds the API base URL used when LLM_BASE_URL is not set
+var defaultBaseURLs = map[string]string{
+	"openai":    "https://api.openai.com/v1",
+	"anthropic": "https://api.anthropic.com/v1",
+	"ollama":    "http://localhost:11434",
+	"azure":     "",
 }
 
 // NewConfig initializes configuration from environment variables
 func NewConfig() (*Config, error) {
+	provider := strings.ToLower(os.Getenv("LLM_PROVIDER"))
+	if provider == "" {
+		provider = "openai" // Default to OpenAI API
+	}
+	defaultBaseURL, known := defaultBaseURLs[provider]
+	if !known {
+		return nil, fmt.Errorf("unsupported LLM_PROVIDER: %s", provider)
+	}
+
 	baseURL := os.Getenv("LLM_BASE_URL")
 	if baseURL == "" {
-		baseURL = "https://api.openai.com/v1" // Default to OpenAI API
+		baseURL = defaultBaseURL
+	}
+	if baseURL == "" {
+		return nil, fmt.Errorf("LLM_BASE_URL environment variable is required for provider %s", provider)
 	}
 
+	// A local Ollama server does not need an API key
 	apiKey := os.Getenv("LLM_API_KEY")
-	if apiKey == "" {
+	if apiKey == "" && provider != "ollama" {
 		return nil, errors.New("LLM_API_KEY environment variable is required")
 	}
 
@@ -30,15 +126,422 @@ func NewConfig() (*Config, error) {
 		model = "gpt-4o" // Default model
 	}
 
+	llmTimeout, err := getEnvDuration("LLM_TIMEOUT", 2*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	llmMaxRetries, err := getEnvInt("LLM_MAX_RETRIES", 3)
+	if err != nil {
+		return nil, err
+	}
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080" // Default port
 	}
 
-	return &Config{
-		LLMBaseURL: baseURL,
-		LLMAPIKey:  apiKey,
-		LLMModel:   model,
-		Port:       port,
-	}, nil
+	// Authentication is disabled unless a key file is configured
+	authKeyFile := os.Getenv("AUTH_KEY_FILE")
+
+	maxUploadBytes, err := getEnvInt64("MAX_UPLOAD_BYTES", 20<<20) // Default 20 MB
+	if err != nil {
+		return nil, err
+	}
+
+	embeddingModel := os.Getenv("EMBEDDING_MODEL")
+	if embeddingModel == "" {
+		embeddingModel = "text-embedding-3-small" // Default embedding model
+	}
+
+	chunkSize, err := getEnvInt("RAG_CHUNK_SIZE", 1000) // Characters per chunk
+	if err != nil {
+		return nil, err
+	}
+
+	chunkOverlap, err := getEnvInt("RAG_CHUNK_OVERLAP", 200)
+	if err != nil {
+		return nil, err
+	}
+	if chunkOverlap >= chunkSize {
+		return nil, errors.New("RAG_CHUNK_OVERLAP must be smaller than RAG_CHUNK_SIZE")
+	}
+
+	topK, err := getEnvInt("RAG_TOP_K", 5)
+	if err != nil {
+		return nil, err
+	}
+
+	imageMaxDimension, err := getEnvInt("IMAGE_MAX_DIMENSION", 1568)
+	if err != nil {
+		return nil, err
+	}
+
+	imageHistoryTurns, err := getEnvInt("IMAGE_HISTORY_TURNS", 2)
+	if err != nil {
+		return nil, err
+	}
+
+	toolMaxIterations, err := getEnvInt("TOOL_MAX_ITERATIONS", 5)
+	if err != nil {
+		return nil, err
+	}
+
+	// Not every backend accepts tools, so they are only sent when enabled
+	llmTools, err := getEnvBool("LLM_TOOLS", false)
+	if err != nil {
+		return nil, err
+	}
+
+	contextWindows, err := parseModelValues("LLM_CONTEXT_WINDOWS")
+	if err != nil {
+		return nil, err
+	}
+
+	maxCompletionTokens, err := getEnvInt("LLM_MAX_COMPLETION_TOKENS", 4096)
+	if err != nil {
+		return nil, err
+	}
+
+	maxTemperature, err := getEnvFloat("LLM_MAX_TEMPERATURE", 2)
+	if err != nil {
+		return nil, err
+	}
+
+	promptDir := os.Getenv("PROMPT_DIR")
+	if promptDir == "" {
+		promptDir = "prompts"
+	}
+
+	pricing, err := parsePricing("LLM_PRICING")
+	if err != nil {
+		return nil, err
+	}
+
+	defaultContextWindow, err := getEnvInt("LLM_CONTEXT_WINDOW", 16000)
+	if err != nil {
+		return nil, err
+	}
+
+	historyStrategy := os.Getenv("HISTORY_STRATEGY")
+	if historyStrategy == "" {
+		historyStrategy = "truncate" // Drop the oldest turns
+	}
+	if historyStrategy != "truncate" && historyStrategy != "summarize" {
+		return nil, fmt.Errorf("unsupported HISTORY_STRATEGY: %s", historyStrategy)
+	}
+
+	sessionStore := os.Getenv("SESSION_STORE")
+	if sessionStore == "" {
+		sessionStore = "memory" // Sessions are lost on restart
+	}
+
+	sessionDir := os.Getenv("SESSION_DIR")
+	if sessionDir == "" {
+		sessionDir = "data/sessions"
+	}
+
+	sessionTTL, err := getEnvDuration("SESSION_TTL", 24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	janitorInterval, err := getEnvDuration("SESSION_JANITOR_INTERVAL", 5*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	maxSessions, err := getEnvInt("MAX_SESSIONS", 1000)
+	if err != nil {
+		return nil, err
+	}
+
+	maxSessionMessages, err := getEnvInt("MAX_SESSION_MESSAGES", 200)
+	if err != nil {
+		return nil, err
+	}
+
+	maxSessionBytes, err := getEnvInt("MAX_SESSION_BYTES", 1<<20) // Default 1 MB
+	if err != nil {
+		return nil, err
+	}
+
+	maxSessionDocuments, err := getEnvInt("MAX_SESSION_DOCUMENTS", 50)
+	if err != nil {
+		return nil, err
+	}
+
+	maxSessionImages, err := getEnvInt("MAX_SESSION_IMAGES", 100)
+	if err != nil {
+		return nil, err
+	}
+
+	rateLimit, err := getEnvInt("RATE_LIMIT_PER_MINUTE", 60)
+	if err != nil {
+		return nil, err
+	}
+
+	rateLimitBurst, err := getEnvInt("RATE_LIMIT_BURST", 20)
+	if err != nil {
+		return nil, err
+	}
+
+	dailyTokenQuota, err := getEnvInt64("TOKEN_QUOTA_DAILY", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	monthlyTokenQuota, err := getEnvInt64("TOKEN_QUOTA_MONTHLY", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	usageAdmins := parseList("USAGE_ADMINS")
+
+	azureAPIVersion := os.Getenv("AZURE_OPENAI_API_VERSION")
+	if azureAPIVersion == "" {
+		azureAPIVersion = "2024-06-01"
+	}
+
+	azureDeployment := os.Getenv("AZURE_OPENAI_DEPLOYMENT")
+	if azureDeployment == "" {
+		azureDeployment = model // Deployments are commonly named after the model
+	}
+
+	azureEmbeddingDeployment := os.Getenv("AZURE_OPENAI_EMBEDDING_DEPLOYMENT")
+	if azureEmbeddingDeployment == "" {
+		azureEmbeddingDeployment = embeddingModel
+	}
+
+	cfg := &Config{
+		LLMProvider:    provider,
+		LLMBaseURL:     baseURL,
+		LLMAPIKey:      apiKey,
+		LLMModel:       model,
+		LLMTimeout:     llmTimeout,
+		LLMMaxRetries:  llmMaxRetries,
+		Port:           port,
+		AuthKeyFile:    authKeyFile,
+		MaxUploadBytes: maxUploadBytes,
+		EmbeddingModel: embeddingModel,
+		ChunkSize:      chunkSize,
+		ChunkOverlap:   chunkOverlap,
+		RetrievalTopK:  topK,
+
+		ImageMaxDimension: imageMaxDimension,
+		ImageHistoryTurns: imageHistoryTurns,
+
+		ToolMaxIterations: toolMaxIterations,
+		LLMTools:          llmTools,
+
+		ContextWindows:       contextWindows,
+		DefaultContextWindow: defaultContextWindow,
+		HistoryStrategy:      historyStrategy,
+
+		MaxCompletionTokens: maxCompletionTokens,
+		MaxTemperature:      maxTemperature,
+
+		PromptDir: promptDir,
+
+		Pricing: pricing,
+
+		SessionStore: sessionStore,
+		SessionDir:   sessionDir,
+
+		SessionTTL:             sessionTTL,
+		SessionJanitorInterval: janitorInterval,
+		MaxSessions:            maxSessions,
+		MaxSessionMessages:     maxSessionMessages,
+		MaxSessionBytes:        maxSessionBytes,
+		MaxSessionDocuments:    maxSessionDocuments,
+		MaxSessionImages:       maxSessionImages,
+
+		RateLimitPerMinute: rateLimit,
+		RateLimitBurst:     rateLimitBurst,
+		DailyTokenQuota:    dailyTokenQuota,
+		MonthlyTokenQuota:  monthlyTokenQuota,
+
+		UsageAdmins: usageAdmins,
+
+		AzureAPIVersion:          azureAPIVersion,
+		AzureDeployment:          azureDeployment,
+		AzureEmbeddingDeployment: azureEmbeddingDeployment,
+	}
+
+	cfg.Models, err = loadModels(os.Getenv("MODEL_CATALOG_FILE"), cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// ContextWindow returns the context window size in tokens for a model
+func (c *Config) ContextWindow(model string) int {
+	if info, ok := c.Model(model); ok && info.ContextWindow > 0 {
+		return info.ContextWindow
+	}
+	if window, ok := c.ContextWindows[model]; ok {
+		return window
+	}
+	return c.DefaultContextWindow
+}
+
+// Cost returns the price in USD of a request to a model. Models without a
+// configured price are free.
+func (c *Config) Cost(model string, promptTokens, completionTokens int) float64 {
+	price := c.Pricing[model]
+	return (float64(promptTokens)*price.Prompt + float64(completionTokens)*price.Completion) / 1e6
+}
+
+// IsUsageAdmin reports whether a user may read the usage of all clients
+func (c *Config) IsUsageAdmin(user string) bool {
+	for _, admin := range c.UsageAdmins {
+		if user != "" && user == admin {
+			return true
+		}
+	}
+	return false
+}
+
+// parseList reads a comma-separated list of names from an environment variable
+func parseList(key string) []string {
+	var names []string
+	for _, name := range strings.Split(os.Getenv(key), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// parseModelValues reads a comma-separated list of model=number pairs such
+// as "gpt-4o=128000,llama3=8192" from an environment variable
+func parseModelValues(key string) (map[string]int, error) {
+	values := make(map[string]int)
+
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		model, value, found := strings.Cut(pair, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid %s entry: %q", key, pair)
+		}
+
+		parsed, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s entry: %q", key, pair)
+		}
+		values[strings.TrimSpace(model)] = parsed
+	}
+
+	return values, nil
+}
+
+// parsePricing reads a comma-separated list of model=prompt/completion prices
+// in USD per million tokens, such as "gpt-4o=2.50/10.00", from an
+// environment variable
+func parsePricing(key string) (map[string]Price, error) {
+	prices := make(map[string]Price)
+
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		model, value, found := strings.Cut(pair, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid %s entry: %q", key, pair)
+		}
+		prompt, completion, found := strings.Cut(value, "/")
+		if !found {
+			return nil, fmt.Errorf("invalid %s entry: %q", key, pair)
+		}
+
+		promptPrice, err := strconv.ParseFloat(strings.TrimSpace(prompt), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s entry: %q", key, pair)
+		}
+		completionPrice, err := strconv.ParseFloat(strings.TrimSpace(completion), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s entry: %q", key, pair)
+		}
+		prices[strings.TrimSpace(model)] = Price{
+			Prompt:     promptPrice,
+			Completion: completionPrice,
+		}
+	}
+
+	return prices, nil
+}
+
+// getEnvInt64 reads an integer environment variable, falling back to a default
+func getEnvInt64(key string, fallback int64) (int64, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+
+	return parsed, nil
+}
+
+// getEnvInt reads an integer environment variable, falling back to a default
+func getEnvInt(key string, fallback int) (int, error) {
+	value, err := getEnvInt64(key, int64(fallback))
+	return int(value), err
+}
+
+// getEnvFloat reads a floating point environment variable, falling back to a default
+func getEnvFloat(key string, fallback float64) (float64, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+
+	return parsed, nil
+}
+
+// getEnvBool reads a boolean environment variable, falling back to a default
+func getEnvBool(key string, fallback bool) (bool, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %w", key, err)
+	}
+
+	return parsed, nil
+}
+
+// getEnvDuration reads a duration environment variable such as "30m",
+// falling back to a default
+func getEnvDuration(key string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+
+	return parsed, nil
 }
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// ModelInfo describes a model clients may choose
+type ModelInfo struct {
+	Name          string `json:"name"`
+	Provider      string `json:"provider"`
+	ContextWindow int    `json:"contextWindow"`
+	Vision        bool   `json:"vision"`
+	Tools         bool   `json:"tools"`
+
+	// Connection settings for models served by another provider than the
+	// default one; empty values fall back to the global settings
+	BaseURL string `json:"-"`
+	APIKey  string `json:"-"`
+}
+
+// modelEntry is a model as written in the catalog file
+type modelEntry struct {
+	Name          string `json:"name"`
+	Provider      string `json:"provider"`
+	ContextWindow int    `json:"contextWindow"`
+	Vision        bool   `json:"vision"`
+	Tools         *bool  `json:"tools"`
+	BaseURL       string `json:"baseUrl"`
+	APIKeyEnv     string `json:"apiKeyEnv"`
+}
+
+// Model returns the catalog entry of a model
+func (c *Config) Model(name string) (ModelInfo, bool) {
+	for _, model := range c.Models {
+		if model.Name == name {
+			return model, true
+		}
+	}
+	return ModelInfo{}, false
+}
+
+// DefaultBaseURL returns the API base URL of a provider's hosted service
+func DefaultBaseURL(provider string) string {
+	return defaultBaseURLs[provider]
+}
+
+// loadModels reads the model catalog from a JSON file. Without a file the
+// catalog only holds the default model, which is assumed to support images,
+// and to support tool calls only if LLM_TOOLS says so. Catalog models
+// support tool calls unless their entry says otherwise. The default model
+// is always part of the catalog.
+func loadModels(path string, cfg *Config) ([]ModelInfo, error) {
+	var entries []modelEntry
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading model catalog: %w", err)
+		}
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, fmt.Errorf("error parsing model catalog: %w", err)
+		}
+	}
+
+	models := make([]ModelInfo, 0, len(entries)+1)
+	hasDefault := false
+	for _, entry := range entries {
+		if entry.Name == "" {
+			return nil, fmt.Errorf("model catalog entry without a name")
+		}
+		if entry.Provider == "" {
+			entry.Provider = cfg.LLMProvider
+		}
+		if _, known := defaultBaseURLs[entry.Provider]; !known {
+			return nil, fmt.Errorf("unsupported provider %s for model %s", entry.Provider, entry.Name)
+		}
+
+		model := ModelInfo{
+			Name:          entry.Name,
+			Provider:      entry.Provider,
+			ContextWindow: entry.ContextWindow,
+			Vision:        entry.Vision,
+			Tools:         entry.Tools == nil || *entry.Tools,
+			BaseURL:       entry.BaseURL,
+		}
+		if entry.APIKeyEnv != "" {
+			model.APIKey = os.Getenv(entry.APIKeyEnv)
+		}
+		if model.ContextWindow == 0 {
+			model.ContextWindow = cfg.ContextWindow(entry.Name)
+		}
+		if entry.Name == cfg.LLMModel {
+			hasDefault = true
+		}
+		models = append(models, model)
+	}
+
+	if !hasDefault {
+		models = append([]ModelInfo{{
+			Name:          cfg.LLMModel,
+			Provider:      cfg.LLMProvider,
+			ContextWindow: cfg.ContextWindow(cfg.LLMModel),
+			Vision:        true,
+			Tools:         cfg.LLMTools,
+		}}, models...)
+	}
+
+	return models, nil
+}
@@ -0,0 +1,102 @@
+// Package diskstore keeps JSON records as one file each in a directory. It
+// backs the stores that persist sessions and their files across restarts.
+package diskstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Dir is a directory of JSON records keyed by ID
+type Dir struct {
+	path string
+}
+
+// Open returns the records in a directory, creating the directory if needed
+func Open(path string) (*Dir, error) {
+	if err := os.MkdirAll(path, 0o700); err != nil {
+		return nil, fmt.Errorf("error creating directory %s: %w", path, err)
+	}
+
+	return &Dir{path: path}, nil
+}
+
+// Load calls decode with the contents of every record, stopping at the
+// first error
+func (d *Dir) Load(decode func(id string, data []byte) error) error {
+	paths, err := filepath.Glob(filepath.Join(d.path, "*.json"))
+	if err != nil {
+		return fmt.Errorf("error listing %s: %w", d.path, err)
+	}
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", path, err)
+		}
+		if err := decode(strings.TrimSuffix(filepath.Base(path), ".json"), data); err != nil {
+			return fmt.Errorf("error decoding %s: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+// Save writes a record atomically by renaming a temporary file into place
+func (d *Dir) Save(id string, value interface{}) error {
+	path, err := d.file(id)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("error encoding %s: %w", id, err)
+	}
+
+	tmp, err := os.CreateTemp(d.path, ".record-*")
+	if err != nil {
+		return fmt.Errorf("error creating file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error saving file: %w", err)
+	}
+
+	return nil
+}
+
+// Delete removes a record; removing a missing record is not an error
+func (d *Dir) Delete(id string) error {
+	path, err := d.file(id)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error deleting file: %w", err)
+	}
+
+	return nil
+}
+
+// file returns the path of a record, rejecting IDs that would escape the directory
+func (d *Dir) file(id string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || id == "." || id == ".." {
+		return "", fmt.Errorf("invalid id: %q", id)
+	}
+
+	return filepath.Join(d.path, id+".json"), nil
+}
@@ -0,0 +1,205 @@
+package document
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/genterm/backend/internal/diskstore"
+	"github.com/google/uuid"
+)
+
+// Document represents an uploaded file that belongs to a session
+type Document struct {
+	ID        string    `json:"id"`
+	SessionID string    `json:"sessionId"`
+	Name      string    `json:"name"`
+	MimeType  string    `json:"mimeType"`
+	Size      int64     `json:"size"`
+	Content   string    `json:"-"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// storedDocument is the on-disk form of a document, which includes its text
+type storedDocument struct {
+	Document
+	Content string `json:"content"`
+}
+
+// Store holds uploaded documents in memory. A store opened on a directory
+// also writes every document through to it, so documents survive restarts.
+type Store struct {
+	documents map[string]*Document
+	dir       *diskstore.Dir
+	mutex     sync.RWMutex
+}
+
+// NewStore creates a new document store that keeps documents only in memory
+func NewStore() *Store {
+	return &Store{
+		documents: make(map[string]*Document),
+	}
+}
+
+// OpenStore creates a document store backed by a directory and loads the
+// documents stored in it
+func OpenStore(dir string) (*Store, error) {
+	d, err := diskstore.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Store{
+		documents: make(map[string]*Document),
+		dir:       d,
+	}
+	err = d.Load(func(id string, data []byte) error {
+		var stored storedDocument
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return err
+		}
+		doc := stored.Document
+		doc.Content = stored.Content
+		s.documents[doc.ID] = &doc
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// persist writes a document to the directory of the store, if it has one.
+// The caller must hold the write lock.
+func (s *Store) persist(doc *Document) {
+	if s.dir == nil {
+		return
+	}
+	if err := s.dir.Save(doc.ID, storedDocument{Document: *doc, Content: doc.Content}); err != nil {
+		log.Printf("Failed to save document %s: %v", doc.ID, err)
+	}
+}
+
+// remove deletes a document from memory and the directory. The caller must
+// hold the write lock.
+func (s *Store) remove(id string) {
+	delete(s.documents, id)
+	if s.dir == nil {
+		return
+	}
+	if err := s.dir.Delete(id); err != nil {
+		log.Printf("Failed to delete document %s: %v", id, err)
+	}
+}
+
+// Add stores a new document for a session
+func (s *Store) Add(sessionID, name, mimeType, content string, size int64) *Document {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	doc := &Document{
+		ID:        uuid.New().String(),
+		SessionID: sessionID,
+		Name:      name,
+		MimeType:  mimeType,
+		Size:      size,
+		Content:   content,
+		CreatedAt: time.Now(),
+	}
+
+	s.documents[doc.ID] = doc
+	s.persist(doc)
+	return doc
+}
+
+// Copy duplicates a document into another session under a new ID
+func (s *Store) Copy(id, sessionID string) (*Document, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	source, exists := s.documents[id]
+	if !exists {
+		return nil, false
+	}
+
+	doc := *source
+	doc.ID = uuid.New().String()
+	doc.SessionID = sessionID
+	doc.CreatedAt = time.Now()
+
+	s.documents[doc.ID] = &doc
+	s.persist(&doc)
+	return &doc, true
+}
+
+// Get retrieves a document by ID
+func (s *Store) Get(id string) (*Document, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	doc, exists := s.documents[id]
+	return doc, exists
+}
+
+// List returns all documents of a session, oldest first
+func (s *Store) List(sessionID string) []*Document {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var docs []*Document
+	for _, doc := range s.documents {
+		if doc.SessionID == sessionID {
+			docs = append(docs, doc)
+		}
+	}
+
+	sort.Slice(docs, func(i, j int) bool {
+		return docs[i].CreatedAt.Before(docs[j].CreatedAt)
+	})
+
+	return docs
+}
+
+// Delete removes a document by ID
+func (s *Store) Delete(id string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.documents[id]; !exists {
+		return false
+	}
+
+	s.remove(id)
+	return true
+}
+
+// DeleteSession removes every document that belongs to a session
+func (s *Store) DeleteSession(sessionID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for id, doc := range s.documents {
+		if doc.SessionID == sessionID {
+			s.remove(id)
+		}
+	}
+}
+
+// Prune removes every document for which keep returns false and returns
+// their IDs
+func (s *Store) Prune(keep func(*Document) bool) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var removed []string
+	for id, doc := range s.documents {
+		if !keep(doc) {
+			s.remove(id)
+			removed = append(removed, id)
+		}
+	}
+	return removed
+}
@@ -0,0 +1,35 @@
+package extract
+
+import (
+	"fmt"
+	"strings"
+)
+
+// sourceLanguages maps source file extensions to the language name used in
+// the Markdown code fence around their contents
+var sourceLanguages = map[string]string{
+	".go": "go", ".py": "python", ".js": "javascript", ".jsx": "jsx", ".mjs": "javascript",
+	".ts": "typescript", ".tsx": "tsx", ".java": "java", ".kt": "kotlin", ".scala": "scala",
+	".c": "c", ".h": "c", ".cpp": "cpp", ".cc": "cpp", ".hpp": "cpp", ".cs": "csharp",
+	".rb": "ruby", ".rs": "rust", ".php": "php", ".swift": "swift", ".sh": "bash",
+	".bash": "bash", ".sql": "sql", ".css": "css", ".scss": "scss", ".json": "json",
+	".yaml": "yaml", ".yml": "yaml", ".toml": "toml", ".xml": "xml", ".lua": "lua",
+	".r": "r", ".pl": "perl", ".dart": "dart", ".vue": "vue", ".proto": "protobuf",
+}
+
+// Code returns an extractor that wraps source code in a fenced code block
+// so the model keeps its formatting apart from the surrounding context
+func Code(language string) Extractor {
+	return ExtractorFunc(func(data []byte) (string, error) {
+		source, err := Text(data)
+		if err != nil {
+			return "", err
+		}
+		// The fence must be longer than any run of backticks in the code
+		fence := "```"
+		for strings.Contains(source, fence) {
+			fence += "`"
+		}
+		return fmt.Sprintf("%s%s\n%s\n%s", fence, language, source, fence), nil
+	})
+}
@@ -0,0 +1,139 @@
+// Package extract turns uploaded files into plain text for retrieval
+package extract
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxDecompressedBytes caps how much data an extractor inflates from a
+// compressed file, so small archives cannot expand without bound
+const maxDecompressedBytes = 64 << 20
+
+// PageBreak separates the pages of extracted text, for formats that have pages
+const PageBreak = "\f"
+
+// ErrUnsupported is returned for files no extractor can read
+var ErrUnsupported = errors.New("unsupported file type")
+
+// Extractor converts the contents of a file into plain text
+type Extractor interface {
+	Extract(data []byte) (string, error)
+}
+
+// ExtractorFunc adapts a function to the Extractor interface
+type ExtractorFunc func(data []byte) (string, error)
+
+// Extract calls f(data)
+func (f ExtractorFunc) Extract(data []byte) (string, error) {
+	return f(data)
+}
+
+// Registry picks an extractor by file extension or MIME type
+type Registry struct {
+	byType      map[string]Extractor
+	byExtension map[string]Extractor
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		byType:      make(map[string]Extractor),
+		byExtension: make(map[string]Extractor),
+	}
+}
+
+// Default returns a registry with every built-in extractor
+func Default() *Registry {
+	r := NewRegistry()
+	r.Register(ExtractorFunc(Text), []string{"text/plain"}, []string{".txt", ".text", ".log"})
+	r.Register(ExtractorFunc(PDF), []string{"application/pdf"}, []string{".pdf"})
+	r.Register(ExtractorFunc(DOCX), []string{"application/vnd.openxmlformats-officedocument.wordprocessingml.document"}, []string{".docx"})
+	r.Register(ExtractorFunc(ODT), []string{"application/vnd.oasis.opendocument.text"}, []string{".odt"})
+	r.Register(ExtractorFunc(HTML), []string{"text/html", "application/xhtml+xml"}, []string{".html", ".htm", ".xhtml"})
+	r.Register(ExtractorFunc(Markdown), []string{"text/markdown", "text/x-markdown"}, []string{".md", ".markdown"})
+	r.Register(Table(','), []string{"text/csv"}, []string{".csv"})
+	r.Register(Table('\t'), []string{"text/tab-separated-values"}, []string{".tsv", ".tab"})
+	for ext, language := range sourceLanguages {
+		r.Register(Code(language), nil, []string{ext})
+	}
+	return r
+}
+
+// Register adds an extractor for MIME types and file extensions, replacing
+// any extractor registered for them before
+func (r *Registry) Register(e Extractor, mimeTypes, extensions []string) {
+	for _, mimeType := range mimeTypes {
+		r.byType[strings.ToLower(mimeType)] = e
+	}
+	for _, ext := range extensions {
+		r.byExtension[strings.ToLower(ext)] = e
+	}
+}
+
+// Extract returns the text of a file. The extension of name is tried before
+// mimeType since browsers report many source files with generic types.
+// Unknown files are accepted as plain text if they are valid UTF-8.
+func (r *Registry) Extract(name, mimeType string, data []byte) (string, error) {
+	e, ok := r.byExtension[strings.ToLower(filepath.Ext(name))]
+	if !ok {
+		mediaType, _, _ := mime.ParseMediaType(mimeType)
+		e, ok = r.byType[strings.ToLower(mediaType)]
+	}
+	if !ok {
+		e = ExtractorFunc(Text)
+	}
+
+	text, err := e.Extract(data)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	return text, nil
+}
+
+// Text accepts UTF-8 text as it is, without a byte order mark
+func Text(data []byte) (string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(data) {
+		return "", ErrUnsupported
+	}
+	return string(data), nil
+}
+
+// readLimited reads at most maxDecompressedBytes from r
+func readLimited(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxDecompressedBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxDecompressedBytes {
+		return nil, errors.New("decompressed content too large")
+	}
+	return data, nil
+}
+
+// collapseBlankLines trims trailing spaces and squeezes runs of empty lines
+func collapseBlankLines(text string) string {
+	lines := strings.Split(text, "\n")
+	result := make([]string, 0, len(lines))
+	blank := false
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" {
+			if blank || len(result) == 0 {
+				continue
+			}
+			blank = true
+		} else {
+			blank = false
+		}
+		result = append(result, line)
+	}
+	return strings.TrimSpace(strings.Join(result, "\n"))
+}
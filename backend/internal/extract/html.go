@@ -0,0 +1,136 @@
+package extract
+
+import (
+	"html"
+	"strings"
+)
+
+// skippedElements hold no readable text
+var skippedElements = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true,
+	"svg": true, "head": true, "iframe": true, "object": true,
+}
+
+// blockElements start on a new line
+var blockElements = map[string]bool{
+	"p": true, "div": true, "br": true, "hr": true, "section": true, "article": true,
+	"header": true, "footer": true, "nav": true, "aside": true, "main": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"ul": true, "ol": true, "li": true, "dl": true, "dt": true, "dd": true,
+	"table": true, "tr": true, "blockquote": true, "pre": true, "figure": true,
+	"figcaption": true, "form": true, "title": true, "address": true,
+}
+
+// HTML converts an HTML page to text, keeping the line structure of block
+// elements and dropping scripts, styles and markup
+func HTML(data []byte) (string, error) {
+	source, err := Text(data)
+	if err != nil {
+		return "", err
+	}
+
+	var text strings.Builder
+	skipping := ""
+	preDepth := 0
+
+	for len(source) > 0 {
+		open := strings.IndexByte(source, '<')
+		if open < 0 {
+			open = len(source)
+		}
+		if skipping == "" {
+			writeHTMLText(&text, source[:open], preDepth > 0)
+		}
+		source = source[open:]
+		if source == "" {
+			break
+		}
+
+		// Comments and doctype declarations
+		if strings.HasPrefix(source, "<!--") {
+			end := strings.Index(source, "-->")
+			if end < 0 {
+				break
+			}
+			source = source[end+3:]
+			continue
+		}
+
+		end := strings.IndexByte(source, '>')
+		if end < 0 {
+			break
+		}
+		tag := source[1:end]
+		name, closing := tagName(tag)
+		source = source[end+1:]
+
+		if skipping != "" {
+			if closing && name == skipping {
+				skipping = ""
+			}
+			continue
+		}
+		if skippedElements[name] && !closing && !strings.HasSuffix(tag, "/") {
+			skipping = name
+			continue
+		}
+
+		if name == "pre" {
+			if closing && preDepth > 0 {
+				preDepth--
+			} else if !closing {
+				preDepth++
+			}
+		}
+
+		switch {
+		case name == "li" && !closing:
+			text.WriteString("\n- ")
+		case name == "td" || name == "th":
+			if closing {
+				text.WriteString("\t")
+			}
+		case blockElements[name]:
+			text.WriteString("\n")
+		}
+	}
+
+	return collapseBlankLines(text.String()), nil
+}
+
+// writeHTMLText appends the text between tags, collapsing whitespace
+// outside of preformatted blocks
+func writeHTMLText(text *strings.Builder, raw string, preformatted bool) {
+	raw = html.UnescapeString(raw)
+	if preformatted {
+		text.WriteString(raw)
+		return
+	}
+
+	fields := strings.Fields(raw)
+	if len(fields) == 0 {
+		if raw != "" {
+			text.WriteString(" ")
+		}
+		return
+	}
+	if raw[0] == ' ' || raw[0] == '\n' || raw[0] == '\t' {
+		text.WriteString(" ")
+	}
+	text.WriteString(strings.Join(fields, " "))
+	if last := raw[len(raw)-1]; last == ' ' || last == '\n' || last == '\t' {
+		text.WriteString(" ")
+	}
+}
+
+// tagName returns the lower-case name of a tag and whether it closes an element
+func tagName(tag string) (string, bool) {
+	closing := strings.HasPrefix(tag, "/")
+	tag = strings.TrimPrefix(tag, "/")
+
+	end := strings.IndexAny(tag, " \t\r\n/")
+	if end >= 0 {
+		tag = tag[:end]
+	}
+	return strings.ToLower(tag), closing
+}
@@ -0,0 +1,45 @@
+package extract
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// markdownImage matches ![alt](url), which is replaced by its alt text
+	markdownImage = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	// markdownLink matches [text](url), which keeps both text and target
+	markdownLink = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)(?:\s+"[^"]*")?\)`)
+	// htmlComment matches comments, which are not rendered
+	htmlComment = regexp.MustCompile(`(?s)<!--.*?-->`)
+)
+
+// Markdown keeps the structure of a Markdown file, which models read well,
+// but drops front matter, comments and image URLs and inlines link targets
+func Markdown(data []byte) (string, error) {
+	text, err := Text(data)
+	if err != nil {
+		return "", err
+	}
+
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = stripFrontMatter(text)
+	text = htmlComment.ReplaceAllString(text, "")
+	text = markdownImage.ReplaceAllString(text, "$1")
+	text = markdownLink.ReplaceAllString(text, "$1 ($2)")
+
+	return collapseBlankLines(text), nil
+}
+
+// stripFrontMatter removes a leading YAML front matter block
+func stripFrontMatter(text string) string {
+	if !strings.HasPrefix(text, "---\n") {
+		return text
+	}
+	end := strings.Index(text[4:], "\n---")
+	if end < 0 {
+		return text
+	}
+	rest := text[4+end+4:]
+	return strings.TrimPrefix(rest, "\n")
+}
@@ -0,0 +1,167 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// XML namespaces of the elements that carry text in office documents
+const (
+	wordNamespace = "http://schemas.openxmlformats.org/wordprocessingml/2006/main"
+	odfTextNS     = "urn:oasis:names:tc:opendocument:xmlns:text:1.0"
+)
+
+// DOCX extracts the text of a Word document from word/document.xml
+func DOCX(data []byte) (string, error) {
+	content, err := readZipFile(data, "word/document.xml")
+	if err != nil {
+		return "", err
+	}
+
+	var text strings.Builder
+	// Paragraphs inside table cells are joined so a row stays on one line
+	cells := 0
+	err = walkXML(content, func(start *xml.StartElement, end *xml.EndElement, chars string) {
+		switch {
+		case start != nil && start.Name.Space == wordNamespace:
+			switch start.Name.Local {
+			case "tc":
+				cells++
+			case "tab":
+				text.WriteString("\t")
+			case "br", "cr":
+				text.WriteString("\n")
+			}
+		case end != nil && end.Name.Space == wordNamespace:
+			switch end.Name.Local {
+			case "p":
+				if cells > 0 {
+					text.WriteString(" ")
+				} else {
+					text.WriteString("\n")
+				}
+			case "tc":
+				cells--
+				text.WriteString("\t")
+			case "tr":
+				text.WriteString("\n")
+			}
+		case chars != "":
+			text.WriteString(chars)
+		}
+	}, func(name xml.Name) bool {
+		// Only runs of text hold document content; instrText holds field codes
+		return name.Space == wordNamespace && name.Local == "t"
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return collapseBlankLines(text.String()), nil
+}
+
+// ODT extracts the text of an OpenDocument text file from content.xml
+func ODT(data []byte) (string, error) {
+	content, err := readZipFile(data, "content.xml")
+	if err != nil {
+		return "", err
+	}
+
+	var text strings.Builder
+	err = walkXML(content, func(start *xml.StartElement, end *xml.EndElement, chars string) {
+		switch {
+		case start != nil && start.Name.Space == odfTextNS:
+			switch start.Name.Local {
+			case "tab":
+				text.WriteString("\t")
+			case "line-break":
+				text.WriteString("\n")
+			case "s":
+				// Runs of spaces are stored as a count
+				count := 1
+				for _, attr := range start.Attr {
+					if attr.Name.Local == "c" {
+						if n, err := strconv.Atoi(attr.Value); err == nil && n > 0 && n < 1000 {
+							count = n
+						}
+					}
+				}
+				text.WriteString(strings.Repeat(" ", count))
+			}
+		case end != nil && end.Name.Space == odfTextNS:
+			switch end.Name.Local {
+			case "p", "h":
+				text.WriteString("\n")
+			}
+		case chars != "":
+			text.WriteString(chars)
+		}
+	}, func(name xml.Name) bool {
+		return name.Space == odfTextNS && (name.Local == "p" || name.Local == "h" || name.Local == "span" || name.Local == "a")
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return collapseBlankLines(text.String()), nil
+}
+
+// readZipFile returns the contents of one file of a zip archive
+func readZipFile(data []byte, name string) ([]byte, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive: %w", err)
+	}
+
+	for _, file := range archive.File {
+		if file.Name != name {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return readLimited(rc)
+	}
+
+	return nil, fmt.Errorf("archive has no %s", name)
+}
+
+// walkXML calls visit for every start and end element, and for character
+// data directly inside elements for which isText returns true
+func walkXML(data []byte, visit func(start *xml.StartElement, end *xml.EndElement, chars string), isText func(xml.Name) bool) error {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var stack []xml.Name
+
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid XML: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Name)
+			visit(&t, nil, "")
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+			visit(nil, &t, "")
+		case xml.CharData:
+			if len(stack) > 0 && isText(stack[len(stack)-1]) {
+				visit(nil, nil, string(t))
+			}
+		}
+	}
+}
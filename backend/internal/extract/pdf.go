@@ -0,0 +1,936 @@
+package extract
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// maxFormDepth limits how deeply form XObjects may nest
+const maxFormDepth = 8
+
+// formDrawBytes is charged to the decode budget for every form drawn, on
+// top of its data, for the lookups of drawing it; small forms would
+// otherwise cost little of the budget but much time
+const formDrawBytes = 4096
+
+// errPDFTooLarge is returned once the streams of a document decode to more
+// than maxDecompressedBytes
+var errPDFTooLarge = errors.New("decompressed content too large")
+
+// pdfObjectHeader matches the "12 0 obj" header of an indirect object
+var pdfObjectHeader = regexp.MustCompile(`(\d+)\s+\d+\s+obj\b`)
+
+// pdfRef matches an indirect reference such as "12 0 R"
+var pdfRef = regexp.MustCompile(`^(\d+)\s+\d+\s+R`)
+
+// pdfObject is an indirect object: its source text and raw stream data
+type pdfObject struct {
+	body   string
+	stream []byte
+}
+
+// pdfDocument holds the objects of a PDF file
+type pdfDocument struct {
+	objects map[int]*pdfObject
+	cmaps   map[int]*cmap
+
+	// forms caches the decoded data of form XObjects; it is nil for
+	// objects that are not usable forms
+	forms map[int][]byte
+
+	// decoded counts the bytes of stream data decoded so far. Forms are
+	// counted every time they are drawn, so forms drawing each other many
+	// times cannot multiply the work beyond maxDecompressedBytes.
+	decoded int
+}
+
+// PDF extracts the text of a PDF file page by page. It understands Flate
+// compressed streams, object streams and fonts with a ToUnicode map, which
+// covers the files written by common office suites and browsers. Scanned
+// and encrypted files have no extractable text. Pages are separated by
+// PageBreak.
+func PDF(data []byte) (string, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, "\x00\t\r\n "), []byte("%PDF")) {
+		return "", errors.New("not a PDF file")
+	}
+	if bytes.Contains(data, []byte("/Encrypt")) {
+		return "", errors.New("encrypted PDF files are not supported")
+	}
+
+	doc := parsePDF(data)
+
+	// Pages without text are kept so the page numbers stay right
+	var pages []string
+	hasText := false
+	for _, page := range doc.pages() {
+		text := strings.TrimSpace(doc.pageText(page))
+		pages = append(pages, text)
+		hasText = hasText || text != ""
+	}
+	if !hasText {
+		return "", errors.New("PDF has no extractable text")
+	}
+
+	return collapseBlankLines(strings.Join(pages, "\n"+PageBreak+"\n")), nil
+}
+
+// parsePDF reads every indirect object of a file, including objects packed
+// into object streams
+func parsePDF(data []byte) *pdfDocument {
+	doc := &pdfDocument{
+		objects: make(map[int]*pdfObject),
+		cmaps:   make(map[int]*cmap),
+		forms:   make(map[int][]byte),
+	}
+
+	for pos := 0; pos < len(data); {
+		loc := pdfObjectHeader.FindSubmatchIndex(data[pos:])
+		if loc == nil {
+			break
+		}
+		num, _ := strconv.Atoi(string(data[pos+loc[2] : pos+loc[3]]))
+		start := pos + loc[1]
+
+		obj, end := readPDFObject(data, start)
+		// Later revisions of an object replace earlier ones
+		doc.objects[num] = obj
+		pos = end
+	}
+
+	// Objects in object streams have no header of their own
+	for _, obj := range doc.objects {
+		if dictName(obj.body, "Type") != "ObjStm" {
+			continue
+		}
+		content, err := doc.decode(obj)
+		if err != nil {
+			continue
+		}
+		count, _ := strconv.Atoi(doc.value(obj.body, "N"))
+		first, _ := strconv.Atoi(doc.value(obj.body, "First"))
+		if first <= 0 || first > len(content) {
+			continue
+		}
+
+		header := strings.Fields(string(content[:first]))
+		for i := 0; i+1 < len(header) && i/2 < count; i += 2 {
+			num, err1 := strconv.Atoi(header[i])
+			offset, err2 := strconv.Atoi(header[i+1])
+			if err1 != nil || err2 != nil || first+offset >= len(content) {
+				continue
+			}
+			end := len(content)
+			if i+3 < len(header) {
+				if next, err := strconv.Atoi(header[i+3]); err == nil && first+next <= len(content) && next > offset {
+					end = first + next
+				}
+			}
+			if _, exists := doc.objects[num]; !exists {
+				doc.objects[num] = &pdfObject{body: string(content[first+offset : end])}
+			}
+		}
+	}
+
+	return doc
+}
+
+// readPDFObject reads an object body starting after its header and returns
+// the object and the position after it
+func readPDFObject(data []byte, start int) (*pdfObject, int) {
+	streamAt := bytes.Index(data[start:], []byte("stream"))
+	endAt := bytes.Index(data[start:], []byte("endobj"))
+	if endAt < 0 {
+		endAt = len(data) - start
+	}
+
+	if streamAt < 0 || streamAt > endAt {
+		return &pdfObject{body: string(data[start : start+endAt])}, start + endAt
+	}
+
+	obj := &pdfObject{body: string(data[start : start+streamAt])}
+	begin := start + streamAt + len("stream")
+	if begin < len(data) && data[begin] == '\r' {
+		begin++
+	}
+	if begin < len(data) && data[begin] == '\n' {
+		begin++
+	}
+
+	// Trust a direct /Length when it points at the end of the stream
+	end := -1
+	if length, err := strconv.Atoi(dictValue(obj.body, "Length")); err == nil && length >= 0 && begin+length <= len(data) {
+		rest := bytes.TrimLeft(data[begin+length:], "\r\n ")
+		if bytes.HasPrefix(rest, []byte("endstream")) {
+			end = begin + length
+		}
+	}
+	if end < 0 {
+		idx := bytes.Index(data[begin:], []byte("endstream"))
+		if idx < 0 {
+			return obj, len(data)
+		}
+		end = begin + idx
+	}
+	obj.stream = data[begin:end]
+
+	next := end
+	if idx := bytes.Index(data[end:], []byte("endobj")); idx >= 0 {
+		next = end + idx + len("endobj")
+	}
+	return obj, next
+}
+
+// decode returns the decoded data of a stream object. It fails once the
+// document has decoded too much data.
+func (d *pdfDocument) decode(obj *pdfObject) ([]byte, error) {
+	filter := d.value(obj.body, "Filter")
+	filter = strings.Trim(filter, "[] \t\r\n")
+
+	var data []byte
+	switch filter {
+	case "":
+		data = obj.stream
+	case "/FlateDecode", "/Fl":
+		r, err := zlib.NewReader(bytes.NewReader(obj.stream))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		data, err = readLimited(r)
+		if err != nil && len(data) == 0 {
+			return nil, err
+		}
+		// Truncated streams still yield the text decoded so far
+	default:
+		return nil, errors.New("unsupported filter " + filter)
+	}
+
+	if err := d.charge(len(data)); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// charge counts decoded bytes against the budget of the document
+func (d *pdfDocument) charge(n int) error {
+	if d.decoded+n > maxDecompressedBytes {
+		d.decoded = maxDecompressedBytes
+		return errPDFTooLarge
+	}
+	d.decoded += n
+	return nil
+}
+
+// value returns a dictionary entry, following an indirect reference to a
+// number or name
+func (d *pdfDocument) value(dict, key string) string {
+	v := dictValue(dict, key)
+	if num, ok := refNumber(v); ok {
+		if obj, exists := d.objects[num]; exists {
+			return strings.TrimSpace(obj.body)
+		}
+	}
+	return v
+}
+
+// resolve returns the body of a referenced object, or the value itself for
+// direct objects
+func (d *pdfDocument) resolve(value string) (string, *pdfObject) {
+	if num, ok := refNumber(value); ok {
+		if obj, exists := d.objects[num]; exists {
+			return obj.body, obj
+		}
+		return "", nil
+	}
+	return value, nil
+}
+
+// pages returns the page objects in document order. Files with a broken
+// page tree fall back to object order.
+func (d *pdfDocument) pages() []*pdfObject {
+	var pages []*pdfObject
+	visited := make(map[int]bool)
+
+	var walk func(value string, depth int)
+	walk = func(value string, depth int) {
+		num, ok := refNumber(value)
+		if !ok || visited[num] || depth > 64 {
+			return
+		}
+		visited[num] = true
+		obj, exists := d.objects[num]
+		if !exists {
+			return
+		}
+
+		switch dictName(obj.body, "Type") {
+		case "Page":
+			pages = append(pages, obj)
+		case "Pages":
+			kids, _ := d.resolve(dictValue(obj.body, "Kids"))
+			for _, kid := range refList(kids) {
+				walk(kid, depth+1)
+			}
+		}
+	}
+
+	nums := make([]int, 0, len(d.objects))
+	for num := range d.objects {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+
+	for _, num := range nums {
+		if dictName(d.objects[num].body, "Type") == "Catalog" {
+			walk(dictValue(d.objects[num].body, "Pages"), 0)
+			break
+		}
+	}
+	if len(pages) > 0 {
+		return pages
+	}
+
+	for _, num := range nums {
+		if dictName(d.objects[num].body, "Type") == "Page" {
+			pages = append(pages, d.objects[num])
+		}
+	}
+	return pages
+}
+
+// pageText returns the text shown by the content streams of a page
+func (d *pdfDocument) pageText(page *pdfObject) string {
+	contents, obj := d.resolve(dictValue(page.body, "Contents"))
+
+	var stream []byte
+	if obj != nil && obj.stream != nil {
+		stream, _ = d.decode(obj)
+	} else {
+		// An array of content streams forms one stream
+		for _, ref := range refList(contents) {
+			if _, part := d.resolve(ref); part != nil && part.stream != nil {
+				data, err := d.decode(part)
+				if err == nil {
+					stream = append(append(stream, data...), '\n')
+				}
+			}
+		}
+	}
+
+	resources := d.resources(page.body)
+	var text strings.Builder
+	d.showText(&text, stream, resources, 0)
+	return text.String()
+}
+
+// resources returns the resource dictionary of a page or form, looking up
+// the page tree for inherited resources
+func (d *pdfDocument) resources(body string) string {
+	for depth := 0; depth < 64; depth++ {
+		if value := dictValue(body, "Resources"); value != "" {
+			resources, _ := d.resolve(value)
+			return resources
+		}
+		parent, _ := d.resolve(dictValue(body, "Parent"))
+		if parent == "" {
+			return ""
+		}
+		body = parent
+	}
+	return ""
+}
+
+// fontMap returns the ToUnicode map of a font resource, or nil if the font
+// has none
+func (d *pdfDocument) fontMap(resources, name string) *cmap {
+	fonts, _ := d.resolve(dictValue(resources, "Font"))
+	ref := dictValue(fonts, name)
+	num, ok := refNumber(ref)
+	if !ok {
+		return nil
+	}
+	if m, cached := d.cmaps[num]; cached {
+		return m
+	}
+
+	var m *cmap
+	if font, exists := d.objects[num]; exists {
+		if _, obj := d.resolve(dictValue(font.body, "ToUnicode")); obj != nil && obj.stream != nil {
+			if data, err := d.decode(obj); err == nil {
+				m = parseCMap(data)
+			}
+		}
+	}
+	d.cmaps[num] = m
+	return m
+}
+
+// pdfToken is an operand of a content stream operator
+type pdfToken struct {
+	kind  byte // 'n' number, 's' string, '/' name, '[' array
+	num   float64
+	str   []byte
+	name  string
+	array []pdfToken
+}
+
+// showText interprets a content stream and writes the text it shows
+func (d *pdfDocument) showText(text *strings.Builder, stream []byte, resources string, depth int) {
+	var font *cmap
+	var operands []pdfToken
+	var arrays [][]pdfToken
+	lastY := math.NaN()
+
+	newline := func() {
+		if text.Len() > 0 && !strings.HasSuffix(text.String(), "\n") {
+			text.WriteString("\n")
+		}
+	}
+	space := func() {
+		s := text.String()
+		if len(s) > 0 && !strings.HasSuffix(s, " ") && !strings.HasSuffix(s, "\n") {
+			text.WriteString(" ")
+		}
+	}
+	push := func(t pdfToken) {
+		if len(arrays) > 0 {
+			arrays[len(arrays)-1] = append(arrays[len(arrays)-1], t)
+		} else {
+			operands = append(operands, t)
+		}
+	}
+	number := func(i int) float64 {
+		if i < len(operands) && operands[i].kind == 'n' {
+			return operands[i].num
+		}
+		return 0
+	}
+
+	lex := &pdfLexer{data: stream}
+	for {
+		kind, raw, ok := lex.next()
+		if !ok {
+			break
+		}
+
+		switch kind {
+		case 'n':
+			num, _ := strconv.ParseFloat(raw, 64)
+			push(pdfToken{kind: 'n', num: num})
+			continue
+		case 's':
+			push(pdfToken{kind: 's', str: []byte(raw)})
+			continue
+		case '/':
+			push(pdfToken{kind: '/', name: raw})
+			continue
+		case '[':
+			arrays = append(arrays, nil)
+			continue
+		case ']':
+			if len(arrays) > 0 {
+				array := arrays[len(arrays)-1]
+				arrays = arrays[:len(arrays)-1]
+				push(pdfToken{kind: '[', array: array})
+			}
+			continue
+		case '<':
+			// Dictionaries only appear as operands of marked content
+			continue
+		}
+
+		switch raw {
+		case "BT":
+			lastY = math.NaN()
+		case "ET":
+			newline()
+		case "Tf":
+			if len(operands) > 0 && operands[0].kind == '/' {
+				font = d.fontMap(resources, operands[0].name)
+			}
+		case "Td", "TD":
+			if ty := number(1); ty != 0 {
+				newline()
+			} else if tx := number(0); tx > 0 {
+				space()
+			}
+		case "Tm":
+			if y := number(5); !math.IsNaN(lastY) && y != lastY {
+				newline()
+			} else {
+				space()
+			}
+			lastY = number(5)
+		case "T*":
+			newline()
+		case "Tj":
+			if len(operands) > 0 {
+				text.WriteString(font.decode(operands[len(operands)-1].str))
+			}
+		case "'", "\"":
+			newline()
+			if len(operands) > 0 {
+				text.WriteString(font.decode(operands[len(operands)-1].str))
+			}
+		case "TJ":
+			if len(operands) == 0 {
+				break
+			}
+			for _, item := range operands[len(operands)-1].array {
+				switch {
+				case item.kind == 's':
+					text.WriteString(font.decode(item.str))
+				case item.kind == 'n' && item.num < -200:
+					// Large negative adjustments separate words
+					space()
+				}
+			}
+		case "Do":
+			if depth < maxFormDepth && len(operands) > 0 && operands[0].kind == '/' {
+				d.showForm(text, resources, operands[0].name, depth)
+			}
+		case "ID":
+			lex.skipInlineImage()
+		}
+		operands = operands[:0]
+	}
+}
+
+// showForm writes the text of a form XObject drawn by the Do operator.
+// Forms are decoded once, but count against the document's budget every
+// time they are drawn.
+func (d *pdfDocument) showForm(text *strings.Builder, resources, name string, depth int) {
+	xobjects, _ := d.resolve(dictValue(resources, "XObject"))
+	num, ok := refNumber(dictValue(xobjects, name))
+	if !ok {
+		return
+	}
+	obj, exists := d.objects[num]
+	if !exists {
+		return
+	}
+
+	data, cached := d.forms[num]
+	if !cached {
+		if obj.stream != nil && dictName(obj.body, "Subtype") == "Form" {
+			data, _ = d.decode(obj)
+		}
+		d.forms[num] = data
+	}
+	// The first draw of a form was charged for its data by decode
+	if data == nil || d.charge(formDrawBytes) != nil || (cached && d.charge(len(data)) != nil) {
+		return
+	}
+
+	formResources := resources
+	if value := dictValue(obj.body, "Resources"); value != "" {
+		formResources, _ = d.resolve(value)
+	}
+	d.showText(text, data, formResources, depth+1)
+}
+
+// pdfLexer splits a content stream into tokens
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+// next returns the kind and text of the next token: 'n' number, 's'
+// string, '/' name, '[' or ']' array delimiters, '<' dictionary delimiters
+// and 'o' for operators
+func (l *pdfLexer) next() (byte, string, bool) {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		switch {
+		case isPDFSpace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		case c == '(':
+			return 's', l.literal(), true
+		case c == '<':
+			if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+				l.pos += 2
+				return '<', "<<", true
+			}
+			return 's', l.hex(), true
+		case c == '>':
+			l.pos++
+			if l.pos < len(l.data) && l.data[l.pos] == '>' {
+				l.pos++
+			}
+			return '<', ">>", true
+		case c == '[' || c == ']':
+			l.pos++
+			return c, string(c), true
+		case c == '{' || c == '}':
+			l.pos++
+		case c == '/':
+			l.pos++
+			return '/', l.word(), true
+		case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+			return 'n', l.word(), true
+		default:
+			word := l.word()
+			if word == "" {
+				l.pos++
+				continue
+			}
+			return 'o', word, true
+		}
+	}
+	return 0, "", false
+}
+
+// word reads characters up to the next delimiter
+func (l *pdfLexer) word() string {
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	return string(l.data[start:l.pos])
+}
+
+// literal reads a (string) with nested parentheses and escapes
+func (l *pdfLexer) literal() string {
+	l.pos++ // opening parenthesis
+	var out []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return string(out)
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return string(out)
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					value := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						value = value*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(value)
+				} else {
+					c = e
+				}
+			}
+		}
+		out = append(out, c)
+	}
+	return string(out)
+}
+
+// hex reads a <hex string>
+func (l *pdfLexer) hex() string {
+	l.pos++ // opening bracket
+	var digits []byte
+	for l.pos < len(l.data) && l.data[l.pos] != '>' {
+		if c := l.data[l.pos]; isHexDigit(c) {
+			digits = append(digits, c)
+		}
+		l.pos++
+	}
+	l.pos++ // closing bracket
+	return string(hexBytes(string(digits)))
+}
+
+// skipInlineImage skips the binary data of an inline image up to EI
+func (l *pdfLexer) skipInlineImage() {
+	for l.pos+2 < len(l.data) {
+		if l.data[l.pos] == 'E' && l.data[l.pos+1] == 'I' && isPDFSpace(l.data[l.pos-1]) &&
+			(l.pos+2 == len(l.data) || isPDFSpace(l.data[l.pos+2])) {
+			l.pos += 2
+			return
+		}
+		l.pos++
+	}
+	l.pos = len(l.data)
+}
+
+// cmap maps character codes of a font to Unicode text
+type cmap struct {
+	width int // bytes per character code
+	codes map[uint32]string
+}
+
+// parseCMap reads the bfchar and bfrange mappings of a ToUnicode CMap
+func parseCMap(data []byte) *cmap {
+	m := &cmap{width: 1, codes: make(map[uint32]string)}
+	lex := &pdfLexer{data: data}
+
+	var operands []string
+	var inChar, inRange bool
+	var array []string
+	inArray := false
+
+	for {
+		kind, raw, ok := lex.next()
+		if !ok {
+			break
+		}
+
+		switch {
+		case kind == 's' && inArray:
+			array = append(array, raw)
+			continue
+		case kind == 's':
+			operands = append(operands, raw)
+		case kind == '[':
+			inArray = true
+			array = nil
+			continue
+		case kind == ']':
+			inArray = false
+		case kind == 'o':
+			switch raw {
+			case "beginbfchar":
+				inChar = true
+			case "endbfchar":
+				inChar = false
+			case "beginbfrange":
+				inRange = true
+			case "endbfrange":
+				inRange = false
+			}
+			operands = operands[:0]
+			continue
+		default:
+			continue
+		}
+
+		switch {
+		case inChar && len(operands) == 2:
+			m.set(operands[0], decodeUTF16(operands[1]))
+			operands = operands[:0]
+		case inRange && len(operands) == 3:
+			lo, hi := codeValue(operands[0]), codeValue(operands[1])
+			dst := []rune(decodeUTF16(operands[2]))
+			for code := lo; code <= hi && code-lo < 65536 && len(dst) > 0; code++ {
+				last := dst[len(dst)-1] + rune(code-lo)
+				m.setCode(len(operands[0]), code, string(append(append([]rune{}, dst[:len(dst)-1]...), last)))
+			}
+			operands = operands[:0]
+		case inRange && len(operands) == 2 && kind == ']':
+			lo := codeValue(operands[0])
+			for i, dst := range array {
+				m.setCode(len(operands[0]), lo+uint32(i), decodeUTF16(dst))
+			}
+			operands = operands[:0]
+		}
+	}
+
+	return m
+}
+
+// set maps the code given as raw bytes to text
+func (m *cmap) set(code, text string) {
+	m.setCode(len(code), codeValue(code), text)
+}
+
+// setCode maps a code of a given byte width to text
+func (m *cmap) setCode(width int, code uint32, text string) {
+	if width > m.width && width <= 4 {
+		m.width = width
+	}
+	m.codes[code] = text
+}
+
+// decode converts the bytes of a shown string into text. Without a map the
+// bytes are read as Latin-1, which matches the standard encodings for ASCII.
+func (m *cmap) decode(data []byte) string {
+	if m == nil || len(m.codes) == 0 {
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return string(runes)
+	}
+
+	var out strings.Builder
+	for i := 0; i+m.width <= len(data); i += m.width {
+		code := codeValue(string(data[i : i+m.width]))
+		if text, ok := m.codes[code]; ok {
+			out.WriteString(text)
+		}
+	}
+	return out.String()
+}
+
+// codeValue returns the big-endian value of a character code
+func codeValue(code string) uint32 {
+	var value uint32
+	for i := 0; i < len(code) && i < 4; i++ {
+		value = value<<8 | uint32(code[i])
+	}
+	return value
+}
+
+// decodeUTF16 converts big-endian UTF-16 bytes to text
+func decodeUTF16(data string) string {
+	units := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		units = append(units, uint16(data[i])<<8|uint16(data[i+1]))
+	}
+	return string(utf16.Decode(units))
+}
+
+// dictValue returns the raw value of a key in a dictionary: a reference,
+// name, number, string, array or nested dictionary
+func dictValue(dict, key string) string {
+	needle := "/" + key
+	for from := 0; ; {
+		idx := strings.Index(dict[from:], needle)
+		if idx < 0 {
+			return ""
+		}
+		start := from + idx + len(needle)
+		from = start
+		if start < len(dict) && !isPDFSpace(dict[start]) && !isPDFDelimiter(dict[start]) {
+			continue // longer key with the same prefix
+		}
+
+		rest := strings.TrimLeft(dict[start:], " \t\r\n")
+		if rest == "" {
+			return ""
+		}
+		if loc := pdfRef.FindStringIndex(rest); loc != nil {
+			return rest[:loc[1]]
+		}
+
+		switch {
+		case strings.HasPrefix(rest, "<<"):
+			return balanced(rest, "<<", ">>")
+		case rest[0] == '[':
+			return balanced(rest, "[", "]")
+		case rest[0] == '(':
+			return balanced(rest, "(", ")")
+		case rest[0] == '/':
+			end := 1
+			for end < len(rest) && !isPDFSpace(rest[end]) && !isPDFDelimiter(rest[end]) {
+				end++
+			}
+			return rest[:end]
+		default:
+			end := 0
+			for end < len(rest) && !isPDFSpace(rest[end]) && !isPDFDelimiter(rest[end]) {
+				end++
+			}
+			return rest[:end]
+		}
+	}
+}
+
+// dictName returns the value of a name entry without its slash
+func dictName(dict, key string) string {
+	return strings.TrimPrefix(dictValue(dict, key), "/")
+}
+
+// balanced returns the prefix of s up to the delimiter closing its first one
+func balanced(s, open, close string) string {
+	depth := 0
+	for i := 0; i < len(s); {
+		switch {
+		case strings.HasPrefix(s[i:], open):
+			depth++
+			i += len(open)
+		case strings.HasPrefix(s[i:], close):
+			depth--
+			i += len(close)
+			if depth == 0 {
+				return s[:i]
+			}
+		default:
+			i++
+		}
+	}
+	return s
+}
+
+// refNumber returns the object number of an indirect reference
+func refNumber(value string) (int, bool) {
+	match := pdfRef.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return 0, false
+	}
+	num, err := strconv.Atoi(match[1])
+	return num, err == nil
+}
+
+// refList returns the references in an array such as "[3 0 R 4 0 R]"
+func refList(array string) []string {
+	fields := strings.Fields(strings.Trim(array, "[]"))
+	var refs []string
+	for i := 0; i+2 < len(fields); i++ {
+		if fields[i+2] == "R" {
+			refs = append(refs, strings.Join(fields[i:i+3], " "))
+			i += 2
+		}
+	}
+	return refs
+}
+
+// hexBytes decodes hex digits, padding an odd final digit with zero
+func hexBytes(digits string) []byte {
+	if len(digits)%2 == 1 {
+		digits += "0"
+	}
+	out := make([]byte, len(digits)/2)
+	for i := range out {
+		v, _ := strconv.ParseUint(digits[2*i:2*i+2], 16, 8)
+		out[i] = byte(v)
+	}
+	return out
+}
+
+// isPDFSpace reports whether c is PDF whitespace
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == 0
+}
+
+// isPDFDelimiter reports whether c ends a name or number
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+// isHexDigit reports whether c is a hexadecimal digit
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
@@ -0,0 +1,225 @@
+package extract
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pdfFile builds a PDF file from the bodies of objects 1, 2, ... A body
+// may end in a stream given separately; streams get their /Length added.
+type pdfFile struct {
+	objects []string
+}
+
+// add appends an object and returns its number
+func (f *pdfFile) add(body string) int {
+	f.objects = append(f.objects, body)
+	return len(f.objects)
+}
+
+// addStream appends a stream object with the entries of dict
+func (f *pdfFile) addStream(dict string, data []byte) int {
+	return f.add(fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data))
+}
+
+// bytes returns the file
+func (f *pdfFile) bytes() []byte {
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.5\n")
+	for i, body := range f.objects {
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, body)
+	}
+	out.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return out.Bytes()
+}
+
+// flate compresses data with zlib, as the FlateDecode filter expects
+func flate(data string) []byte {
+	var out bytes.Buffer
+	w := zlib.NewWriter(&out)
+	w.Write([]byte(data))
+	w.Close()
+	return out.Bytes()
+}
+
+// onePage builds a file whose only page shows a content stream, with a
+// font F1 and the given XObject resources
+func onePage(content func(f *pdfFile) int, xobjects string) []byte {
+	f := &pdfFile{}
+	f.add("<< /Type /Catalog /Pages 2 0 R >>")
+	f.add("<< /Type /Pages /Kids [3 0 R] /Count 1 >>")
+	f.add("") // the page, once its content exists
+	f.add("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>")
+	contents := content(f)
+	f.objects[2] = fmt.Sprintf("<< /Type /Page /Parent 2 0 R /Resources << /Font << /F1 4 0 R >> /XObject << %s >> >> /Contents %d 0 R >>", xobjects, contents)
+	return f.bytes()
+}
+
+func TestPDF(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{
+			name: "uncompressed",
+			data: onePage(func(f *pdfFile) int {
+				return f.addStream("", []byte("BT /F1 12 Tf 72 700 Td (Hello, World) Tj 0 -14 Td (Second line) Tj ET"))
+			}, ""),
+			want: "Hello, World\nSecond line",
+		},
+		{
+			name: "flate",
+			data: onePage(func(f *pdfFile) int {
+				return f.addStream("/Filter /FlateDecode", flate("BT /F1 12 Tf 72 700 Td (Compressed text) Tj ET"))
+			}, ""),
+			want: "Compressed text",
+		},
+		{
+			name: "TJ spacing",
+			data: onePage(func(f *pdfFile) int {
+				return f.addStream("", []byte("BT /F1 12 Tf [(Ke) 30 (rning) -250 (keeps) -600 (words)] TJ ET"))
+			}, ""),
+			want: "Kerning keeps words",
+		},
+		{
+			name: "escapes and hex strings",
+			data: onePage(func(f *pdfFile) int {
+				return f.addStream("", []byte(`BT /F1 12 Tf (a \(b\) \101) Tj ( ) Tj <43 44> Tj ET`))
+			}, ""),
+			want: "a (b) A CD",
+		},
+		{
+			name: "form",
+			data: onePage(func(f *pdfFile) int {
+				f.addStream("/Type /XObject /Subtype /Form", []byte("BT /F1 12 Tf (From a form) Tj ET"))
+				return f.addStream("", []byte("q /X1 Do Q"))
+			}, "/X1 5 0 R"),
+			want: "From a form",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PDF(tt.data)
+			if err != nil {
+				t.Fatalf("PDF: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("PDF = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPDFObjectStream(t *testing.T) {
+	// The catalog, page tree and page are packed into a compressed object
+	// stream, as PDF 1.5 writers do
+	packed := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 5 0 R >>",
+	}
+	var header, bodies strings.Builder
+	for i, body := range packed {
+		fmt.Fprintf(&header, "%d %d ", i+1, bodies.Len())
+		bodies.WriteString(body + "\n")
+	}
+	content := header.String() + bodies.String()
+
+	f := &pdfFile{objects: make([]string, 3)}
+	f.addStream(fmt.Sprintf("/Type /ObjStm /N %d /First %d /Filter /FlateDecode", len(packed), header.Len()), flate(content))
+	f.addStream("", []byte("BT (Packed page) Tj ET"))
+	// Objects 1 to 3 only exist inside the object stream
+	var data bytes.Buffer
+	data.WriteString("%PDF-1.5\n")
+	for i, body := range f.objects[3:] {
+		fmt.Fprintf(&data, "%d 0 obj\n%s\nendobj\n", i+4, body)
+	}
+
+	got, err := PDF(data.Bytes())
+	if err != nil {
+		t.Fatalf("PDF: %v", err)
+	}
+	if got != "Packed page" {
+		t.Errorf("PDF = %q, want %q", got, "Packed page")
+	}
+}
+
+func TestPDFPages(t *testing.T) {
+	f := &pdfFile{}
+	f.add("<< /Type /Catalog /Pages 2 0 R >>")
+	f.add("<< /Type /Pages /Kids [4 0 R 3 0 R] /Count 2 >>")
+	f.add("<< /Type /Page /Parent 2 0 R /Contents 5 0 R >>")
+	f.add("<< /Type /Page /Parent 2 0 R /Contents 6 0 R >>")
+	f.addStream("", []byte("BT (Second) Tj ET"))
+	f.addStream("", []byte("BT (First) Tj ET"))
+
+	got, err := PDF(f.bytes())
+	if err != nil {
+		t.Fatalf("PDF: %v", err)
+	}
+	if want := "First\n" + PageBreak + "\nSecond"; got != want {
+		t.Errorf("PDF = %q, want %q", got, want)
+	}
+}
+
+func TestPDFSelfReferencingForm(t *testing.T) {
+	tests := []struct {
+		name string
+		form string
+	}{
+		{"draws itself", "BT (Loop) Tj ET /X Do"},
+		// Without a budget, drawing itself ten times at each of the nested
+		// levels would show the text about 10^8 times
+		{"draws itself repeatedly", "BT (Loop) Tj ET" + strings.Repeat(" /X Do", 10)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := onePage(func(f *pdfFile) int {
+				f.addStream("/Type /XObject /Subtype /Form /Resources << /XObject << /X 5 0 R >> >>", []byte(tt.form))
+				return f.addStream("", []byte("/X Do"))
+			}, "/X 5 0 R")
+
+			start := time.Now()
+			got, err := PDF(data)
+			if err != nil {
+				t.Fatalf("PDF: %v", err)
+			}
+			if !strings.HasPrefix(got, "Loop") {
+				t.Errorf("PDF = %.40q..., want the text of the form", got)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("PDF took %v", elapsed)
+			}
+		})
+	}
+}
+
+func TestPDFErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"not a PDF", []byte("hello"), "not a PDF file"},
+		{"encrypted", []byte("%PDF-1.4\n1 0 obj\n<< /Encrypt 2 0 R >>\nendobj\n"), "encrypted"},
+		{"no text", onePage(func(f *pdfFile) int {
+			return f.addStream("", []byte("0 0 m 100 100 l S"))
+		}, ""), "no extractable text"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := PDF(tt.data)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("PDF = %v, want error containing %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package extract
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// maxCellWidth truncates long cells so one column cannot stretch the table
+const maxCellWidth = 80
+
+// Table returns an extractor for delimited files such as CSV (',') and TSV
+// ('\t'). Rows are rendered as an aligned table with | separated columns.
+func Table(delimiter rune) Extractor {
+	return ExtractorFunc(func(data []byte) (string, error) {
+		source, err := Text(data)
+		if err != nil {
+			return "", err
+		}
+
+		reader := csv.NewReader(strings.NewReader(source))
+		reader.Comma = delimiter
+		reader.FieldsPerRecord = -1
+		reader.LazyQuotes = true
+
+		var out bytes.Buffer
+		writer := tabwriter.NewWriter(&out, 0, 0, 1, ' ', tabwriter.Debug)
+		for row := 0; ; row++ {
+			record, err := reader.Read()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return "", fmt.Errorf("invalid table: %w", err)
+			}
+
+			for i, cell := range record {
+				record[i] = tableCell(cell)
+			}
+			fmt.Fprintln(writer, strings.Join(record, "\t")+"\t")
+		}
+		if err := writer.Flush(); err != nil {
+			return "", err
+		}
+
+		return strings.TrimRight(out.String(), "\n"), nil
+	})
+}
+
+// tableCell flattens a cell to a single line of bounded width
+func tableCell(cell string) string {
+	cell = strings.Join(strings.Fields(cell), " ")
+	if runes := []rune(cell); len(runes) > maxCellWidth {
+		cell = string(runes[:maxCellWidth-1]) + "…"
+	}
+	return cell
+}
@@ -0,0 +1,350 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/genterm/backend/internal/config"
+)
+
+// anthropicVersion is the Messages API version sent with every request
+const anthropicVersion = "2023-06-01"
+
+// ErrEmbeddingsUnsupported is returned by providers without an embeddings API
+var ErrEmbeddingsUnsupported = errors.New("provider does not support embeddings")
+
+// anthropicProvider speaks the Anthropic Messages API
+type anthropicProvider struct {
+	transport *transport
+	headers   map[string]string
+	url       string
+}
+
+// anthropicRequest represents a Messages API request
+type anthropicRequest struct {
+	Model         string             `json:"model"`
+	System        string             `json:"system,omitempty"`
+	Messages      []anthropicMessage `json:"messages"`
+	MaxTokens     int                `json:"max_tokens"`
+	Temperature   *float64           `json:"temperature,omitempty"`
+	TopP          *float64           `json:"top_p,omitempty"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+	Tools         []anthropicTool    `json:"tools,omitempty"`
+	ToolChoice    *anthropicChoice   `json:"tool_choice,omitempty"`
+	Stream        bool               `json:"stream,omitempty"`
+}
+
+// anthropicTool represents a tool definition of the Messages API
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+// anthropicChoice tells the model whether it may call tools
+type anthropicChoice struct {
+	Type string `json:"type"`
+}
+
+// anthropicMessage represents a single Messages API turn
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+// anthropicBlock represents a content block of a message
+type anthropicBlock struct {
+	Type   string           `json:"type"`
+	Text   string           `json:"text,omitempty"`
+	Source *anthropicSource `json:"source,omitempty"`
+
+	// Set on tool_use blocks
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	// Set on tool_result blocks
+	ToolUseID string `json:"tool_use_id,omitempty"`
+	Content   string `json:"content,omitempty"`
+}
+
+// anthropicSource represents the source of an image block
+type anthropicSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+// anthropicResponse represents a Messages API response
+type anthropicResponse struct {
+	ID         string           `json:"id"`
+	Content    []anthropicBlock `json:"content"`
+	StopReason string           `json:"stop_reason"`
+	Usage      anthropicUsage   `json:"usage"`
+}
+
+// anthropicUsage represents the token counts of a Messages API response
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// anthropicStreamEvent represents the data of a Messages API stream event
+type anthropicStreamEvent struct {
+	Type         string            `json:"type"`
+	Message      anthropicResponse `json:"message"`
+	Usage        anthropicUsage    `json:"usage"`
+	Index        int               `json:"index"`
+	ContentBlock anthropicBlock    `json:"content_block"`
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// newAnthropicProvider creates a provider for the Anthropic Messages API
+func newAnthropicProvider(cfg *config.Config, t *transport) *anthropicProvider {
+	return &anthropicProvider{
+		transport: t,
+		headers: map[string]string{
+			"x-api-key":         cfg.LLMAPIKey,
+			"anthropic-version": anthropicVersion,
+		},
+		url: fmt.Sprintf("%s/messages", strings.TrimSuffix(cfg.LLMBaseURL, "/")),
+	}
+}
+
+// Complete sends a Messages API request
+func (p *anthropicProvider) Complete(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	resp, err := p.transport.post(ctx, p.url, p.headers, toAnthropicRequest(req, false))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var anthropicResp anthropicResponse
+	if err := json.NewDecoder(resp.Body).Decode(&anthropicResp); err != nil {
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	}
+
+	var text strings.Builder
+	var toolCalls []ToolCall
+	for _, block := range anthropicResp.Content {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+		case "tool_use":
+			toolCalls = append(toolCalls, ToolCall{
+				ID:   block.ID,
+				Type: "function",
+				Function: FunctionCall{
+					Name:      block.Name,
+					Arguments: string(block.Input),
+				},
+			})
+		}
+	}
+
+	return &ChatResponse{
+		ID:     anthropicResp.ID,
+		Object: "chat.completion",
+		Choices: []Choice{
+			{
+				Message: Message{
+					Role:      "assistant",
+					Content:   text.String(),
+					ToolCalls: toolCalls,
+				},
+				FinishReason: anthropicResp.StopReason,
+			},
+		},
+		Usage: anthropicResp.Usage.toUsage(),
+	}, nil
+}
+
+// Stream sends a streaming Messages API request and forwards text deltas.
+// The input of tool calls arrives as fragments of JSON.
+func (p *anthropicProvider) Stream(ctx context.Context, req ChatRequest, onDelta func(string) error) (*ChatResponse, error) {
+	resp, err := p.transport.post(ctx, p.url, p.headers, toAnthropicRequest(req, true))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var id, stopReason string
+	var usage anthropicUsage
+	var response strings.Builder
+	var toolCalls []ToolCall
+	toolBlocks := map[int]int{} // Content block index to position in toolCalls
+	err = readEvents(resp.Body, func(_, data string) (bool, error) {
+		var event anthropicStreamEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return false, fmt.Errorf("error decoding stream event: %w", err)
+		}
+
+		switch event.Type {
+		case "message_start":
+			// Input tokens are reported up front, output tokens in message_delta
+			id = event.Message.ID
+			usage = event.Message.Usage
+		case "message_delta":
+			stopReason = event.Delta.StopReason
+			usage.OutputTokens = event.Usage.OutputTokens
+		case "content_block_start":
+			if event.ContentBlock.Type == "tool_use" {
+				toolBlocks[event.Index] = len(toolCalls)
+				toolCalls = append(toolCalls, ToolCall{
+					ID:       event.ContentBlock.ID,
+					Type:     "function",
+					Function: FunctionCall{Name: event.ContentBlock.Name},
+				})
+			}
+		case "content_block_delta":
+			if event.Delta.Type == "input_json_delta" {
+				if i, ok := toolBlocks[event.Index]; ok {
+					toolCalls[i].Function.Arguments += event.Delta.PartialJSON
+				}
+				return false, nil
+			}
+			if event.Delta.Type != "text_delta" || event.Delta.Text == "" {
+				return false, nil
+			}
+			response.WriteString(event.Delta.Text)
+			return false, onDelta(event.Delta.Text)
+		case "message_stop":
+			return true, nil
+		case "error":
+			return false, streamError(event.Error.Type, event.Error.Message)
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return streamedResponse(id, response.String(), toolCalls, stopReason, usage.toUsage()), nil
+}
+
+// toUsage converts Anthropic token counts into Usage
+func (u anthropicUsage) toUsage() Usage {
+	return Usage{
+		PromptTokens:     u.InputTokens,
+		CompletionTokens: u.OutputTokens,
+		TotalTokens:      u.InputTokens + u.OutputTokens,
+	}
+}
+
+// Embed is not supported by the Anthropic API
+func (p *anthropicProvider) Embed(ctx context.Context, model string, texts []string) ([][]float32, Usage, error) {
+	return nil, Usage{}, ErrEmbeddingsUnsupported
+}
+
+// toAnthropicRequest converts a chat request into a Messages API request.
+// System messages are moved into the top-level system prompt. Tool calls
+// become tool_use blocks, and tool results are sent as tool_result blocks
+// of a user message, one message for all results of a turn. The Messages
+// API has no seed or response format: seeds are dropped, and a response
+// schema is described in the system prompt instead.
+func toAnthropicRequest(req ChatRequest, stream bool) anthropicRequest {
+	var system []string
+	var messages []anthropicMessage
+
+	for _, msg := range req.Messages {
+		if msg.Role == "system" {
+			system = append(system, TextContent(msg.Content))
+			continue
+		}
+
+		if msg.Role == "tool" {
+			result := anthropicBlock{
+				Type:      "tool_result",
+				ToolUseID: msg.ToolCallID,
+				Content:   TextContent(msg.Content),
+			}
+			if n := len(messages); n > 0 && messages[n-1].Role == "user" &&
+				messages[n-1].Content[0].Type == "tool_result" {
+				messages[n-1].Content = append(messages[n-1].Content, result)
+				continue
+			}
+			messages = append(messages, anthropicMessage{
+				Role:    "user",
+				Content: []anthropicBlock{result},
+			})
+			continue
+		}
+
+		var blocks []anthropicBlock
+		if text := TextContent(msg.Content); text != "" {
+			blocks = append(blocks, anthropicBlock{Type: "text", Text: text})
+		}
+		for _, url := range imageURLs(msg.Content) {
+			source := &anthropicSource{Type: "url", URL: url}
+			if mediaType, data, ok := parseDataURL(url); ok {
+				source = &anthropicSource{Type: "base64", MediaType: mediaType, Data: data}
+			}
+			blocks = append(blocks, anthropicBlock{Type: "image", Source: source})
+		}
+		for _, call := range msg.ToolCalls {
+			input := json.RawMessage(call.Function.Arguments)
+			if !json.Valid(input) {
+				// The input must be an object, even when the model sent none
+				input = json.RawMessage("{}")
+			}
+			blocks = append(blocks, anthropicBlock{
+				Type:  "tool_use",
+				ID:    call.ID,
+				Name:  call.Function.Name,
+				Input: input,
+			})
+		}
+		if len(blocks) == 0 {
+			continue
+		}
+
+		messages = append(messages, anthropicMessage{
+			Role:    msg.Role,
+			Content: blocks,
+		})
+	}
+
+	if req.ResponseFormat != nil && req.ResponseFormat.JSONSchema != nil {
+		system = append(system, "Respond with only a JSON value, without any other text, that matches this JSON Schema:\n"+
+			string(req.ResponseFormat.JSONSchema.Schema))
+	}
+
+	var tools []anthropicTool
+	for _, tool := range req.Tools {
+		tools = append(tools, anthropicTool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			InputSchema: tool.Function.Parameters,
+		})
+	}
+	var toolChoice *anthropicChoice
+	if len(tools) > 0 && req.ToolChoice != "" {
+		toolChoice = &anthropicChoice{Type: req.ToolChoice}
+	}
+
+	return anthropicRequest{
+		Model:         req.Model,
+		System:        strings.Join(system, "\n\n"),
+		Messages:      messages,
+		MaxTokens:     req.MaxTokens,
+		Temperature:   req.Temperature,
+		TopP:          req.TopP,
+		StopSequences: req.Stop,
+		Tools:         tools,
+		ToolChoice:    toolChoice,
+		Stream:        stream,
+	}
+}
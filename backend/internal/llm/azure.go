@@ -0,0 +1,35 @@
+package llm
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/genterm/backend/internal/config"
+)
+
+// newAzureProvider creates a provider for Azure OpenAI. Azure uses the OpenAI
+// wire format but addresses models by deployment in the URL and
+// authenticates with an api-key header.
+func newAzureProvider(cfg *config.Config, t *transport) *openAIProvider {
+	baseURL := strings.TrimSuffix(cfg.LLMBaseURL, "/")
+
+	deploymentURL := func(deployment, operation string) string {
+		return fmt.Sprintf("%s/openai/deployments/%s/%s?api-version=%s",
+			baseURL, url.PathEscape(deployment), operation, url.QueryEscape(cfg.AzureAPIVersion))
+	}
+
+	return &openAIProvider{
+		transport: t,
+		headers: map[string]string{
+			"api-key": cfg.LLMAPIKey,
+		},
+		chatURL: deploymentURL(cfg.AzureDeployment, "chat/completions"),
+		embeddingsURL: func(string) string {
+			return deploymentURL(cfg.AzureEmbeddingDeployment, "embeddings")
+		},
+		// Older API versions reject stream_options, so streamed usage is
+		// estimated instead
+		streamUsage: false,
+	}
+}
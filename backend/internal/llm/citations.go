@@ -0,0 +1,31 @@
+package llm
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// citationPattern matches citation markers such as [2] or [1, 3]
+var citationPattern = regexp.MustCompile(`\[(\d+(?:\s*,\s*\d+)*)\]`)
+
+// Citations returns the context item numbers cited in text, in order of
+// first appearance. Numbers outside 1..count are ignored, since the model
+// sometimes cites things that were never in its context.
+func Citations(text string, count int) []int {
+	seen := make(map[int]bool)
+	var numbers []int
+
+	for _, match := range citationPattern.FindAllStringSubmatch(text, -1) {
+		for _, field := range strings.Split(match[1], ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(field))
+			if err != nil || n < 1 || n > count || seen[n] {
+				continue
+			}
+			seen[n] = true
+			numbers = append(numbers, n)
+		}
+	}
+
+	return numbers
+}
@@ -1,25 +1,45 @@
 package llm
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 
 	"github.com/genterm/backend/internal/config"
 )
 
 // Client for interacting with LLM APIs
 type Client struct {
-	config *config.Config
-	client *http.Client
+	config   *config.Config
+	provider Provider
+
+	// providers serves catalog models that need their own connection
+	providers map[string]Provider
 }
 
 // Message represents a single message in the conversation
 type Message struct {
 	Role    string      `json:"role"`
 	Content interface{} `json:"content"`
+
+	// ToolCalls are the tools an assistant message asks to run; a message
+	// with role "tool" answers the call named by ToolCallID
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+	Name       string     `json:"name,omitempty"`
+}
+
+// ToolCall is a request of the model to run a tool
+type ToolCall struct {
+	ID       string       `json:"id"`
+	Type     string       `json:"type"`
+	Function FunctionCall `json:"function"`
+}
+
+// FunctionCall names the tool to run and its JSON encoded arguments
+type FunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
 }
 
 // ContentItem represents a single content item in a message
@@ -27,6 +47,10 @@ type ContentItem struct {
 	Type     string   `json:"type"`
 	Text     string   `json:"text,omitempty"`
 	ImageURL ImageURL `json:"image_url,omitempty"`
+
+	// Ref names the stored image or document an item was built from. It is
+	// never sent to a provider.
+	Ref string `json:"-"`
 }
 
 // ImageURL represents an image URL object
@@ -36,9 +60,42 @@ type ImageURL struct {
 
 // ChatRequest represents a chat completion request
 type ChatRequest struct {
-	Model     string    `json:"model"`
-	Messages  []Message `json:"messages"`
-	MaxTokens int       `json:"max_tokens,omitempty"`
+	Model          string          `json:"model"`
+	Messages       []Message       `json:"messages"`
+	MaxTokens      int             `json:"max_tokens,omitempty"`
+	Temperature    *float64        `json:"temperature,omitempty"`
+	TopP           *float64        `json:"top_p,omitempty"`
+	Stop           []string        `json:"stop,omitempty"`
+	Seed           *int            `json:"seed,omitempty"`
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+	Tools          []Tool          `json:"tools,omitempty"`
+	ToolChoice     string          `json:"tool_choice,omitempty"`
+	Stream         bool            `json:"stream,omitempty"`
+	StreamOptions  *StreamOptions  `json:"stream_options,omitempty"`
+}
+
+// Tool describes a function the model may call
+type Tool struct {
+	Type     string       `json:"type"`
+	Function ToolFunction `json:"function"`
+}
+
+// ToolFunction is the name, purpose and JSON Schema parameters of a tool
+type ToolFunction struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters"`
+}
+
+// Values of ChatRequest.ToolChoice
+const (
+	ToolChoiceAuto = "auto"
+	ToolChoiceNone = "none"
+)
+
+// StreamOptions configures what a streamed response includes
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
 }
 
 // ChatResponse represents a chat completion response
@@ -47,6 +104,39 @@ type ChatResponse struct {
 	Object  string   `json:"object"`
 	Created int64    `json:"created"`
 	Choices []Choice `json:"choices"`
+	Usage   Usage    `json:"usage"`
+}
+
+// Usage reports the tokens consumed by a request
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// Add returns the sum of two token counts
+func (u Usage) Add(other Usage) Usage {
+	return Usage{
+		PromptTokens:     u.PromptTokens + other.PromptTokens,
+		CompletionTokens: u.CompletionTokens + other.CompletionTokens,
+		TotalTokens:      u.TotalTokens + other.TotalTokens,
+	}
+}
+
+// Completion is the text of a finished completion and the tokens it used
+type Completion struct {
+	Content string
+	Usage   Usage
+
+	// ToolCalls are the tools the model asked to run instead of answering
+	ToolCalls []ToolCall
+
+	// FinishReason is why the provider stopped generating, in its own words
+	FinishReason string
+
+	// Steps are the tool calls and results exchanged before the answer
+	// when the completion was generated with tools
+	Steps []Message
 }
 
 // Choice represents a response choice
@@ -56,108 +146,86 @@ type Choice struct {
 	FinishReason string  `json:"finish_reason"`
 }
 
-// NewClient creates a new LLM client
+// NewClient creates a new LLM client for the configured provider and every
+// model of the catalog
 func NewClient(cfg *config.Config) *Client {
-	return &Client{
-		config: cfg,
-		client: &http.Client{},
+	c := &Client{
+		config:    cfg,
+		provider:  NewProvider(cfg),
+		providers: make(map[string]Provider),
 	}
-}
 
-// GenerateCompletion generates a chat completion response
-func (c *Client) GenerateCompletion(messages []Message) (string, error) {
-	chatRequest := ChatRequest{
-		Model:     c.config.LLMModel,
-		Messages:  messages,
-		MaxTokens: 2000,
-	}
-
-	jsonData, err := json.Marshal(chatRequest)
-	if err != nil {
-		return "", fmt.Errorf("error marshalling request: %w", err)
+	for _, model := range cfg.Models {
+		if modelCfg := modelConfig(cfg, model); modelCfg != nil {
+			c.providers[model.Name] = NewProvider(modelCfg)
+		}
 	}
 
-	// Debug: print request
-	// fmt.Printf("Debug - API Request: %s\n", string(jsonData))
+	return c
+}
 
-	url := fmt.Sprintf("%s/chat/completions", c.config.LLMBaseURL)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", fmt.Errorf("error creating request: %w", err)
+// modelConfig returns the configuration for a catalog model that cannot be
+// served by the default provider, or nil if it can
+func modelConfig(cfg *config.Config, model config.ModelInfo) *config.Config {
+	sameProvider := model.Provider == cfg.LLMProvider
+	// Azure addresses models by deployment, so other models need their own URL
+	if sameProvider && model.BaseURL == "" && model.APIKey == "" &&
+		(model.Provider != ProviderAzure || model.Name == cfg.LLMModel) {
+		return nil
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.config.LLMAPIKey))
-
-	resp, err := c.client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("error making request: %w", err)
-	}
-	defer resp.Body.Close()
+	modelCfg := *cfg
+	modelCfg.LLMProvider = model.Provider
+	modelCfg.LLMModel = model.Name
+	modelCfg.AzureDeployment = model.Name
 
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("API error: %s, status code: %d", string(bodyBytes), resp.StatusCode)
+	switch {
+	case model.BaseURL != "":
+		modelCfg.LLMBaseURL = model.BaseURL
+	case !sameProvider:
+		modelCfg.LLMBaseURL = config.DefaultBaseURL(model.Provider)
 	}
 
-	var chatResponse ChatResponse
-	if err := json.NewDecoder(resp.Body).Decode(&chatResponse); err != nil {
-		return "", fmt.Errorf("error decoding response: %w", err)
+	// The default API key is never sent to another provider
+	switch {
+	case model.APIKey != "":
+		modelCfg.LLMAPIKey = model.APIKey
+	case !sameProvider:
+		modelCfg.LLMAPIKey = ""
 	}
 
-	if len(chatResponse.Choices) == 0 {
-		return "", fmt.Errorf("no choices returned in response")
-	}
+	return &modelCfg
+}
 
-	content := chatResponse.Choices[0].Message.Content
-	if strContent, ok := content.(string); ok {
-		return strContent, nil
+// providerFor returns the provider serving a model
+func (c *Client) providerFor(model string) Provider {
+	if provider, ok := c.providers[model]; ok {
+		return provider
 	}
+	return c.provider
+}
 
-	// Try to marshal the content if it's not a string
-	contentBytes, err := json.Marshal(content)
+// GenerateCompletion generates a chat completion response
+func (c *Client) GenerateCompletion(ctx context.Context, messages []Message) (string, error) {
+	completion, err := c.Complete(ctx, messages, Params{})
 	if err != nil {
-		return "", fmt.Errorf("error marshalling content: %w", err)
+		return "", err
 	}
+	return completion.Content, nil
+}
 
-	return string(contentBytes), nil
+// Complete generates a chat completion and reports the tokens it used
+func (c *Client) Complete(ctx context.Context, messages []Message, params Params) (*Completion, error) {
+	return c.send(ctx, c.newRequest(messages, params), nil)
 }
 
 // GenerateCompletionWithHistory generates a chat completion response using conversation history
-func (c *Client) GenerateCompletionWithHistory(sessionMessages []Message, query string, context []string, systemPrompt string) (string, error) {
-	messages := []Message{
-		{
-			Role:    "system",
-			Content: systemPrompt,
-		},
-	}
-
-	// Add context as user messages if provided
-	if len(context) > 0 {
-		contextMessage := "Context information:\n\n"
-		for i, ctx := range context {
-			contextMessage += fmt.Sprintf("[%d] %s\n\n", i+1, ctx)
-		}
-		messages = append(messages, Message{
-			Role:    "user",
-			Content: contextMessage,
-		})
-	}
-
-	// Add conversation history
-	messages = append(messages, sessionMessages...)
-
-	// Add user query as the latest message
-	messages = append(messages, Message{
-		Role:    "user",
-		Content: query,
-	})
-
-	return c.GenerateCompletion(messages)
+func (c *Client) GenerateCompletionWithHistory(ctx context.Context, sessionMessages []Message, query string, ragContext []string, systemPrompt string) (string, error) {
+	return c.GenerateCompletion(ctx, BuildMessages(sessionMessages, query, ragContext, systemPrompt))
 }
 
 // GenerateRAGCompletion generates a completion with RAG context
-func (c *Client) GenerateRAGCompletion(query string, context []string, systemPrompt string) (string, error) {
+func (c *Client) GenerateRAGCompletion(ctx context.Context, query string, ragContext []string, systemPrompt string) (string, error) {
 	messages := []Message{
 		{
 			Role:    "system",
@@ -167,8 +235,8 @@ func (c *Client) GenerateRAGCompletion(query string, context []string, systemPro
 
 	// Add context as user messages
 	contextMessage := "Context information:\n\n"
-	for i, ctx := range context {
-		contextMessage += fmt.Sprintf("[%d] %s\n\n", i+1, ctx)
+	for i, item := range ragContext {
+		contextMessage += fmt.Sprintf("[%d] %s\n\n", i+1, item)
 	}
 	messages = append(messages, Message{
 		Role:    "user",
@@ -181,11 +249,11 @@ func (c *Client) GenerateRAGCompletion(query string, context []string, systemPro
 		Content: query,
 	})
 
-	return c.GenerateCompletion(messages)
+	return c.GenerateCompletion(ctx, messages)
 }
 
 // GenerateMultimodalCompletion generates a completion with image and text
-func (c *Client) GenerateMultimodalCompletion(messageContent []ContentItem, context []string, systemPrompt string) (string, error) {
+func (c *Client) GenerateMultimodalCompletion(ctx context.Context, messageContent []ContentItem, ragContext []string, systemPrompt string) (string, error) {
 	messages := []Message{
 		{
 			Role:    "system",
@@ -194,10 +262,10 @@ func (c *Client) GenerateMultimodalCompletion(messageContent []ContentItem, cont
 	}
 
 	// Add context as user messages if provided
-	if len(context) > 0 {
+	if len(ragContext) > 0 {
 		contextMessage := "Context information:\n\n"
-		for i, ctx := range context {
-			contextMessage += fmt.Sprintf("[%d] %s\n\n", i+1, ctx)
+		for i, item := range ragContext {
+			contextMessage += fmt.Sprintf("[%d] %s\n\n", i+1, item)
 		}
 		messages = append(messages, Message{
 			Role:    "user",
@@ -211,11 +279,22 @@ func (c *Client) GenerateMultimodalCompletion(messageContent []ContentItem, cont
 		Content: messageContent,
 	})
 
-	return c.GenerateCompletion(messages)
+	return c.GenerateCompletion(ctx, messages)
 }
 
 // GenerateMultimodalCompletionWithHistory generates a completion with image, text and conversation history
-func (c *Client) GenerateMultimodalCompletionWithHistory(sessionMessages []Message, messageContent []ContentItem, context []string, systemPrompt string) (string, error) {
+func (c *Client) GenerateMultimodalCompletionWithHistory(ctx context.Context, sessionMessages []Message, messageContent []ContentItem, ragContext []string, systemPrompt string) (string, error) {
+	return c.GenerateCompletion(ctx, BuildMessages(sessionMessages, messageContent, ragContext, systemPrompt))
+}
+
+// citationInstruction asks the model to reference the numbered context items
+// it uses, so answers can be traced back to their sources
+const citationInstruction = "When you use information from the context above, cite the item number in square brackets, for example [1] or [2, 3]."
+
+// BuildMessages assembles the system prompt, context, conversation history
+// and the latest user turn into a message list. userContent is either a
+// plain string or a slice of ContentItem for multimodal turns.
+func BuildMessages(sessionMessages []Message, userContent interface{}, ragContext []string, systemPrompt string) []Message {
 	messages := []Message{
 		{
 			Role:    "system",
@@ -224,25 +303,160 @@ func (c *Client) GenerateMultimodalCompletionWithHistory(sessionMessages []Messa
 	}
 
 	// Add context as user messages if provided
-	if len(context) > 0 {
-		contextMessage := "Context information:\n\n"
-		for i, ctx := range context {
-			contextMessage += fmt.Sprintf("[%d] %s\n\n", i+1, ctx)
-		}
-		messages = append(messages, Message{
-			Role:    "user",
-			Content: contextMessage,
-		})
+	if len(ragContext) > 0 {
+		messages = append(messages, ContextMessage(ragContext))
 	}
 
 	// Add conversation history
 	messages = append(messages, sessionMessages...)
 
-	// Add multimodal content as a single message
+	// Add user turn as the latest message
 	messages = append(messages, Message{
 		Role:    "user",
-		Content: messageContent,
+		Content: userContent,
 	})
 
-	return c.GenerateCompletion(messages)
+	return messages
+}
+
+// ContextMessage returns the user message that hands numbered context items
+// to the model and asks it to cite them
+func ContextMessage(ragContext []string) Message {
+	contextMessage := "Context information:\n\n"
+	for i, item := range ragContext {
+		contextMessage += fmt.Sprintf("[%d] %s\n\n", i+1, item)
+	}
+	contextMessage += citationInstruction
+	return Message{
+		Role:    "user",
+		Content: contextMessage,
+	}
+}
+
+// StreamCompletion generates a chat completion and calls onDelta for every
+// content chunk as it arrives. It returns the full concatenated response.
+// Returning an error from onDelta aborts the stream.
+func (c *Client) StreamCompletion(ctx context.Context, messages []Message, params Params, onDelta func(string) error) (*Completion, error) {
+	return c.send(ctx, c.newRequest(messages, params), onDelta)
+}
+
+// Forward generates a completion in which the model may call tools that the
+// caller runs itself: the calls are returned in the ToolCalls of the
+// completion. The response is streamed when onDelta is set.
+func (c *Client) Forward(ctx context.Context, messages []Message, params Params, tools []Tool, toolChoice string, onDelta func(string) error) (*Completion, error) {
+	chatRequest := c.newRequest(messages, params)
+	if len(tools) > 0 {
+		chatRequest.Tools = tools
+		chatRequest.ToolChoice = toolChoice
+	}
+	return c.send(ctx, chatRequest, onDelta)
+}
+
+// send sends a chat request to the provider of its model. The response is
+// streamed when onDelta is set.
+func (c *Client) send(ctx context.Context, chatRequest ChatRequest, onDelta func(string) error) (*Completion, error) {
+	provider := c.providerFor(chatRequest.Model)
+
+	var chatResponse *ChatResponse
+	var err error
+	if onDelta != nil {
+		chatRequest.Stream = true
+		chatResponse, err = provider.Stream(ctx, chatRequest, onDelta)
+	} else {
+		chatResponse, err = provider.Complete(ctx, chatRequest)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return toCompletion(chatRequest.Messages, chatResponse)
+}
+
+// newRequest builds a chat request for the chosen or the default model
+func (c *Client) newRequest(messages []Message, params Params) ChatRequest {
+	model := params.Model
+	if model == "" {
+		model = c.config.LLMModel
+	}
+
+	req := ChatRequest{
+		Model:       model,
+		Messages:    messages,
+		MaxTokens:   params.CompletionTokens(),
+		Temperature: params.Temperature,
+		TopP:        params.TopP,
+		Stop:        params.Stop,
+		Seed:        params.Seed,
+	}
+
+	switch {
+	case len(params.ResponseSchema) > 0:
+		req.ResponseFormat = &ResponseFormat{
+			Type:       "json_schema",
+			JSONSchema: &JSONSchema{Name: "response", Schema: params.ResponseSchema},
+		}
+	case params.ResponseFormat == ResponseFormatJSON:
+		req.ResponseFormat = &ResponseFormat{Type: "json_object"}
+	case params.ResponseFormat == ResponseFormatText:
+		req.ResponseFormat = &ResponseFormat{Type: "text"}
+	}
+
+	return req
+}
+
+// toCompletion extracts the text of the first choice of a response. Usage
+// is estimated when the provider did not report it.
+func toCompletion(messages []Message, chatResponse *ChatResponse) (*Completion, error) {
+	if len(chatResponse.Choices) == 0 {
+		return nil, fmt.Errorf("no choices returned in response")
+	}
+
+	message := chatResponse.Choices[0].Message
+	var content string
+	switch c := message.Content.(type) {
+	case string:
+		content = c
+	case nil:
+		// Responses that only call tools have no content
+	default:
+		// Try to marshal the content if it's not a string
+		contentBytes, err := json.Marshal(c)
+		if err != nil {
+			return nil, fmt.Errorf("error marshalling content: %w", err)
+		}
+		content = string(contentBytes)
+	}
+
+	usage := chatResponse.Usage
+	if usage.TotalTokens == 0 {
+		if usage.PromptTokens == 0 && usage.CompletionTokens == 0 {
+			usage.PromptTokens = EstimateMessageTokens(messages)
+			usage.CompletionTokens = EstimateTokens(content)
+		}
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+
+	return &Completion{
+		Content:      content,
+		Usage:        usage,
+		ToolCalls:    message.ToolCalls,
+		FinishReason: chatResponse.Choices[0].FinishReason,
+	}, nil
+}
+
+// CreateEmbeddings returns an embedding vector for each input text and the
+// number of tokens of the texts, estimated when the provider did not report it
+func (c *Client) CreateEmbeddings(ctx context.Context, texts []string) ([][]float32, int, error) {
+	vectors, usage, err := c.provider.Embed(ctx, c.config.EmbeddingModel, texts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	tokens := usage.TotalTokens
+	if tokens == 0 {
+		for _, text := range texts {
+			tokens += EstimateTokens(text)
+		}
+	}
+	return vectors, tokens, nil
 }
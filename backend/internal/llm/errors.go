@@ -0,0 +1,143 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error kinds returned by providers. Use errors.Is to check an error's kind.
+var (
+	ErrRateLimited    = errors.New("rate limited by upstream")
+	ErrAuth           = errors.New("upstream authentication failed")
+	ErrContextLength  = errors.New("context length exceeded")
+	ErrInvalidRequest = errors.New("request rejected by upstream")
+	ErrUpstreamDown   = errors.New("upstream unavailable")
+	ErrTimeout        = errors.New("upstream timed out")
+)
+
+// APIError describes a failed upstream request
+type APIError struct {
+	Kind       error
+	StatusCode int
+	Message    string
+	RetryAfter time.Duration
+}
+
+// Error implements the error interface
+func (e *APIError) Error() string {
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("%v: %s", e.Kind, e.Message)
+	}
+	return fmt.Sprintf("%v: %s, status code: %d", e.Kind, e.Message, e.StatusCode)
+}
+
+// Unwrap returns the error kind so errors.Is matches it
+func (e *APIError) Unwrap() error {
+	return e.Kind
+}
+
+// Temporary reports whether the request may succeed if retried
+func (e *APIError) Temporary() bool {
+	return e.Kind == ErrRateLimited || e.Kind == ErrUpstreamDown || e.Kind == ErrTimeout
+}
+
+// contextLengthMarkers are fragments of the error messages providers use
+// when a prompt does not fit the model's context window
+var contextLengthMarkers = []string{
+	"context_length_exceeded",
+	"maximum context length",
+	"context window",
+	"prompt is too long",
+	"too many tokens",
+}
+
+// newAPIError classifies a non-200 upstream response
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Message:    strings.TrimSpace(string(body)),
+		RetryAfter: parseRetryAfter(resp.Header),
+	}
+
+	lower := strings.ToLower(apiErr.Message)
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		apiErr.Kind = ErrRateLimited
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		apiErr.Kind = ErrAuth
+	case containsAny(lower, contextLengthMarkers):
+		apiErr.Kind = ErrContextLength
+	case resp.StatusCode >= 500:
+		// Includes Anthropic's 529 overloaded status
+		apiErr.Kind = ErrUpstreamDown
+	default:
+		apiErr.Kind = ErrInvalidRequest
+	}
+
+	return apiErr
+}
+
+// streamError classifies an error reported inside a response stream
+func streamError(errorType, message string) *APIError {
+	errorType = strings.TrimSpace(errorType)
+	apiErr := &APIError{
+		Kind:    ErrUpstreamDown,
+		Message: message,
+	}
+	if errorType != "" {
+		apiErr.Message = fmt.Sprintf("%s: %s", errorType, message)
+	}
+
+	lower := strings.ToLower(errorType + " " + message)
+	switch {
+	case strings.Contains(lower, "rate_limit"):
+		apiErr.Kind = ErrRateLimited
+	case strings.Contains(lower, "authentication") || strings.Contains(lower, "permission"):
+		apiErr.Kind = ErrAuth
+	case containsAny(lower, contextLengthMarkers):
+		apiErr.Kind = ErrContextLength
+	case strings.Contains(lower, "invalid_request"):
+		apiErr.Kind = ErrInvalidRequest
+	}
+
+	return apiErr
+}
+
+// parseRetryAfter reads the delay requested by Retry-After or the
+// millisecond variant some providers send
+func parseRetryAfter(header http.Header) time.Duration {
+	if ms := header.Get("Retry-After-Ms"); ms != "" {
+		if value, err := strconv.ParseFloat(ms, 64); err == nil && value > 0 {
+			return time.Duration(value * float64(time.Millisecond))
+		}
+	}
+
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+	}
+
+	return 0
+}
+
+// containsAny reports whether s contains any of the substrings
+func containsAny(s string, substrings []string) bool {
+	for _, sub := range substrings {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
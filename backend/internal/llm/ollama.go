@@ -0,0 +1,301 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/genterm/backend/internal/config"
+	"github.com/google/uuid"
+)
+
+// ollamaProvider speaks Ollama's native /api/chat and /api/embed endpoints
+type ollamaProvider struct {
+	transport *transport
+	headers   map[string]string
+	chatURL   string
+	embedURL  string
+}
+
+// ollamaRequest represents an /api/chat request
+type ollamaRequest struct {
+	Model    string                 `json:"model"`
+	Messages []ollamaMessage        `json:"messages"`
+	Stream   bool                   `json:"stream"`
+	Format   json.RawMessage        `json:"format,omitempty"`
+	Options  map[string]interface{} `json:"options,omitempty"`
+	Tools    []Tool                 `json:"tools,omitempty"`
+}
+
+// ollamaMessage represents a single /api/chat message
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Images    []string         `json:"images,omitempty"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+}
+
+// ollamaToolCall represents a tool call. Ollama sends the arguments as a
+// JSON object rather than a string, and calls have no ID.
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+// ollamaResponse represents an /api/chat response or stream line
+type ollamaResponse struct {
+	Model      string        `json:"model"`
+	CreatedAt  string        `json:"created_at"`
+	Message    ollamaMessage `json:"message"`
+	Done       bool          `json:"done"`
+	DoneReason string        `json:"done_reason"`
+	Error      string        `json:"error"`
+
+	// Token counts, sent with the final response
+	PromptEvalCount int `json:"prompt_eval_count"`
+	EvalCount       int `json:"eval_count"`
+}
+
+// ollamaEmbedRequest represents an /api/embed request
+type ollamaEmbedRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+// ollamaEmbedResponse represents an /api/embed response
+type ollamaEmbedResponse struct {
+	Embeddings      [][]float32 `json:"embeddings"`
+	PromptEvalCount int         `json:"prompt_eval_count"`
+}
+
+// newOllamaProvider creates a provider for an Ollama server
+func newOllamaProvider(cfg *config.Config, t *transport) *ollamaProvider {
+	baseURL := strings.TrimSuffix(cfg.LLMBaseURL, "/")
+
+	headers := map[string]string{}
+	if cfg.LLMAPIKey != "" {
+		// Ollama itself has no auth, but it is often run behind a proxy that does
+		headers["Authorization"] = fmt.Sprintf("Bearer %s", cfg.LLMAPIKey)
+	}
+
+	return &ollamaProvider{
+		transport: t,
+		headers:   headers,
+		chatURL:   fmt.Sprintf("%s/api/chat", baseURL),
+		embedURL:  fmt.Sprintf("%s/api/embed", baseURL),
+	}
+}
+
+// Complete sends a non-streaming /api/chat request
+func (p *ollamaProvider) Complete(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	resp, err := p.transport.post(ctx, p.chatURL, p.headers, toOllamaRequest(req, false))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var ollamaResp ollamaResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ollamaResp); err != nil {
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	}
+	if ollamaResp.Error != "" {
+		return nil, streamError("", ollamaResp.Error)
+	}
+
+	return &ChatResponse{
+		Object: "chat.completion",
+		Choices: []Choice{
+			{
+				Message: Message{
+					Role:      "assistant",
+					Content:   ollamaResp.Message.Content,
+					ToolCalls: ollamaResp.Message.toolCalls(),
+				},
+				FinishReason: ollamaResp.DoneReason,
+			},
+		},
+		Usage: ollamaResp.usage(),
+	}, nil
+}
+
+// Stream sends a streaming /api/chat request. Ollama streams newline
+// delimited JSON objects rather than Server-Sent Events.
+func (p *ollamaProvider) Stream(ctx context.Context, req ChatRequest, onDelta func(string) error) (*ChatResponse, error) {
+	resp, err := p.transport.post(ctx, p.chatURL, p.headers, toOllamaRequest(req, true))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var last ollamaResponse
+	var response strings.Builder
+	var toolCalls []ToolCall
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var chunk ollamaResponse
+		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+			return nil, fmt.Errorf("error decoding stream chunk: %w", err)
+		}
+		if chunk.Error != "" {
+			return nil, streamError("", chunk.Error)
+		}
+
+		toolCalls = append(toolCalls, chunk.Message.toolCalls()...)
+		if chunk.Message.Content != "" {
+			response.WriteString(chunk.Message.Content)
+			if err := onDelta(chunk.Message.Content); err != nil {
+				return nil, err
+			}
+		}
+
+		if chunk.Done {
+			last = chunk
+			break
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading stream: %w", err)
+	}
+
+	return streamedResponse("", response.String(), toolCalls, last.DoneReason, last.usage()), nil
+}
+
+// toolCalls converts the tool calls of a message, giving each an ID so the
+// results can be matched to them
+func (m ollamaMessage) toolCalls() []ToolCall {
+	var calls []ToolCall
+	for _, call := range m.ToolCalls {
+		calls = append(calls, ToolCall{
+			ID:   "call_" + strings.ReplaceAll(uuid.New().String(), "-", ""),
+			Type: "function",
+			Function: FunctionCall{
+				Name:      call.Function.Name,
+				Arguments: string(call.Function.Arguments),
+			},
+		})
+	}
+	return calls
+}
+
+// usage returns the token counts of a final /api/chat response
+func (r ollamaResponse) usage() Usage {
+	return Usage{
+		PromptTokens:     r.PromptEvalCount,
+		CompletionTokens: r.EvalCount,
+		TotalTokens:      r.PromptEvalCount + r.EvalCount,
+	}
+}
+
+// Embed sends an /api/embed request
+func (p *ollamaProvider) Embed(ctx context.Context, model string, texts []string) ([][]float32, Usage, error) {
+	resp, err := p.transport.post(ctx, p.embedURL, p.headers, ollamaEmbedRequest{
+		Model: model,
+		Input: texts,
+	})
+	if err != nil {
+		return nil, Usage{}, err
+	}
+	defer resp.Body.Close()
+
+	var embedResp ollamaEmbedResponse
+	if err := json.NewDecoder(resp.Body).Decode(&embedResp); err != nil {
+		return nil, Usage{}, fmt.Errorf("error decoding response: %w", err)
+	}
+	if len(embedResp.Embeddings) != len(texts) {
+		return nil, Usage{}, fmt.Errorf("got %d embeddings for %d inputs", len(embedResp.Embeddings), len(texts))
+	}
+
+	return embedResp.Embeddings, Usage{
+		PromptTokens: embedResp.PromptEvalCount,
+		TotalTokens:  embedResp.PromptEvalCount,
+	}, nil
+}
+
+// toOllamaRequest converts a chat request into an /api/chat request. Images
+// are sent as raw base64 in the images field; remote image URLs are not
+// supported by Ollama and are dropped. Tool call arguments are sent as
+// objects.
+func toOllamaRequest(req ChatRequest, stream bool) ollamaRequest {
+	messages := make([]ollamaMessage, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		ollamaMsg := ollamaMessage{
+			Role:    msg.Role,
+			Content: TextContent(msg.Content),
+		}
+		if msg.Role == "tool" {
+			ollamaMsg.ToolName = msg.Name
+		}
+		for _, call := range msg.ToolCalls {
+			var ollamaCall ollamaToolCall
+			ollamaCall.Function.Name = call.Function.Name
+			ollamaCall.Function.Arguments = json.RawMessage(call.Function.Arguments)
+			if !json.Valid(ollamaCall.Function.Arguments) {
+				ollamaCall.Function.Arguments = json.RawMessage("{}")
+			}
+			ollamaMsg.ToolCalls = append(ollamaMsg.ToolCalls, ollamaCall)
+		}
+		for _, url := range imageURLs(msg.Content) {
+			if _, data, ok := parseDataURL(url); ok {
+				ollamaMsg.Images = append(ollamaMsg.Images, data)
+			}
+		}
+		messages = append(messages, ollamaMsg)
+	}
+
+	options := map[string]interface{}{}
+	if req.MaxTokens > 0 {
+		options["num_predict"] = req.MaxTokens
+	}
+	if req.Temperature != nil {
+		options["temperature"] = *req.Temperature
+	}
+	if req.TopP != nil {
+		options["top_p"] = *req.TopP
+	}
+	if len(req.Stop) > 0 {
+		options["stop"] = req.Stop
+	}
+	if req.Seed != nil {
+		options["seed"] = *req.Seed
+	}
+
+	// Format is either "json" or a JSON Schema
+	var format json.RawMessage
+	if req.ResponseFormat != nil {
+		switch {
+		case req.ResponseFormat.JSONSchema != nil:
+			format = req.ResponseFormat.JSONSchema.Schema
+		case req.ResponseFormat.Type == "json_object":
+			format = json.RawMessage(`"json"`)
+		}
+	}
+
+	// Ollama has no tool choice; leaving the tools out keeps the model from
+	// calling them
+	var tools []Tool
+	if req.ToolChoice != ToolChoiceNone {
+		tools = req.Tools
+	}
+
+	return ollamaRequest{
+		Model:    req.Model,
+		Messages: messages,
+		Stream:   stream,
+		Format:   format,
+		Options:  options,
+		Tools:    tools,
+	}
+}
@@ -0,0 +1,233 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/genterm/backend/internal/config"
+)
+
+// openAIProvider speaks the OpenAI /chat/completions and /embeddings wire format
+type openAIProvider struct {
+	transport     *transport
+	headers       map[string]string
+	chatURL       string
+	embeddingsURL func(model string) string
+	streamUsage   bool
+}
+
+// StreamChunk represents a single chunk of a streamed chat completion
+type StreamChunk struct {
+	ID      string         `json:"id"`
+	Choices []StreamChoice `json:"choices"`
+	Usage   *Usage         `json:"usage,omitempty"`
+	Error   *StreamError   `json:"error,omitempty"`
+}
+
+// StreamError represents an error reported in the middle of a stream
+type StreamError struct {
+	Type    string `json:"type"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// StreamChoice represents a choice delta in a streamed response
+type StreamChoice struct {
+	Index        int         `json:"index"`
+	Delta        StreamDelta `json:"delta"`
+	FinishReason string      `json:"finish_reason"`
+}
+
+// StreamDelta represents the incremental content of a streamed choice
+type StreamDelta struct {
+	Role      string           `json:"role,omitempty"`
+	Content   string           `json:"content,omitempty"`
+	ToolCalls []StreamToolCall `json:"tool_calls,omitempty"`
+}
+
+// StreamToolCall is a piece of a tool call in a streamed response. The ID
+// and name come first; the arguments follow in fragments.
+type StreamToolCall struct {
+	Index    int          `json:"index"`
+	ID       string       `json:"id,omitempty"`
+	Type     string       `json:"type,omitempty"`
+	Function FunctionCall `json:"function"`
+}
+
+// EmbeddingRequest represents an embeddings request
+type EmbeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+// EmbeddingResponse represents an embeddings response
+type EmbeddingResponse struct {
+	Data  []EmbeddingData `json:"data"`
+	Usage Usage           `json:"usage"`
+}
+
+// EmbeddingData represents a single embedding vector
+type EmbeddingData struct {
+	Index     int       `json:"index"`
+	Embedding []float32 `json:"embedding"`
+}
+
+// newOpenAIProvider creates a provider for OpenAI and compatible APIs
+func newOpenAIProvider(cfg *config.Config, t *transport) *openAIProvider {
+	baseURL := strings.TrimSuffix(cfg.LLMBaseURL, "/")
+
+	return &openAIProvider{
+		transport: t,
+		headers: map[string]string{
+			"Authorization": fmt.Sprintf("Bearer %s", cfg.LLMAPIKey),
+		},
+		chatURL: fmt.Sprintf("%s/chat/completions", baseURL),
+		embeddingsURL: func(string) string {
+			return fmt.Sprintf("%s/embeddings", baseURL)
+		},
+		streamUsage: true,
+	}
+}
+
+// Complete sends a chat completion request
+func (p *openAIProvider) Complete(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	req.Stream = false
+
+	resp, err := p.transport.post(ctx, p.chatURL, p.headers, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var chatResponse ChatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&chatResponse); err != nil {
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	}
+
+	return &chatResponse, nil
+}
+
+// Stream sends a streaming chat completion request and parses the SSE deltas
+func (p *openAIProvider) Stream(ctx context.Context, req ChatRequest, onDelta func(string) error) (*ChatResponse, error) {
+	req.Stream = true
+	if p.streamUsage {
+		// Usage is only sent in a final chunk when asked for
+		req.StreamOptions = &StreamOptions{IncludeUsage: true}
+	}
+
+	headers := map[string]string{"Accept": "text/event-stream"}
+	for key, value := range p.headers {
+		headers[key] = value
+	}
+
+	resp, err := p.transport.post(ctx, p.chatURL, headers, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var id, finishReason string
+	var usage Usage
+	var response strings.Builder
+	var toolCalls []ToolCall
+	err = readEvents(resp.Body, func(_, data string) (bool, error) {
+		if data == "[DONE]" {
+			return true, nil
+		}
+
+		var chunk StreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return false, fmt.Errorf("error decoding stream chunk: %w", err)
+		}
+		if chunk.Error != nil {
+			return false, streamError(chunk.Error.Type+" "+chunk.Error.Code, chunk.Error.Message)
+		}
+		if chunk.ID != "" {
+			id = chunk.ID
+		}
+		if chunk.Usage != nil {
+			usage = *chunk.Usage
+		}
+
+		for _, choice := range chunk.Choices {
+			if choice.Index != 0 {
+				continue
+			}
+			if choice.FinishReason != "" {
+				finishReason = choice.FinishReason
+			}
+			for _, call := range choice.Delta.ToolCalls {
+				toolCalls = mergeToolCall(toolCalls, call)
+			}
+			if choice.Delta.Content == "" {
+				continue
+			}
+			response.WriteString(choice.Delta.Content)
+			if err := onDelta(choice.Delta.Content); err != nil {
+				return false, err
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return streamedResponse(id, response.String(), toolCalls, finishReason, usage), nil
+}
+
+// mergeToolCall adds a streamed piece of a tool call to the calls received so far
+func mergeToolCall(calls []ToolCall, piece StreamToolCall) []ToolCall {
+	if piece.Index < 0 {
+		return calls
+	}
+	for len(calls) <= piece.Index {
+		calls = append(calls, ToolCall{Type: "function"})
+	}
+
+	call := &calls[piece.Index]
+	if piece.ID != "" {
+		call.ID = piece.ID
+	}
+	if piece.Function.Name != "" {
+		call.Function.Name = piece.Function.Name
+	}
+	call.Function.Arguments += piece.Function.Arguments
+	return calls
+}
+
+// Embed sends an embeddings request
+func (p *openAIProvider) Embed(ctx context.Context, model string, texts []string) ([][]float32, Usage, error) {
+	resp, err := p.transport.post(ctx, p.embeddingsURL(model), p.headers, EmbeddingRequest{
+		Model: model,
+		Input: texts,
+	})
+	if err != nil {
+		return nil, Usage{}, err
+	}
+	defer resp.Body.Close()
+
+	var embeddingResponse EmbeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&embeddingResponse); err != nil {
+		return nil, Usage{}, fmt.Errorf("error decoding response: %w", err)
+	}
+
+	// Results are not guaranteed to come back in input order
+	vectors := make([][]float32, len(texts))
+	for _, data := range embeddingResponse.Data {
+		if data.Index < 0 || data.Index >= len(vectors) {
+			return nil, Usage{}, fmt.Errorf("embedding index %d out of range", data.Index)
+		}
+		vectors[data.Index] = data.Embedding
+	}
+
+	for i, vector := range vectors {
+		if vector == nil {
+			return nil, Usage{}, fmt.Errorf("no embedding returned for input %d", i)
+		}
+	}
+
+	return vectors, embeddingResponse.Usage, nil
+}
@@ -0,0 +1,75 @@
+package llm
+
+import "encoding/json"
+
+// Response formats accepted in Params.ResponseFormat
+const (
+	ResponseFormatText = "text"
+	ResponseFormatJSON = "json"
+)
+
+// Params are the optional generation parameters of a completion. Zero
+// values leave the provider's default in place.
+type Params struct {
+	Model          string   `json:"model,omitempty"`
+	MaxTokens      int      `json:"maxTokens,omitempty"`
+	Temperature    *float64 `json:"temperature,omitempty"`
+	TopP           *float64 `json:"topP,omitempty"`
+	Stop           []string `json:"stop,omitempty"`
+	Seed           *int     `json:"seed,omitempty"`
+	ResponseFormat string   `json:"responseFormat,omitempty"`
+
+	// ResponseSchema is a JSON Schema the answer must follow. It takes
+	// precedence over ResponseFormat.
+	ResponseSchema json.RawMessage `json:"responseSchema,omitempty"`
+}
+
+// ResponseFormat selects plain text, JSON or schema-constrained JSON output
+// on the wire
+type ResponseFormat struct {
+	Type       string      `json:"type"`
+	JSONSchema *JSONSchema `json:"json_schema,omitempty"`
+}
+
+// JSONSchema names the schema of a json_schema response format
+type JSONSchema struct {
+	Name   string          `json:"name"`
+	Schema json.RawMessage `json:"schema"`
+}
+
+// Merge returns p with every parameter set in override replaced
+func (p Params) Merge(override Params) Params {
+	if override.Model != "" {
+		p.Model = override.Model
+	}
+	if override.MaxTokens != 0 {
+		p.MaxTokens = override.MaxTokens
+	}
+	if override.Temperature != nil {
+		p.Temperature = override.Temperature
+	}
+	if override.TopP != nil {
+		p.TopP = override.TopP
+	}
+	if override.Stop != nil {
+		p.Stop = override.Stop
+	}
+	if override.Seed != nil {
+		p.Seed = override.Seed
+	}
+	if override.ResponseFormat != "" {
+		p.ResponseFormat = override.ResponseFormat
+	}
+	if override.ResponseSchema != nil {
+		p.ResponseSchema = override.ResponseSchema
+	}
+	return p
+}
+
+// CompletionTokens returns the completion length that will be requested
+func (p Params) CompletionTokens() int {
+	if p.MaxTokens > 0 {
+		return p.MaxTokens
+	}
+	return DefaultMaxTokens
+}
@@ -0,0 +1,163 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/genterm/backend/internal/config"
+)
+
+// Provider translates chat and embedding requests into a vendor's wire format.
+// Requests and responses use the OpenAI-shaped types of this package; each
+// provider converts them to and from its own API. Cancelling ctx aborts the
+// upstream request.
+type Provider interface {
+	// Complete sends a chat request and waits for the full response
+	Complete(ctx context.Context, req ChatRequest) (*ChatResponse, error)
+
+	// Stream sends a chat request and calls onDelta for every content chunk.
+	// It returns the full concatenated response, including any tool calls.
+	Stream(ctx context.Context, req ChatRequest, onDelta func(string) error) (*ChatResponse, error)
+
+	// Embed returns an embedding vector for each input text, and the tokens
+	// the provider reported for them
+	Embed(ctx context.Context, model string, texts []string) ([][]float32, Usage, error)
+}
+
+// Supported provider names for Config.LLMProvider
+const (
+	ProviderOpenAI    = "openai"
+	ProviderAzure     = "azure"
+	ProviderAnthropic = "anthropic"
+	ProviderOllama    = "ollama"
+)
+
+// NewProvider creates the provider selected in the configuration
+func NewProvider(cfg *config.Config) Provider {
+	t := newTransport(cfg.LLMTimeout, cfg.LLMMaxRetries)
+
+	switch cfg.LLMProvider {
+	case ProviderAzure:
+		return newAzureProvider(cfg, t)
+	case ProviderAnthropic:
+		return newAnthropicProvider(cfg, t)
+	case ProviderOllama:
+		return newOllamaProvider(cfg, t)
+	default:
+		return newOpenAIProvider(cfg, t)
+	}
+}
+
+// streamedResponse wraps the concatenated text and tool calls of a stream in
+// a ChatResponse
+func streamedResponse(id, content string, toolCalls []ToolCall, finishReason string, usage Usage) *ChatResponse {
+	return &ChatResponse{
+		ID:     id,
+		Object: "chat.completion",
+		Choices: []Choice{
+			{
+				Message: Message{
+					Role:      "assistant",
+					Content:   content,
+					ToolCalls: toolCalls,
+				},
+				FinishReason: finishReason,
+			},
+		},
+		Usage: usage,
+	}
+}
+
+// readEvents reads a Server-Sent Events stream and calls onEvent with the
+// event name and data of every event. Returning done stops reading.
+func readEvents(body io.Reader, onEvent func(event, data string) (done bool, err error)) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	event := ""
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case line == "":
+			if len(data) == 0 {
+				event = ""
+				continue
+			}
+			done, err := onEvent(event, strings.Join(data, "\n"))
+			if err != nil || done {
+				return err
+			}
+			event = ""
+			data = nil
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimSpace(strings.TrimPrefix(line, "data:")))
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading stream: %w", err)
+	}
+
+	// Flush a final event that was not followed by a blank line
+	if len(data) > 0 {
+		_, err := onEvent(event, strings.Join(data, "\n"))
+		return err
+	}
+
+	return nil
+}
+
+// TextContent flattens message content into plain text, dropping images
+func TextContent(content interface{}) string {
+	switch c := content.(type) {
+	case string:
+		return c
+	case []ContentItem:
+		var parts []string
+		for _, item := range c {
+			if item.Type == "text" && item.Text != "" {
+				parts = append(parts, item.Text)
+			}
+		}
+		return strings.Join(parts, "\n")
+	default:
+		return ""
+	}
+}
+
+// imageURLs returns the image URLs of multimodal message content
+func imageURLs(content interface{}) []string {
+	items, ok := content.([]ContentItem)
+	if !ok {
+		return nil
+	}
+
+	var urls []string
+	for _, item := range items {
+		if item.Type == "image_url" && item.ImageURL.URL != "" {
+			urls = append(urls, item.ImageURL.URL)
+		}
+	}
+	return urls
+}
+
+// parseDataURL splits a base64 data URL into its media type and payload
+func parseDataURL(url string) (mediaType, data string, ok bool) {
+	if !strings.HasPrefix(url, "data:") {
+		return "", "", false
+	}
+
+	header, payload, found := strings.Cut(strings.TrimPrefix(url, "data:"), ",")
+	if !found || !strings.HasSuffix(header, ";base64") {
+		return "", "", false
+	}
+
+	return strings.TrimSuffix(header, ";base64"), payload, true
+}
@@ -0,0 +1,41 @@
+package llm
+
+import (
+	"unicode/utf8"
+)
+
+// DefaultMaxTokens is the completion length requested from the model
+const DefaultMaxTokens = 2000
+
+// Rough token costs used when the real tokenizer of a model is unknown
+const (
+	charsPerToken    = 4
+	tokensPerMessage = 4
+	tokensPerImage   = 800
+)
+
+// EstimateTokens approximates the number of tokens in a text. It assumes
+// about four characters per token, which is close enough for English text
+// with the common BPE tokenizers and errs on the high side for code.
+func EstimateTokens(text string) int {
+	if text == "" {
+		return 0
+	}
+	return (utf8.RuneCountInString(text) + charsPerToken - 1) / charsPerToken
+}
+
+// EstimateMessageTokens approximates the number of prompt tokens used by a
+// list of messages, including per-message overhead, attached images and the
+// names and arguments of tool calls
+func EstimateMessageTokens(messages []Message) int {
+	total := 0
+	for _, msg := range messages {
+		total += tokensPerMessage
+		total += EstimateTokens(TextContent(msg.Content))
+		total += len(imageURLs(msg.Content)) * tokensPerImage
+		for _, call := range msg.ToolCalls {
+			total += EstimateTokens(call.Function.Name) + EstimateTokens(call.Function.Arguments)
+		}
+	}
+	return total
+}
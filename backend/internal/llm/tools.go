@@ -0,0 +1,87 @@
+package llm
+
+import (
+	"context"
+)
+
+// ToolRunner provides the tools offered to the model and runs the calls it makes
+type ToolRunner interface {
+	// Tools returns the definitions sent with every request
+	Tools() []Tool
+
+	// Run executes a tool call and returns the result for the model. Errors
+	// are reported in the result, so the model can correct itself.
+	Run(ctx context.Context, call ToolCall) string
+}
+
+// ToolLoop configures a completion in which the model may call tools
+type ToolLoop struct {
+	Runner ToolRunner
+
+	// MaxIterations caps the rounds of tool calls of one turn. Once it is
+	// reached the model is asked to answer without calling more tools.
+	MaxIterations int
+
+	// OnDelta receives the text of every model call as it is generated;
+	// without it the calls are not streamed
+	OnDelta func(string) error
+
+	// OnToolCall is called before a tool is run
+	OnToolCall func(call ToolCall)
+}
+
+// CompleteWithTools generates a completion during which the model may call
+// the tools of loop.Runner. Tool results are fed back to the model until it
+// answers without calling a tool. The assistant tool calls and tool results
+// exchanged on the way are returned in the Steps of the completion, and its
+// usage covers every model call.
+func (c *Client) CompleteWithTools(ctx context.Context, messages []Message, params Params, loop ToolLoop) (*Completion, error) {
+	tools := loop.Runner.Tools()
+
+	var steps []Message
+	var usage Usage
+	for iteration := 0; ; iteration++ {
+		// Never append to the caller's slice
+		conversation := append(messages[:len(messages):len(messages)], steps...)
+
+		chatRequest := c.newRequest(conversation, params)
+		chatRequest.Tools = tools
+		last := iteration >= loop.MaxIterations
+		if last {
+			chatRequest.ToolChoice = ToolChoiceNone
+		}
+
+		completion, err := c.send(ctx, chatRequest, loop.OnDelta)
+		if err != nil {
+			return nil, err
+		}
+		usage = usage.Add(completion.Usage)
+
+		if len(completion.ToolCalls) == 0 || last {
+			completion.ToolCalls = nil
+			completion.Steps = steps
+			completion.Usage = usage
+			return completion, nil
+		}
+
+		steps = append(steps, Message{
+			Role:      "assistant",
+			Content:   completion.Content,
+			ToolCalls: completion.ToolCalls,
+		})
+		for _, call := range completion.ToolCalls {
+			if loop.OnToolCall != nil {
+				loop.OnToolCall(call)
+			}
+			steps = append(steps, Message{
+				Role:       "tool",
+				Content:    loop.Runner.Run(ctx, call),
+				ToolCallID: call.ID,
+				Name:       call.Function.Name,
+			})
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+}
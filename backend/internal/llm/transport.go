@@ -0,0 +1,153 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// Backoff bounds for retried requests
+const (
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 30 * time.Second
+)
+
+// maxErrorBodyBytes bounds how much of an error response is read
+const maxErrorBodyBytes = 64 * 1024
+
+// transport sends JSON requests to a provider and retries rate-limited,
+// transient and timed out attempts with exponential backoff. The timeout
+// applies to each attempt until the response headers arrive; reading the
+// body, which may be a long stream, is only bound by the caller's context.
+type transport struct {
+	client     *http.Client
+	timeout    time.Duration
+	maxRetries int
+}
+
+// newTransport creates a transport
+func newTransport(timeout time.Duration, maxRetries int) *transport {
+	return &transport{
+		client:     &http.Client{},
+		timeout:    timeout,
+		maxRetries: maxRetries,
+	}
+}
+
+// post sends a JSON POST request and returns the response once the upstream
+// answers 200 OK. The cancellation of ctx covers reading the body too, so
+// the caller must close it to release the request.
+func (t *transport) post(ctx context.Context, url string, headers map[string]string, payload interface{}) (*http.Response, error) {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling request: %w", err)
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := t.do(ctx, url, headers, jsonData)
+		if err == nil {
+			return resp, nil
+		}
+
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || !apiErr.Temporary() || attempt >= t.maxRetries {
+			return nil, err
+		}
+
+		delay := backoff(attempt)
+		if apiErr.RetryAfter > 0 {
+			delay = apiErr.RetryAfter
+		}
+		if delay > retryMaxDelay {
+			// The upstream asked for a longer pause than is worth waiting for
+			return nil, err
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, err
+		}
+	}
+}
+
+// do sends a single attempt of a request. The attempt is abandoned when the
+// response headers do not arrive within the timeout.
+func (t *transport) do(parent context.Context, url string, headers map[string]string, body []byte) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(parent)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	// The timer is stopped once the headers are in; if it fired first, the
+	// attempt has timed out even when a response arrived meanwhile
+	timedOut := func() bool { return false }
+	if t.timeout > 0 {
+		timer := time.AfterFunc(t.timeout, cancel)
+		timedOut = func() bool { return !timer.Stop() }
+	}
+
+	resp, err := t.client.Do(req)
+	if timedOut() {
+		if err == nil {
+			resp.Body.Close()
+		}
+		cancel()
+		if parent.Err() != nil {
+			return nil, parent.Err()
+		}
+		return nil, &APIError{Kind: ErrTimeout, Message: fmt.Sprintf("no response within %v", t.timeout)}
+	}
+	if err != nil {
+		cancel()
+		if parent.Err() != nil {
+			return nil, parent.Err()
+		}
+		return nil, &APIError{Kind: ErrUpstreamDown, Message: err.Error()}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer cancel()
+		defer resp.Body.Close()
+		bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+		return nil, newAPIError(resp, bodyBytes)
+	}
+
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// backoff returns the delay before a retry: exponential with full jitter
+func backoff(attempt int) time.Duration {
+	delay := retryBaseDelay << attempt
+	if delay <= 0 || delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// cancelOnClose releases a request's context when its body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close closes the body and cancels the request context
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
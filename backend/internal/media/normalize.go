@@ -0,0 +1,163 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+
+	// Register the GIF decoder with image.Decode
+	_ "image/gif"
+)
+
+// jpegQuality is used when re-encoding photos
+const jpegQuality = 85
+
+// maxEncodedBytes is the largest image kept as uploaded; providers reject
+// inline images of more than about 5 MB
+const maxEncodedBytes = 4 << 20
+
+// maxPixels rejects images whose decoded size would exhaust memory, no
+// matter how small the compressed file is
+const maxPixels = 50_000_000
+
+// ErrUnsupported is returned for data that is not a JPEG, PNG or GIF image
+var ErrUnsupported = errors.New("unsupported image format")
+
+// Normalized is an image ready to be stored and sent to a model
+type Normalized struct {
+	Data     []byte
+	MimeType string
+	Width    int
+	Height   int
+}
+
+// Normalize checks that data is a supported image and scales it down so
+// that neither side exceeds maxDimension. Images that already fit are kept
+// as they are unless the file is very large; others are re-encoded as JPEG,
+// or as PNG when they have transparency. A maxDimension of zero or less
+// disables scaling.
+func Normalize(data []byte, maxDimension int) (*Normalized, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupported
+	}
+	if config.Width*config.Height > maxPixels {
+		return nil, fmt.Errorf("image too large: %dx%d", config.Width, config.Height)
+	}
+
+	fits := maxDimension <= 0 || (config.Width <= maxDimension && config.Height <= maxDimension)
+	if fits && len(data) <= maxEncodedBytes {
+		return &Normalized{
+			Data:     data,
+			MimeType: "image/" + format,
+			Width:    config.Width,
+			Height:   config.Height,
+		}, nil
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid image: %w", err)
+	}
+
+	scaled := toRGBA(src)
+	width, height := config.Width, config.Height
+	if !fits {
+		width, height = fit(width, height, maxDimension)
+		scaled = downscale(scaled, width, height)
+	}
+
+	var out bytes.Buffer
+	mimeType := "image/jpeg"
+	if scaled.Opaque() {
+		err = jpeg.Encode(&out, scaled, &jpeg.Options{Quality: jpegQuality})
+	} else {
+		mimeType = "image/png"
+		err = png.Encode(&out, scaled)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error encoding image: %w", err)
+	}
+
+	return &Normalized{
+		Data:     out.Bytes(),
+		MimeType: mimeType,
+		Width:    width,
+		Height:   height,
+	}, nil
+}
+
+// fit returns the size of a width x height image scaled down so that its
+// longer side is maxDimension, keeping the aspect ratio
+func fit(width, height, maxDimension int) (int, int) {
+	if width >= height {
+		h := height * maxDimension / width
+		if h < 1 {
+			h = 1
+		}
+		return maxDimension, h
+	}
+
+	w := width * maxDimension / height
+	if w < 1 {
+		w = 1
+	}
+	return w, maxDimension
+}
+
+// toRGBA converts any image to RGBA with its origin at 0,0
+func toRGBA(src image.Image) *image.RGBA {
+	bounds := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, bounds.Min, draw.Src)
+	return dst
+}
+
+// downscale shrinks src to width x height with a box filter: every
+// destination pixel is the average of the source pixels it covers, which
+// avoids the aliasing of nearest-neighbour sampling
+func downscale(src *image.RGBA, width, height int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	srcWidth, srcHeight := src.Bounds().Dx(), src.Bounds().Dy()
+
+	for y := 0; y < height; y++ {
+		y0 := y * srcHeight / height
+		y1 := (y + 1) * srcHeight / height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+
+		for x := 0; x < width; x++ {
+			x0 := x * srcWidth / width
+			x1 := (x + 1) * srcWidth / width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += uint64(p[0])
+					g += uint64(p[1])
+					b += uint64(p[2])
+					a += uint64(p[3])
+					n++
+				}
+			}
+
+			d := dst.Pix[y*dst.Stride+x*4:]
+			d[0] = uint8(r / n)
+			d[1] = uint8(g / n)
+			d[2] = uint8(b / n)
+			d[3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
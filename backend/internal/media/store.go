@@ -0,0 +1,257 @@
+// Package media stores the images of chat sessions
+package media
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/genterm/backend/internal/diskstore"
+	"github.com/google/uuid"
+)
+
+// ErrTooManyImages is returned when a session already holds as many images
+// as its limit allows
+var ErrTooManyImages = errors.New("session has too many images")
+
+// Image is an uploaded image, normalized for sending to the model
+type Image struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name,omitempty"`
+	MimeType  string    `json:"mimeType"`
+	Width     int       `json:"width"`
+	Height    int       `json:"height"`
+	Size      int64     `json:"size"`
+	Data      []byte    `json:"-"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	// Forked sessions share the images of their source, so an image is
+	// removed only when no session refers to it any more
+	sessions map[string]bool
+}
+
+// DataURL returns the image as a base64 data URL, the form the LLM
+// providers accept inline images in
+func (img *Image) DataURL() string {
+	return "data:" + img.MimeType + ";base64," + base64.StdEncoding.EncodeToString(img.Data)
+}
+
+// storedImage is the on-disk form of an image, which includes its data
+// and the sessions referring to it
+type storedImage struct {
+	Image
+	Data     []byte   `json:"data"`
+	Sessions []string `json:"sessions"`
+}
+
+// Store holds images in memory. A store opened on a directory also writes
+// every image through to it, so images survive restarts.
+type Store struct {
+	images map[string]*Image
+	dir    *diskstore.Dir
+	mutex  sync.RWMutex
+}
+
+// NewStore creates a new image store that keeps images only in memory
+func NewStore() *Store {
+	return &Store{
+		images: make(map[string]*Image),
+	}
+}
+
+// OpenStore creates an image store backed by a directory and loads the
+// images stored in it
+func OpenStore(dir string) (*Store, error) {
+	d, err := diskstore.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Store{
+		images: make(map[string]*Image),
+		dir:    d,
+	}
+	err = d.Load(func(id string, data []byte) error {
+		var stored storedImage
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return err
+		}
+		img := stored.Image
+		img.Data = stored.Data
+		img.sessions = make(map[string]bool, len(stored.Sessions))
+		for _, sessionID := range stored.Sessions {
+			img.sessions[sessionID] = true
+		}
+		s.images[img.ID] = &img
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// persist writes an image to the directory of the store, if it has one.
+// The caller must hold the write lock.
+func (s *Store) persist(img *Image) {
+	if s.dir == nil {
+		return
+	}
+
+	stored := storedImage{Image: *img, Data: img.Data}
+	for sessionID := range img.sessions {
+		stored.Sessions = append(stored.Sessions, sessionID)
+	}
+	sort.Strings(stored.Sessions)
+	if err := s.dir.Save(img.ID, stored); err != nil {
+		log.Printf("Failed to save image %s: %v", img.ID, err)
+	}
+}
+
+// Add stores a normalized image for a session that holds fewer than max
+// images; zero disables the limit
+func (s *Store) Add(sessionID, name string, normalized *Normalized, max int) (*Image, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if max > 0 && s.count(sessionID) >= max {
+		return nil, ErrTooManyImages
+	}
+
+	img := &Image{
+		ID:        uuid.New().String(),
+		Name:      name,
+		MimeType:  normalized.MimeType,
+		Width:     normalized.Width,
+		Height:    normalized.Height,
+		Size:      int64(len(normalized.Data)),
+		Data:      normalized.Data,
+		CreatedAt: time.Now(),
+		sessions:  map[string]bool{sessionID: true},
+	}
+
+	s.images[img.ID] = img
+	s.persist(img)
+	return img, nil
+}
+
+// Get retrieves an image by ID if it belongs to the session
+func (s *Store) Get(id, sessionID string) (*Image, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	img, exists := s.images[id]
+	if !exists || !img.sessions[sessionID] {
+		return nil, false
+	}
+	return img, true
+}
+
+// List returns all images of a session, oldest first
+func (s *Store) List(sessionID string) []*Image {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var images []*Image
+	for _, img := range s.images {
+		if img.sessions[sessionID] {
+			images = append(images, img)
+		}
+	}
+
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].CreatedAt.Before(images[j].CreatedAt)
+	})
+
+	return images
+}
+
+// Share makes every image of one session available to another
+func (s *Store) Share(fromID, toID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, img := range s.images {
+		if img.sessions[fromID] {
+			img.sessions[toID] = true
+			s.persist(img)
+		}
+	}
+}
+
+// Delete removes an image from a session, and from the store once no
+// session refers to it
+func (s *Store) Delete(id, sessionID string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	img, exists := s.images[id]
+	if !exists || !img.sessions[sessionID] {
+		return false
+	}
+
+	s.release(img, sessionID)
+	return true
+}
+
+// DeleteSession removes a session from every image it refers to
+func (s *Store) DeleteSession(sessionID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, img := range s.images {
+		if img.sessions[sessionID] {
+			s.release(img, sessionID)
+		}
+	}
+}
+
+// Prune drops the references of every session for which exists returns
+// false, removing images no session refers to any more
+func (s *Store) Prune(exists func(sessionID string) bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, img := range s.images {
+		for sessionID := range img.sessions {
+			if !exists(sessionID) {
+				s.release(img, sessionID)
+			}
+		}
+	}
+}
+
+// count returns the number of images of a session. The caller must hold
+// the lock.
+func (s *Store) count(sessionID string) int {
+	n := 0
+	for _, img := range s.images {
+		if img.sessions[sessionID] {
+			n++
+		}
+	}
+	return n
+}
+
+// release drops one session's reference to an image. The caller must hold
+// the write lock.
+func (s *Store) release(img *Image, sessionID string) {
+	delete(img.sessions, sessionID)
+	if len(img.sessions) > 0 {
+		s.persist(img)
+		return
+	}
+
+	delete(s.images, img.ID)
+	if s.dir == nil {
+		return
+	}
+	if err := s.dir.Delete(img.ID); err != nil {
+		log.Printf("Failed to delete image %s: %v", img.ID, err)
+	}
+}
@@ -0,0 +1,109 @@
+package prompt
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DefaultPersona is the persona used by sessions that did not pick one
+const DefaultPersona = "default"
+
+// templateExt is the file extension of prompt templates
+const templateExt = ".tmpl"
+
+// defaultTemplate is used when the prompt directory has no default.tmpl
+const defaultTemplate = "You are a helpful assistant. Use the provided context to answer questions accurately."
+
+// Data holds the variables available to prompt templates
+type Data struct {
+	Date      string    // Current date, e.g. 2024-05-01
+	Now       time.Time // Current time
+	Model     string    // Model answering the request
+	User      string    // Authenticated user, empty without authentication
+	Title     string    // Session title
+	Documents []string  // Names of the documents attached to the session
+}
+
+// Registry holds the system prompt template of each persona
+type Registry struct {
+	templates map[string]*template.Template
+}
+
+// LoadRegistry parses every .tmpl file in dir as a persona named after the
+// file. A missing directory only provides the built-in default persona.
+func LoadRegistry(dir string) (*Registry, error) {
+	r := &Registry{
+		templates: make(map[string]*template.Template),
+	}
+
+	fallback, err := template.New(DefaultPersona).Parse(defaultTemplate)
+	if err != nil {
+		return nil, err
+	}
+	r.templates[DefaultPersona] = fallback
+
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading prompt directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != templateExt {
+			continue
+		}
+
+		name := strings.TrimSuffix(entry.Name(), templateExt)
+		text, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("error reading prompt %s: %w", name, err)
+		}
+
+		tmpl, err := template.New(name).Option("missingkey=error").Parse(string(text))
+		if err != nil {
+			return nil, fmt.Errorf("error parsing prompt %s: %w", name, err)
+		}
+		r.templates[name] = tmpl
+	}
+
+	return r, nil
+}
+
+// Has reports whether a persona exists
+func (r *Registry) Has(persona string) bool {
+	_, exists := r.templates[persona]
+	return exists
+}
+
+// Names returns the names of all personas in alphabetical order
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.templates))
+	for name := range r.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Render executes a persona's template. Unknown personas use the default.
+func (r *Registry) Render(persona string, data Data) (string, error) {
+	tmpl, exists := r.templates[persona]
+	if !exists {
+		tmpl = r.templates[DefaultPersona]
+	}
+
+	var prompt strings.Builder
+	if err := tmpl.Execute(&prompt, data); err != nil {
+		return "", fmt.Errorf("error rendering prompt %s: %w", tmpl.Name(), err)
+	}
+
+	return strings.TrimSpace(prompt.String()), nil
+}
@@ -0,0 +1,111 @@
+package quota
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrQuotaExceeded is returned when a client has used up its token quota
+var ErrQuotaExceeded = errors.New("token quota exceeded")
+
+// Status reports a client's token usage in the current day and month.
+// Periods follow UTC calendar days and months. A zero limit is unlimited.
+type Status struct {
+	DailyUsed    int64      `json:"dailyUsed"`
+	DailyLimit   int64      `json:"dailyLimit,omitempty"`
+	MonthlyUsed  int64      `json:"monthlyUsed"`
+	MonthlyLimit int64      `json:"monthlyLimit,omitempty"`
+	ResetAt      *time.Time `json:"resetAt,omitempty"`
+}
+
+// Tracker counts the LLM tokens used per client against daily and monthly
+// quotas. Usage is kept in memory and starts over when the server restarts.
+type Tracker struct {
+	daily   int64
+	monthly int64
+	usage   map[string]*usage
+	mutex   sync.Mutex
+}
+
+// usage holds the tokens used by one client in the current periods
+type usage struct {
+	day         string
+	dayTokens   int64
+	month       string
+	monthTokens int64
+}
+
+// NewTracker creates a tracker with the given daily and monthly token quotas
+func NewTracker(daily, monthly int64) *Tracker {
+	return &Tracker{
+		daily:   daily,
+		monthly: monthly,
+		usage:   make(map[string]*usage),
+	}
+}
+
+// Check returns the client's quota status, and ErrQuotaExceeded if it may
+// not make further requests until ResetAt
+func (t *Tracker) Check(key string) (Status, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now().UTC()
+	u := t.current(key, now)
+	status := Status{
+		DailyUsed:    u.dayTokens,
+		DailyLimit:   t.daily,
+		MonthlyUsed:  u.monthTokens,
+		MonthlyLimit: t.monthly,
+	}
+
+	switch {
+	case t.monthly > 0 && u.monthTokens >= t.monthly:
+		reset := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		status.ResetAt = &reset
+		return status, ErrQuotaExceeded
+	case t.daily > 0 && u.dayTokens >= t.daily:
+		reset := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+		status.ResetAt = &reset
+		return status, ErrQuotaExceeded
+	}
+
+	return status, nil
+}
+
+// Record adds tokens used by a client
+func (t *Tracker) Record(key string, tokens int) {
+	if tokens <= 0 {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	u := t.current(key, time.Now().UTC())
+	u.dayTokens += int64(tokens)
+	u.monthTokens += int64(tokens)
+}
+
+// current returns the client's usage, starting new periods as they begin
+func (t *Tracker) current(key string, now time.Time) *usage {
+	day := now.Format("2006-01-02")
+	month := now.Format("2006-01")
+
+	u, exists := t.usage[key]
+	if !exists {
+		u = &usage{day: day, month: month}
+		t.usage[key] = u
+	}
+	if u.day != day {
+		u.day = day
+		u.dayTokens = 0
+	}
+	if u.month != month {
+		u.month = month
+		u.monthTokens = 0
+	}
+
+	return u
+}
@@ -0,0 +1,107 @@
+package quota
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTracker(t *testing.T) {
+	now := time.Now().UTC()
+	tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	nextMonth := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		daily   int64
+		monthly int64
+		record  []int
+		want    Status
+		err     error
+	}{
+		{"unlimited", 0, 0, []int{1000}, Status{DailyUsed: 1000, MonthlyUsed: 1000}, nil},
+		{"under both limits", 100, 1000, []int{40, 59}, Status{DailyUsed: 99, DailyLimit: 100, MonthlyUsed: 99, MonthlyLimit: 1000}, nil},
+		{"no usage recorded", 100, 1000, nil, Status{DailyLimit: 100, MonthlyLimit: 1000}, nil},
+		{"non-positive tokens are ignored", 100, 0, []int{0, -50}, Status{DailyLimit: 100}, nil},
+		{"daily limit reached", 100, 1000, []int{60, 40}, Status{DailyUsed: 100, DailyLimit: 100, MonthlyUsed: 100, MonthlyLimit: 1000, ResetAt: &tomorrow}, ErrQuotaExceeded},
+		{"last request may overshoot", 100, 0, []int{99, 500}, Status{DailyUsed: 599, DailyLimit: 100, MonthlyUsed: 599, ResetAt: &tomorrow}, ErrQuotaExceeded},
+		{"monthly limit reached", 0, 100, []int{100}, Status{DailyUsed: 100, MonthlyUsed: 100, MonthlyLimit: 100, ResetAt: &nextMonth}, ErrQuotaExceeded},
+		{"monthly limit wins over daily", 100, 100, []int{150}, Status{DailyUsed: 150, DailyLimit: 100, MonthlyUsed: 150, MonthlyLimit: 100, ResetAt: &nextMonth}, ErrQuotaExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewTracker(tt.daily, tt.monthly)
+			for _, tokens := range tt.record {
+				tracker.Record("user:alice", tokens)
+			}
+
+			status, err := tracker.Check("user:alice")
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Check error = %v, want %v", err, tt.err)
+			}
+			if !sameStatus(status, tt.want) {
+				t.Errorf("Check = %+v, want %+v", status, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrackerClientsAreSeparate(t *testing.T) {
+	tracker := NewTracker(100, 0)
+	tracker.Record("user:alice", 100)
+
+	if _, err := tracker.Check("user:alice"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Check(alice) = %v, want %v", err, ErrQuotaExceeded)
+	}
+	if status, err := tracker.Check("user:bob"); err != nil || status.DailyUsed != 0 {
+		t.Errorf("Check(bob) = %+v, %v, want no usage", status, err)
+	}
+}
+
+func TestTrackerNewPeriods(t *testing.T) {
+	tests := []struct {
+		name        string
+		day         string
+		month       string
+		dailyUsed   int64
+		monthlyUsed int64
+	}{
+		{"same day", "", "", 100, 100},
+		{"new day", "2000-01-01", "", 0, 100},
+		{"new month", "2000-01-01", "2000-01", 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewTracker(100, 1000)
+			tracker.Record("user:alice", 100)
+
+			// Move the recorded usage into earlier periods
+			u := tracker.usage["user:alice"]
+			if tt.day != "" {
+				u.day = tt.day
+			}
+			if tt.month != "" {
+				u.month = tt.month
+			}
+
+			status, _ := tracker.Check("user:alice")
+			if status.DailyUsed != tt.dailyUsed || status.MonthlyUsed != tt.monthlyUsed {
+				t.Errorf("Check = %d daily, %d monthly, want %d, %d", status.DailyUsed, status.MonthlyUsed, tt.dailyUsed, tt.monthlyUsed)
+			}
+		})
+	}
+}
+
+// sameStatus compares two statuses, including the times they reset at
+func sameStatus(a, b Status) bool {
+	if (a.ResetAt == nil) != (b.ResetAt == nil) {
+		return false
+	}
+	if a.ResetAt != nil && !a.ResetAt.Equal(*b.ResetAt) {
+		return false
+	}
+	a.ResetAt, b.ResetAt = nil, nil
+	return a == b
+}
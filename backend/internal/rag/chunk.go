@@ -0,0 +1,70 @@
+package rag
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Chunk is a contiguous piece of a document used for retrieval
+type Chunk struct {
+	DocumentID   string `json:"documentId"`
+	DocumentName string `json:"documentName"`
+	Index        int    `json:"index"`
+	Offset       int    `json:"offset"`
+	Text         string `json:"text"`
+}
+
+// Split breaks text into chunks of roughly size runes, each overlapping the
+// previous one by overlap runes. Chunk boundaries are moved back to the
+// nearest whitespace where possible so words are not cut in half. Offsets
+// are rune offsets into the original text.
+func Split(text string, size, overlap int) []Chunk {
+	if size <= 0 {
+		return nil
+	}
+	if overlap < 0 || overlap >= size {
+		overlap = 0
+	}
+
+	runes := []rune(text)
+	var chunks []Chunk
+
+	for start := 0; start < len(runes); {
+		end := start + size
+		if end >= len(runes) {
+			end = len(runes)
+		} else if cut := lastSpace(runes[start:end]); cut > size/2 {
+			end = start + cut
+		}
+
+		if chunkText := strings.TrimSpace(string(runes[start:end])); chunkText != "" {
+			chunks = append(chunks, Chunk{
+				Index:  len(chunks),
+				Offset: start,
+				Text:   chunkText,
+			})
+		}
+
+		if end == len(runes) {
+			break
+		}
+
+		next := end - overlap
+		if next <= start {
+			next = end
+		}
+		start = next
+	}
+
+	return chunks
+}
+
+// lastSpace returns the index of the last whitespace rune, or -1
+func lastSpace(runes []rune) int {
+	for i := len(runes) - 1; i >= 0; i-- {
+		if unicode.IsSpace(runes[i]) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,242 @@
+package rag
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/genterm/backend/internal/diskstore"
+)
+
+// Result is a chunk returned by a search together with its similarity score
+type Result struct {
+	Chunk Chunk
+	Score float64
+}
+
+// entry is a chunk stored with its normalized embedding
+type entry struct {
+	chunk  Chunk
+	vector []float32
+}
+
+// storedEntries is the on-disk form of the entries of a document
+type storedEntries struct {
+	Chunks  []Chunk     `json:"chunks"`
+	Vectors [][]float32 `json:"vectors"`
+}
+
+// Index is an in-process vector index using cosine similarity. An index
+// opened on a directory also writes the entries of every document through
+// to it, so documents need not be embedded again after a restart.
+type Index struct {
+	entries map[string][]entry
+	dir     *diskstore.Dir
+	mutex   sync.RWMutex
+}
+
+// NewIndex creates a new empty index kept only in memory
+func NewIndex() *Index {
+	return &Index{
+		entries: make(map[string][]entry),
+	}
+}
+
+// OpenIndex creates an index backed by a directory and loads the entries
+// stored in it
+func OpenIndex(dir string) (*Index, error) {
+	d, err := diskstore.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := &Index{
+		entries: make(map[string][]entry),
+		dir:     d,
+	}
+	err = d.Load(func(documentID string, data []byte) error {
+		var stored storedEntries
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return err
+		}
+		entries := make([]entry, 0, len(stored.Chunks))
+		for i, chunk := range stored.Chunks {
+			if i < len(stored.Vectors) {
+				entries = append(entries, entry{chunk: chunk, vector: stored.Vectors[i]})
+			}
+		}
+		idx.entries[documentID] = entries
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return idx, nil
+}
+
+// persist writes the entries of a document to the directory of the index,
+// if it has one. The caller must hold the write lock.
+func (idx *Index) persist(documentID string) {
+	if idx.dir == nil {
+		return
+	}
+
+	entries := idx.entries[documentID]
+	stored := storedEntries{
+		Chunks:  make([]Chunk, len(entries)),
+		Vectors: make([][]float32, len(entries)),
+	}
+	for i, e := range entries {
+		stored.Chunks[i] = e.chunk
+		stored.Vectors[i] = e.vector
+	}
+	if err := idx.dir.Save(documentID, stored); err != nil {
+		log.Printf("Failed to save index entries of document %s: %v", documentID, err)
+	}
+}
+
+// Add stores the chunks of a document with their embeddings, replacing any
+// chunks previously indexed for that document
+func (idx *Index) Add(documentID string, chunks []Chunk, vectors [][]float32) {
+	entries := make([]entry, 0, len(chunks))
+	for i, chunk := range chunks {
+		if i >= len(vectors) {
+			break
+		}
+		entries = append(entries, entry{
+			chunk:  chunk,
+			vector: normalize(vectors[i]),
+		})
+	}
+
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+
+	idx.entries[documentID] = entries
+	idx.persist(documentID)
+}
+
+// Has reports whether a document has been indexed
+func (idx *Index) Has(documentID string) bool {
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+
+	_, exists := idx.entries[documentID]
+	return exists
+}
+
+// Copy indexes the chunks of one document again under another document ID
+func (idx *Index) Copy(fromID, toID string) bool {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+
+	source, exists := idx.entries[fromID]
+	if !exists {
+		return false
+	}
+
+	entries := make([]entry, len(source))
+	for i, e := range source {
+		e.chunk.DocumentID = toID
+		entries[i] = e
+	}
+
+	idx.entries[toID] = entries
+	idx.persist(toID)
+	return true
+}
+
+// Remove deletes all chunks of a document
+func (idx *Index) Remove(documentID string) {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+
+	delete(idx.entries, documentID)
+	if idx.dir == nil {
+		return
+	}
+	if err := idx.dir.Delete(documentID); err != nil {
+		log.Printf("Failed to delete index entries of document %s: %v", documentID, err)
+	}
+}
+
+// Prune removes the chunks of every document for which keep returns false
+func (idx *Index) Prune(keep func(documentID string) bool) {
+	idx.mutex.Lock()
+	var removed []string
+	for documentID := range idx.entries {
+		if !keep(documentID) {
+			removed = append(removed, documentID)
+		}
+	}
+	idx.mutex.Unlock()
+
+	for _, documentID := range removed {
+		idx.Remove(documentID)
+	}
+}
+
+// Search returns the k chunks most similar to the query vector, limited to
+// the given documents
+func (idx *Index) Search(query []float32, documentIDs []string, k int) []Result {
+	query = normalize(query)
+
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+
+	var results []Result
+	for _, id := range documentIDs {
+		for _, e := range idx.entries[id] {
+			results = append(results, Result{
+				Chunk: e.chunk,
+				Score: dot(query, e.vector),
+			})
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	if k > 0 && len(results) > k {
+		results = results[:k]
+	}
+
+	return results
+}
+
+// normalize returns a unit-length copy of v
+func normalize(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+
+	out := make([]float32, len(v))
+	if sum == 0 {
+		return out
+	}
+
+	norm := math.Sqrt(sum)
+	for i, x := range v {
+		out[i] = float32(float64(x) / norm)
+	}
+	return out
+}
+
+// dot returns the dot product of two vectors of possibly different length
+func dot(a, b []float32) float64 {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+
+	var sum float64
+	for i := 0; i < n; i++ {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
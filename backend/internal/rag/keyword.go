@@ -0,0 +1,72 @@
+package rag
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// MatchKeywords returns up to k chunks that contain the words of a query,
+// best matches first. It ranks chunks of documents that have no embeddings
+// by the number of distinct query words they contain, then by how often
+// those words occur.
+func MatchKeywords(chunks []Chunk, query string, k int) []Chunk {
+	words := keywords(query)
+	if len(words) == 0 || k <= 0 {
+		return nil
+	}
+
+	type match struct {
+		chunk       Chunk
+		distinct    int
+		occurrences int
+	}
+
+	var matches []match
+	for _, chunk := range chunks {
+		text := strings.ToLower(chunk.Text)
+		m := match{chunk: chunk}
+		for _, word := range words {
+			if n := strings.Count(text, word); n > 0 {
+				m.distinct++
+				m.occurrences += n
+			}
+		}
+		if m.distinct > 0 {
+			matches = append(matches, m)
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].distinct != matches[j].distinct {
+			return matches[i].distinct > matches[j].distinct
+		}
+		return matches[i].occurrences > matches[j].occurrences
+	})
+
+	if len(matches) > k {
+		matches = matches[:k]
+	}
+	result := make([]Chunk, len(matches))
+	for i, m := range matches {
+		result[i] = m.chunk
+	}
+	return result
+}
+
+// keywords returns the distinct lower-case words of a query, leaving out
+// words too short to be meaningful
+func keywords(query string) []string {
+	seen := make(map[string]bool)
+	var words []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len([]rune(word)) < 3 || seen[word] {
+			continue
+		}
+		seen[word] = true
+		words = append(words, word)
+	}
+	return words
+}
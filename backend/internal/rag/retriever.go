@@ -0,0 +1,134 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// embedBatchSize limits how many chunks are sent in one embeddings request
+const embedBatchSize = 64
+
+// Embedder turns texts into embedding vectors and reports the tokens the
+// texts took
+type Embedder interface {
+	CreateEmbeddings(ctx context.Context, texts []string) ([][]float32, int, error)
+}
+
+// Options controls chunking and retrieval
+type Options struct {
+	ChunkSize    int
+	ChunkOverlap int
+	TopK         int
+}
+
+// Retriever chunks and embeds documents and finds the chunks relevant to a query
+type Retriever struct {
+	embedder Embedder
+	index    *Index
+	options  Options
+}
+
+// NewRetriever creates a new retriever that keeps its chunks in index
+func NewRetriever(embedder Embedder, index *Index, options Options) *Retriever {
+	return &Retriever{
+		embedder: embedder,
+		index:    index,
+		options:  options,
+	}
+}
+
+// IndexDocument splits a document into chunks, embeds them and adds them to
+// the index. It returns the tokens embedded, including those of batches
+// embedded before a failure.
+func (r *Retriever) IndexDocument(ctx context.Context, documentID, name, content string) (int, error) {
+	chunks := Split(content, r.options.ChunkSize, r.options.ChunkOverlap)
+	for i := range chunks {
+		chunks[i].DocumentID = documentID
+		chunks[i].DocumentName = name
+	}
+
+	vectors := make([][]float32, 0, len(chunks))
+	tokens := 0
+	for start := 0; start < len(chunks); start += embedBatchSize {
+		end := start + embedBatchSize
+		if end > len(chunks) {
+			end = len(chunks)
+		}
+
+		texts := make([]string, 0, end-start)
+		for _, chunk := range chunks[start:end] {
+			texts = append(texts, chunk.Text)
+		}
+
+		batch, batchTokens, err := r.embedder.CreateEmbeddings(ctx, texts)
+		if err != nil {
+			return tokens, fmt.Errorf("error embedding %s: %w", name, err)
+		}
+		tokens += batchTokens
+		if len(batch) != len(texts) {
+			return tokens, fmt.Errorf("error embedding %s: got %d embeddings for %d chunks", name, len(batch), len(texts))
+		}
+		vectors = append(vectors, batch...)
+	}
+
+	r.index.Add(documentID, chunks, vectors)
+	return tokens, nil
+}
+
+// IsIndexed reports whether a document has been indexed
+func (r *Retriever) IsIndexed(documentID string) bool {
+	return r.index.Has(documentID)
+}
+
+// CopyDocument indexes an already indexed document under a new ID without
+// embedding it again
+func (r *Retriever) CopyDocument(fromID, toID string) bool {
+	return r.index.Copy(fromID, toID)
+}
+
+// RemoveDocument drops a document from the index
+func (r *Retriever) RemoveDocument(documentID string) {
+	r.index.Remove(documentID)
+}
+
+// Prune drops every document from the index for which keep returns false
+func (r *Retriever) Prune(keep func(documentID string) bool) {
+	r.index.Prune(keep)
+}
+
+// Retrieve returns the chunks of the given documents most relevant to the
+// query, ordered by document and position so the prompt reads naturally
+func (r *Retriever) Retrieve(ctx context.Context, query string, documentIDs []string) ([]Chunk, error) {
+	if len(documentIDs) == 0 {
+		return nil, nil
+	}
+
+	vectors, _, err := r.embedder.CreateEmbeddings(ctx, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("error embedding query: %w", err)
+	}
+	if len(vectors) == 0 {
+		return nil, fmt.Errorf("error embedding query: no embedding returned")
+	}
+
+	results := r.index.Search(vectors[0], documentIDs, r.options.TopK)
+
+	chunks := make([]Chunk, len(results))
+	for i, result := range results {
+		chunks[i] = result.Chunk
+	}
+
+	order := make(map[string]int, len(documentIDs))
+	for i, id := range documentIDs {
+		order[id] = i
+	}
+	sort.SliceStable(chunks, func(i, j int) bool {
+		if chunks[i].DocumentID != chunks[j].DocumentID {
+			return order[chunks[i].DocumentID] < order[chunks[j].DocumentID]
+		}
+		return chunks[i].Index < chunks[j].Index
+	})
+
+	return chunks, nil
+}
@@ -0,0 +1,596 @@
+// Package schema validates JSON values against a subset of JSON Schema: the
+// keywords models are asked to follow in structured output mode
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxDepth bounds the nesting of schemas and of validated values
+const maxDepth = 64
+
+// maxSteps bounds the subschema checks of one validation. Schemas come from
+// clients, and anyOf or oneOf over recursive references can otherwise take
+// exponential time.
+const maxSteps = 100000
+
+// errTooComplex is returned when a validation runs out of steps
+var errTooComplex = errors.New("schema is too complex to validate")
+
+// Schema is a parsed JSON Schema
+type Schema struct {
+	root *node
+	raw  json.RawMessage
+	doc  interface{}
+}
+
+// node is one (sub)schema. The schema false is a node with reject set.
+type node struct {
+	reject bool
+
+	types []string
+	enum  []interface{}
+	cnst  *interface{}
+
+	properties           map[string]*node
+	required             []string
+	additionalProperties *node
+	minProperties        *int
+	maxProperties        *int
+
+	items    *node
+	minItems *int
+	maxItems *int
+
+	minLength *int
+	maxLength *int
+	pattern   *regexp.Regexp
+
+	minimum          *float64
+	maximum          *float64
+	exclusiveMinimum *float64
+	exclusiveMaximum *float64
+
+	allOf []*node
+	anyOf []*node
+	oneOf []*node
+	not   *node
+
+	ref string
+}
+
+// Parse reads a JSON Schema. Keywords outside the supported subset, such as
+// format or title, are accepted and ignored; references may only point into
+// the schema itself.
+func Parse(data []byte) (*Schema, error) {
+	var doc interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+
+	p := &parser{}
+	root, err := p.parse(doc, "#", 0)
+	if err != nil {
+		return nil, err
+	}
+	// Check the targets of references now rather than at validation time;
+	// parsing them may turn up more references
+	seen := make(map[string]bool)
+	for i := 0; i < len(p.refs); i++ {
+		ref := p.refs[i]
+		if seen[ref] {
+			continue
+		}
+		seen[ref] = true
+
+		target, err := resolve(doc, ref)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.parse(target, ref, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Schema{root: root, raw: json.RawMessage(data), doc: doc}, nil
+}
+
+// Raw returns the schema as it was parsed
+func (s *Schema) Raw() json.RawMessage {
+	return s.raw
+}
+
+// Validate checks a JSON document against the schema. The error names the
+// location of the first mismatch, for example $.items[2].price.
+func (s *Schema) Validate(data []byte) error {
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	if decoder.More() {
+		return errors.New("invalid JSON: more than one value")
+	}
+
+	v := &validator{schema: s, refs: make(map[string]*node)}
+	err := v.validate(s.root, value, "$", 0)
+	// Running out of steps inside not or oneOf can look like a match
+	if v.steps > maxSteps {
+		return errTooComplex
+	}
+	return err
+}
+
+// parser turns decoded schema documents into nodes and collects the
+// references it meets
+type parser struct {
+	refs []string
+}
+
+// parse converts one schema object at the given JSON pointer
+func (p *parser) parse(value interface{}, pointer string, depth int) (*node, error) {
+	if depth > maxDepth {
+		return nil, errors.New("invalid schema: nested too deeply")
+	}
+
+	switch v := value.(type) {
+	case bool:
+		return &node{reject: !v}, nil
+	case map[string]interface{}:
+		return p.parseObject(v, pointer, depth)
+	}
+	return nil, fmt.Errorf("invalid schema at %s: expected an object", pointer)
+}
+
+// parseObject converts a schema object
+func (p *parser) parseObject(obj map[string]interface{}, pointer string, depth int) (*node, error) {
+	n := &node{}
+	var err error
+	sub := func(key string) (*node, error) {
+		value, ok := obj[key]
+		if !ok {
+			return nil, nil
+		}
+		return p.parse(value, pointer+"/"+key, depth+1)
+	}
+	list := func(key string) ([]*node, error) {
+		value, ok := obj[key]
+		if !ok {
+			return nil, nil
+		}
+		items, ok := value.([]interface{})
+		if !ok || len(items) == 0 {
+			return nil, fmt.Errorf("invalid schema at %s/%s: expected a non-empty array", pointer, key)
+		}
+		nodes := make([]*node, len(items))
+		for i, item := range items {
+			if nodes[i], err = p.parse(item, fmt.Sprintf("%s/%s/%d", pointer, key, i), depth+1); err != nil {
+				return nil, err
+			}
+		}
+		return nodes, nil
+	}
+
+	if ref, ok := obj["$ref"].(string); ok {
+		if !strings.HasPrefix(ref, "#") {
+			return nil, fmt.Errorf("invalid schema at %s: only local references are supported", pointer)
+		}
+		n.ref = ref
+		p.refs = append(p.refs, ref)
+	}
+
+	switch t := obj["type"].(type) {
+	case nil:
+	case string:
+		n.types = []string{t}
+	case []interface{}:
+		for _, item := range t {
+			name, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid schema at %s/type: expected strings", pointer)
+			}
+			n.types = append(n.types, name)
+		}
+	default:
+		return nil, fmt.Errorf("invalid schema at %s/type: expected a string or an array", pointer)
+	}
+	for _, t := range n.types {
+		switch t {
+		case "object", "array", "string", "number", "integer", "boolean", "null":
+		default:
+			return nil, fmt.Errorf("invalid schema at %s/type: unknown type %q", pointer, t)
+		}
+	}
+
+	if enum, ok := obj["enum"]; ok {
+		values, ok := enum.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid schema at %s/enum: expected an array", pointer)
+		}
+		n.enum = values
+	}
+	if c, ok := obj["const"]; ok {
+		n.cnst = &c
+	}
+
+	if props, ok := obj["properties"]; ok {
+		m, ok := props.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid schema at %s/properties: expected an object", pointer)
+		}
+		n.properties = make(map[string]*node, len(m))
+		for name, value := range m {
+			if n.properties[name], err = p.parse(value, pointer+"/properties/"+name, depth+1); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if req, ok := obj["required"]; ok {
+		names, ok := req.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid schema at %s/required: expected an array", pointer)
+		}
+		for _, item := range names {
+			name, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid schema at %s/required: expected strings", pointer)
+			}
+			n.required = append(n.required, name)
+		}
+	}
+
+	if n.additionalProperties, err = sub("additionalProperties"); err != nil {
+		return nil, err
+	}
+	if n.items, err = sub("items"); err != nil {
+		return nil, err
+	}
+	if n.not, err = sub("not"); err != nil {
+		return nil, err
+	}
+	if n.allOf, err = list("allOf"); err != nil {
+		return nil, err
+	}
+	if n.anyOf, err = list("anyOf"); err != nil {
+		return nil, err
+	}
+	if n.oneOf, err = list("oneOf"); err != nil {
+		return nil, err
+	}
+
+	for key, target := range map[string]**int{
+		"minProperties": &n.minProperties,
+		"maxProperties": &n.maxProperties,
+		"minItems":      &n.minItems,
+		"maxItems":      &n.maxItems,
+		"minLength":     &n.minLength,
+		"maxLength":     &n.maxLength,
+	} {
+		value, ok := obj[key]
+		if !ok {
+			continue
+		}
+		number, err := toFloat(value)
+		if err != nil || number < 0 || number != math.Trunc(number) {
+			return nil, fmt.Errorf("invalid schema at %s/%s: expected a non-negative integer", pointer, key)
+		}
+		limit := int(number)
+		*target = &limit
+	}
+
+	for key, target := range map[string]**float64{
+		"minimum":          &n.minimum,
+		"maximum":          &n.maximum,
+		"exclusiveMinimum": &n.exclusiveMinimum,
+		"exclusiveMaximum": &n.exclusiveMaximum,
+	} {
+		value, ok := obj[key]
+		if !ok {
+			continue
+		}
+		number, err := toFloat(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schema at %s/%s: expected a number", pointer, key)
+		}
+		*target = &number
+	}
+
+	if pattern, ok := obj["pattern"]; ok {
+		expr, ok := pattern.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid schema at %s/pattern: expected a string", pointer)
+		}
+		if n.pattern, err = regexp.Compile(expr); err != nil {
+			return nil, fmt.Errorf("invalid schema at %s/pattern: %w", pointer, err)
+		}
+	}
+
+	return n, nil
+}
+
+// resolve finds the schema a local reference such as #/$defs/item points to
+func resolve(doc interface{}, ref string) (interface{}, error) {
+	target := doc
+	path := strings.TrimPrefix(strings.TrimPrefix(ref, "#"), "/")
+	if path == "" {
+		return target, nil
+	}
+	for _, token := range strings.Split(path, "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		obj, ok := target.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid schema: cannot resolve reference %s", ref)
+		}
+		if target, ok = obj[token]; !ok {
+			return nil, fmt.Errorf("invalid schema: cannot resolve reference %s", ref)
+		}
+	}
+	return target, nil
+}
+
+// validator checks values against the nodes of a schema
+type validator struct {
+	schema *Schema
+	refs   map[string]*node
+	steps  int
+}
+
+// validate checks a value against a node
+func (v *validator) validate(n *node, value interface{}, path string, depth int) error {
+	v.steps++
+	if v.steps > maxSteps {
+		return errTooComplex
+	}
+	if depth > maxDepth {
+		return fmt.Errorf("%s: nested too deeply", path)
+	}
+	if n.reject {
+		return fmt.Errorf("%s: no value is allowed here", path)
+	}
+
+	if n.ref != "" {
+		target, err := v.resolve(n.ref)
+		if err != nil {
+			return err
+		}
+		if err := v.validate(target, value, path, depth+1); err != nil {
+			return err
+		}
+	}
+
+	if len(n.types) > 0 && !hasType(n.types, value) {
+		return fmt.Errorf("%s: expected %s, got %s", path, strings.Join(n.types, " or "), typeName(value))
+	}
+	if n.enum != nil {
+		found := false
+		for _, allowed := range n.enum {
+			if equal(allowed, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: must be one of %s", path, compact(n.enum))
+		}
+	}
+	if n.cnst != nil && !equal(*n.cnst, value) {
+		return fmt.Errorf("%s: must be %s", path, compact(*n.cnst))
+	}
+
+	switch val := value.(type) {
+	case map[string]interface{}:
+		if err := v.validateObject(n, val, path, depth); err != nil {
+			return err
+		}
+	case []interface{}:
+		if n.minItems != nil && len(val) < *n.minItems {
+			return fmt.Errorf("%s: must have at least %d items", path, *n.minItems)
+		}
+		if n.maxItems != nil && len(val) > *n.maxItems {
+			return fmt.Errorf("%s: must have at most %d items", path, *n.maxItems)
+		}
+		if n.items != nil {
+			for i, item := range val {
+				if err := v.validate(n.items, item, fmt.Sprintf("%s[%d]", path, i), depth+1); err != nil {
+					return err
+				}
+			}
+		}
+	case string:
+		length := utf8.RuneCountInString(val)
+		if n.minLength != nil && length < *n.minLength {
+			return fmt.Errorf("%s: must be at least %d characters long", path, *n.minLength)
+		}
+		if n.maxLength != nil && length > *n.maxLength {
+			return fmt.Errorf("%s: must be at most %d characters long", path, *n.maxLength)
+		}
+		if n.pattern != nil && !n.pattern.MatchString(val) {
+			return fmt.Errorf("%s: must match %s", path, n.pattern)
+		}
+	case json.Number:
+		number, _ := val.Float64()
+		if n.minimum != nil && number < *n.minimum {
+			return fmt.Errorf("%s: must be at least %g", path, *n.minimum)
+		}
+		if n.maximum != nil && number > *n.maximum {
+			return fmt.Errorf("%s: must be at most %g", path, *n.maximum)
+		}
+		if n.exclusiveMinimum != nil && number <= *n.exclusiveMinimum {
+			return fmt.Errorf("%s: must be greater than %g", path, *n.exclusiveMinimum)
+		}
+		if n.exclusiveMaximum != nil && number >= *n.exclusiveMaximum {
+			return fmt.Errorf("%s: must be less than %g", path, *n.exclusiveMaximum)
+		}
+	}
+
+	for _, sub := range n.allOf {
+		if err := v.validate(sub, value, path, depth+1); err != nil {
+			return err
+		}
+	}
+	if n.anyOf != nil {
+		var first error
+		for _, sub := range n.anyOf {
+			err := v.validate(sub, value, path, depth+1)
+			if err == nil {
+				first = nil
+				break
+			}
+			if first == nil {
+				first = err
+			}
+		}
+		if first != nil {
+			return fmt.Errorf("%s: does not match any allowed schema (%v)", path, first)
+		}
+	}
+	if n.oneOf != nil {
+		matches := 0
+		for _, sub := range n.oneOf {
+			if v.validate(sub, value, path, depth+1) == nil {
+				matches++
+			}
+		}
+		if matches != 1 {
+			return fmt.Errorf("%s: must match exactly one allowed schema, matches %d", path, matches)
+		}
+	}
+	if n.not != nil && v.validate(n.not, value, path, depth+1) == nil {
+		return fmt.Errorf("%s: matches a schema it must not match", path)
+	}
+
+	return nil
+}
+
+// validateObject checks the properties of an object
+func (v *validator) validateObject(n *node, obj map[string]interface{}, path string, depth int) error {
+	for _, name := range n.required {
+		if _, ok := obj[name]; !ok {
+			return fmt.Errorf("%s: missing required property %q", path, name)
+		}
+	}
+	if n.minProperties != nil && len(obj) < *n.minProperties {
+		return fmt.Errorf("%s: must have at least %d properties", path, *n.minProperties)
+	}
+	if n.maxProperties != nil && len(obj) > *n.maxProperties {
+		return fmt.Errorf("%s: must have at most %d properties", path, *n.maxProperties)
+	}
+
+	// Sorted, so the first error reported is always the same
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		propertyPath := path + "." + name
+		if prop, ok := n.properties[name]; ok {
+			if err := v.validate(prop, obj[name], propertyPath, depth+1); err != nil {
+				return err
+			}
+			continue
+		}
+		if n.additionalProperties != nil {
+			if n.additionalProperties.reject {
+				return fmt.Errorf("%s: unexpected property %q", path, name)
+			}
+			if err := v.validate(n.additionalProperties, obj[name], propertyPath, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resolve returns the node a reference points to. References are parsed on
+// first use, so schemas may refer to themselves.
+func (v *validator) resolve(ref string) (*node, error) {
+	if n, ok := v.refs[ref]; ok {
+		return n, nil
+	}
+
+	target, err := resolve(v.schema.doc, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{}
+	n, err := p.parse(target, ref, 0)
+	if err != nil {
+		return nil, err
+	}
+	v.refs[ref] = n
+	return n, nil
+}
+
+// hasType reports whether a decoded value is of one of the given types
+func hasType(types []string, value interface{}) bool {
+	name := typeName(value)
+	for _, t := range types {
+		if t == name || (t == "number" && name == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// typeName returns the JSON Schema type of a decoded value
+func typeName(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	case json.Number:
+		if f, err := v.Float64(); err == nil && f == math.Trunc(f) {
+			return "integer"
+		}
+		return "number"
+	}
+	return "unknown"
+}
+
+// equal compares two decoded values; numbers are compared by value
+func equal(a, b interface{}) bool {
+	if x, err := toFloat(a); err == nil {
+		y, err := toFloat(b)
+		return err == nil && x == y
+	}
+	return compact(a) == compact(b)
+}
+
+// toFloat converts a decoded JSON number
+func toFloat(value interface{}) (float64, error) {
+	number, ok := value.(json.Number)
+	if !ok {
+		return 0, errors.New("not a number")
+	}
+	return number.Float64()
+}
+
+// compact returns the JSON text of a decoded value
+func compact(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
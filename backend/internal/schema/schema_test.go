@@ -0,0 +1,133 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		value  string
+		err    string // substring of the expected error; empty for valid values
+	}{
+		{"string", `{"type": "string"}`, `"a"`, ""},
+		{"wrong type", `{"type": "string"}`, `1`, "$: expected string, got integer"},
+		{"integer is a number", `{"type": "number"}`, `3`, ""},
+		{"number is not an integer", `{"type": "integer"}`, `1.5`, "expected integer, got number"},
+		{"type list", `{"type": ["string", "null"]}`, `null`, ""},
+		{"true schema", `true`, `{"a": 1}`, ""},
+		{"false schema", `false`, `1`, "no value is allowed"},
+
+		{"required present", `{"type": "object", "required": ["a"]}`, `{"a": 1}`, ""},
+		{"required missing", `{"type": "object", "required": ["a"]}`, `{}`, `missing required property "a"`},
+		{"property type", `{"properties": {"a": {"type": "string"}}}`, `{"a": 1}`, "$.a: expected string"},
+		{"additional allowed", `{"properties": {"a": {}}}`, `{"b": 1}`, ""},
+		{"additional rejected", `{"properties": {"a": {}}, "additionalProperties": false}`, `{"b": 1}`, `unexpected property "b"`},
+		{"additional schema", `{"additionalProperties": {"type": "integer"}}`, `{"b": "x"}`, "$.b: expected integer"},
+
+		{"enum", `{"enum": ["a", 1]}`, `1`, ""},
+		{"enum number by value", `{"enum": [1]}`, `1.0`, ""},
+		{"enum mismatch", `{"enum": ["a", "b"]}`, `"c"`, `must be one of ["a","b"]`},
+		{"const", `{"const": {"x": [1]}}`, `{"x": [1]}`, ""},
+		{"const mismatch", `{"const": "a"}`, `"b"`, `must be "a"`},
+
+		{"item path", `{"items": {"properties": {"price": {"type": "integer"}}}}`, `[{"price": 1}, {"price": 1.5}]`, "$[1].price: expected integer"},
+		{"min items", `{"minItems": 2}`, `[1]`, "at least 2 items"},
+		{"max length", `{"maxLength": 2}`, `"äöü"`, "at most 2 characters"},
+		{"pattern", `{"pattern": "^[0-9]+$"}`, `"12a"`, "must match"},
+		{"minimum", `{"minimum": 1}`, `0`, "at least 1"},
+		{"exclusive maximum", `{"exclusiveMaximum": 1}`, `1`, "less than 1"},
+
+		{"ref", `{"$defs": {"n": {"type": "integer"}}, "items": {"$ref": "#/$defs/n"}}`, `[1, 2]`, ""},
+		{"ref mismatch", `{"$defs": {"n": {"type": "integer"}}, "items": {"$ref": "#/$defs/n"}}`, `[1, "x"]`, "$[1]: expected integer"},
+		{"recursive ref", `{"type": "object", "properties": {"next": {"$ref": "#"}}}`, `{"next": {"next": {}}}`, ""},
+		{"recursive ref mismatch", `{"type": "object", "properties": {"next": {"$ref": "#"}}}`, `{"next": {"next": 1}}`, "$.next.next: expected object"},
+
+		{"anyOf", `{"anyOf": [{"type": "string"}, {"type": "integer"}]}`, `1`, ""},
+		{"anyOf mismatch", `{"anyOf": [{"type": "string"}, {"type": "integer"}]}`, `true`, "does not match any allowed schema"},
+		{"oneOf", `{"oneOf": [{"type": "string"}, {"type": "integer"}]}`, `"a"`, ""},
+		{"oneOf several", `{"oneOf": [{"type": "number"}, {"type": "integer"}]}`, `1`, "matches 2"},
+		{"allOf", `{"allOf": [{"minimum": 1}, {"maximum": 3}]}`, `4`, "at most 3"},
+		{"not", `{"not": {"type": "null"}}`, `null`, "must not match"},
+
+		{"invalid JSON", `{}`, `{`, "invalid JSON"},
+		{"several values", `{}`, `1 2`, "more than one value"},
+		{"depth limit", `{"items": {"$ref": "#"}}`, strings.Repeat("[", 70) + strings.Repeat("]", 70), "nested too deeply"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse([]byte(tt.schema))
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+
+			err = s.Validate([]byte(tt.value))
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("Validate(%s) = %v, want no error", tt.value, err)
+			case tt.err != "" && err == nil:
+				t.Errorf("Validate(%s) = nil, want error containing %q", tt.value, tt.err)
+			case tt.err != "" && !strings.Contains(err.Error(), tt.err):
+				t.Errorf("Validate(%s) = %v, want error containing %q", tt.value, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		err    string
+	}{
+		{"not JSON", `{`, "invalid schema"},
+		{"not an object", `[]`, "expected an object"},
+		{"unknown type", `{"type": "date"}`, `unknown type "date"`},
+		{"bad required", `{"required": "a"}`, "expected an array"},
+		{"empty anyOf", `{"anyOf": []}`, "non-empty array"},
+		{"negative limit", `{"minItems": -1}`, "non-negative integer"},
+		{"bad pattern", `{"pattern": "("}`, "pattern"},
+		{"remote ref", `{"$ref": "https://example.com/s.json"}`, "only local references"},
+		{"missing ref target", `{"$ref": "#/$defs/x"}`, "cannot resolve reference"},
+		{"bad ref target", `{"$defs": {"x": {"type": 1}}, "$ref": "#/$defs/x"}`, "expected a string or an array"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.schema))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Parse(%s) = %v, want error containing %q", tt.schema, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestValidateBudget(t *testing.T) {
+	// Every branch recurses to the depth limit, which would take about 2^64
+	// checks without a budget
+	schemas := []string{
+		`{"$defs": {"a": {"anyOf": [{"$ref": "#/$defs/a"}, {"$ref": "#/$defs/a"}]}}, "$ref": "#/$defs/a"}`,
+		`{"$defs": {"a": {"oneOf": [{"$ref": "#/$defs/a"}, {"$ref": "#/$defs/a"}]}}, "$ref": "#/$defs/a"}`,
+		`{"$defs": {"a": {"not": {"oneOf": [{"$ref": "#/$defs/a"}, {"$ref": "#/$defs/a"}]}}}, "$ref": "#/$defs/a"}`,
+	}
+
+	for _, schema := range schemas {
+		s, err := Parse([]byte(schema))
+		if err != nil {
+			t.Fatalf("Parse: %v", err)
+		}
+
+		start := time.Now()
+		err = s.Validate([]byte(`1`))
+		if err != errTooComplex {
+			t.Errorf("Validate with %s = %v, want %v", schema, err, errTooComplex)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("Validate with %s took %v", schema, elapsed)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package session
+
+import (
+	"strings"
+
+	"github.com/genterm/backend/internal/llm"
+)
+
+// Kinds of message parts
+const (
+	PartText       = "text"
+	PartImage      = "image"
+	PartDocument   = "document"
+	PartToolCall   = "tool_call"
+	PartToolResult = "tool_result"
+)
+
+// Prefixes of llm.ContentItem references to stored files
+const (
+	imageRef    = "image:"
+	imageURLRef = "image-url:"
+	documentRef = "document:"
+)
+
+// Part is one piece of the content of a message
+type Part struct {
+	Type string `json:"type"`
+
+	// Text is set on text parts
+	Text string `json:"text,omitempty"`
+
+	// ImageID refers to a stored image; URL is set instead for remote images
+	ImageID string `json:"imageId,omitempty"`
+	URL     string `json:"url,omitempty"`
+
+	// DocumentID refers to a document the user attached to the turn
+	DocumentID string `json:"documentId,omitempty"`
+
+	ToolCall   *ToolCall   `json:"toolCall,omitempty"`
+	ToolResult *ToolResult `json:"toolResult,omitempty"`
+}
+
+// ToolCall is a tool the assistant asked to run
+type ToolCall struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// ToolResult is the output of a tool call
+type ToolResult struct {
+	CallID  string `json:"callId"`
+	Name    string `json:"name,omitempty"`
+	Content string `json:"content"`
+}
+
+// TextPart returns a text part
+func TextPart(text string) Part {
+	return Part{Type: PartText, Text: text}
+}
+
+// ImagePart returns a part referring to a stored image
+func ImagePart(imageID string) Part {
+	return Part{Type: PartImage, ImageID: imageID}
+}
+
+// DocumentPart returns a part referring to a stored document
+func DocumentPart(documentID string) Part {
+	return Part{Type: PartDocument, DocumentID: documentID}
+}
+
+// ContentParts returns the parts of a message. Messages stored before parts
+// existed have only their text content.
+func (m Message) ContentParts() []Part {
+	if len(m.Parts) > 0 || m.Content == "" {
+		return m.Parts
+	}
+	return []Part{TextPart(m.Content)}
+}
+
+// ImageIDs returns the stored images a message refers to
+func (m Message) ImageIDs() []string {
+	var ids []string
+	for _, part := range m.Parts {
+		if part.Type == PartImage && part.ImageID != "" {
+			ids = append(ids, part.ImageID)
+		}
+	}
+	return ids
+}
+
+// partsText joins the text of text parts and tool results
+func partsText(parts []Part) string {
+	var texts []string
+	for _, part := range parts {
+		switch {
+		case part.Type == PartText && part.Text != "":
+			texts = append(texts, part.Text)
+		case part.Type == PartToolResult && part.ToolResult != nil:
+			texts = append(texts, part.ToolResult.Content)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// normalize fills in whichever of Content and Parts is missing
+func (m *Message) normalize() {
+	if len(m.Parts) == 0 {
+		m.Parts = m.ContentParts()
+	} else if m.Content == "" {
+		m.Content = partsText(m.Parts)
+	}
+}
+
+// Resolver looks up the stored files that message parts refer to
+type Resolver interface {
+	// ImageURL returns the URL an image part is sent to the model as, a data
+	// URL for stored images. It returns false for images that are gone or
+	// should not be sent.
+	ImageURL(part Part) (string, bool)
+
+	// DocumentName returns the name of a stored document
+	DocumentName(documentID string) (string, bool)
+}
+
+// ToLLM converts a session message into an LLM message. Image and document
+// parts are resolved through r; items built from them keep a reference to
+// the stored file, so FromLLM restores the original parts. Text parts come
+// before tool calls in the result.
+func ToLLM(m Message, r Resolver) llm.Message {
+	msg := llm.Message{Role: m.Role}
+
+	var items []llm.ContentItem
+	plain := true
+	for _, part := range m.ContentParts() {
+		switch part.Type {
+		case PartText:
+			items = append(items, llm.ContentItem{Type: "text", Text: part.Text})
+
+		case PartImage:
+			plain = false
+			ref := imageRef + part.ImageID
+			if part.ImageID == "" {
+				ref = imageURLRef + part.URL
+			}
+			if url, ok := r.ImageURL(part); ok {
+				items = append(items, llm.ContentItem{Type: "image_url", ImageURL: llm.ImageURL{URL: url}, Ref: ref})
+				continue
+			}
+			items = append(items, llm.ContentItem{Type: "text", Text: "[image not shown]", Ref: ref})
+
+		case PartDocument:
+			plain = false
+			text := "[attached document no longer available]"
+			if name, ok := r.DocumentName(part.DocumentID); ok {
+				text = "[attached document: " + name + "]"
+			}
+			items = append(items, llm.ContentItem{Type: "text", Text: text, Ref: documentRef + part.DocumentID})
+
+		case PartToolCall:
+			if part.ToolCall != nil {
+				msg.ToolCalls = append(msg.ToolCalls, llm.ToolCall{
+					ID:   part.ToolCall.ID,
+					Type: "function",
+					Function: llm.FunctionCall{
+						Name:      part.ToolCall.Name,
+						Arguments: part.ToolCall.Arguments,
+					},
+				})
+			}
+
+		case PartToolResult:
+			if part.ToolResult != nil {
+				msg.ToolCallID = part.ToolResult.CallID
+				msg.Name = part.ToolResult.Name
+				items = append(items, llm.ContentItem{Type: "text", Text: part.ToolResult.Content})
+			}
+		}
+	}
+
+	// Plain text stays a string, which every provider and model accepts
+	switch {
+	case plain && len(items) == 1:
+		msg.Content = items[0].Text
+	case plain && len(items) == 0 && len(msg.ToolCalls) == 0:
+		msg.Content = ""
+	case len(items) > 0:
+		msg.Content = items
+	}
+	return msg
+}
+
+// FromLLM converts an LLM message into a session message, the inverse of ToLLM
+func FromLLM(msg llm.Message) Message {
+	m := Message{Role: msg.Role}
+
+	var items []llm.ContentItem
+	switch c := msg.Content.(type) {
+	case string:
+		if c != "" {
+			items = []llm.ContentItem{{Type: "text", Text: c}}
+		}
+	case []llm.ContentItem:
+		items = c
+	}
+
+	if msg.ToolCallID != "" {
+		var texts []string
+		for _, item := range items {
+			texts = append(texts, item.Text)
+		}
+		m.Parts = append(m.Parts, Part{
+			Type: PartToolResult,
+			ToolResult: &ToolResult{
+				CallID:  msg.ToolCallID,
+				Name:    msg.Name,
+				Content: strings.Join(texts, "\n"),
+			},
+		})
+		items = nil
+	}
+
+	for _, item := range items {
+		switch {
+		case strings.HasPrefix(item.Ref, imageURLRef):
+			m.Parts = append(m.Parts, Part{Type: PartImage, URL: strings.TrimPrefix(item.Ref, imageURLRef)})
+		case strings.HasPrefix(item.Ref, imageRef):
+			m.Parts = append(m.Parts, ImagePart(strings.TrimPrefix(item.Ref, imageRef)))
+		case strings.HasPrefix(item.Ref, documentRef):
+			m.Parts = append(m.Parts, DocumentPart(strings.TrimPrefix(item.Ref, documentRef)))
+		case item.Type == "image_url":
+			m.Parts = append(m.Parts, Part{Type: PartImage, URL: item.ImageURL.URL})
+		default:
+			m.Parts = append(m.Parts, TextPart(item.Text))
+		}
+	}
+
+	for _, call := range msg.ToolCalls {
+		m.Parts = append(m.Parts, Part{
+			Type: PartToolCall,
+			ToolCall: &ToolCall{
+				ID:        call.ID,
+				Name:      call.Function.Name,
+				Arguments: call.Function.Arguments,
+			},
+		})
+	}
+
+	m.Content = partsText(m.Parts)
+	return m
+}
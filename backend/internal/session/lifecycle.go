@@ -0,0 +1,175 @@
+package session
+
+import (
+	"sort"
+	"time"
+
+	"github.com/genterm/backend/internal/llm"
+	"github.com/google/uuid"
+)
+
+// Summary describes a session without its message history
+type Summary struct {
+	ID           string    `json:"id"`
+	Title        string    `json:"title"`
+	Persona      string    `json:"persona,omitempty"`
+	MessageCount int       `json:"messageCount"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+	Usage        Usage     `json:"usage"`
+}
+
+// ListSessions returns a summary of every live session of an owner, most
+// recently updated first
+func (m *Manager) ListSessions(owner string) []Summary {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	now := time.Now()
+	summaries := make([]Summary, 0, len(m.sessions))
+	for _, session := range m.sessions {
+		if session.Owner != owner || m.expired(session, now) {
+			continue
+		}
+		summaries = append(summaries, Summary{
+			ID:           session.ID,
+			Title:        session.Title,
+			Persona:      session.Persona,
+			MessageCount: len(session.Messages),
+			CreatedAt:    session.CreatedAt,
+			UpdatedAt:    session.UpdatedAt,
+			Usage:        session.Usage,
+		})
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].UpdatedAt.After(summaries[j].UpdatedAt)
+	})
+
+	return summaries
+}
+
+// DeleteSession removes a session
+func (m *Manager) DeleteSession(id string) bool {
+	m.mutex.Lock()
+	if _, exists := m.sessions[id]; !exists {
+		m.mutex.Unlock()
+		return false
+	}
+	removed := m.remove(id)
+	m.mutex.Unlock()
+
+	m.notifyRemoved([]*Session{removed})
+	return true
+}
+
+// RenameSession sets the title of a session
+func (m *Manager) RenameSession(id, title string) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	session, exists := m.sessions[id]
+	if !exists {
+		return false
+	}
+
+	session.Title = title
+	session.UpdatedAt = time.Now()
+	m.touch(id)
+	m.persist(session)
+
+	return true
+}
+
+// ClearSession removes every message from a session, keeping its documents
+func (m *Manager) ClearSession(id string) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	session, exists := m.sessions[id]
+	if !exists {
+		return false
+	}
+
+	session.Messages = []Message{}
+	session.HistorySummary = ""
+	session.SummarizedMessages = 0
+	session.UpdatedAt = time.Now()
+	m.touch(id)
+	m.persist(session)
+
+	return true
+}
+
+// SetParams replaces the generation parameters used for every turn of a session
+func (m *Manager) SetParams(id string, params llm.Params) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	session, exists := m.sessions[id]
+	if !exists {
+		return false
+	}
+
+	session.Params = params
+	session.UpdatedAt = time.Now()
+	m.persist(session)
+
+	return true
+}
+
+// ForkSession creates a new session for owner with a copy of the first upTo
+// messages of an existing one. An upTo of zero or less copies the whole
+// history. Documents are not copied; the caller attaches them to the fork.
+// Like GetSession, it returns a copy of the fork.
+func (m *Manager) ForkSession(id string, upTo int, owner string) (*Session, bool) {
+	m.mutex.Lock()
+
+	source, exists := m.sessions[id]
+	if !exists || m.expired(source, time.Now()) {
+		m.mutex.Unlock()
+		return nil, false
+	}
+
+	if upTo <= 0 || upTo > len(source.Messages) {
+		upTo = len(source.Messages)
+	}
+
+	title := source.Title
+	if title != "" {
+		title += " (fork)"
+	}
+
+	now := time.Now()
+	fork := &Session{
+		ID:          uuid.New().String(),
+		Owner:       owner,
+		Title:       title,
+		Persona:     source.Persona,
+		Params:      cloneParams(source.Params),
+		Messages:    cloneMessages(source.Messages[:upTo]),
+		DocumentIDs: []string{},
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	// A summary that reaches past the fork point would leak later turns
+	if source.SummarizedMessages <= upTo {
+		fork.HistorySummary = source.HistorySummary
+		fork.SummarizedMessages = source.SummarizedMessages
+	}
+
+	// Mark the source as used before evicting so it cannot be the one evicted
+	m.touch(id)
+	evicted := m.evictForNew()
+
+	m.sessions[fork.ID] = fork
+	m.elements[fork.ID] = m.recent.PushFront(fork.ID)
+	m.persist(fork)
+	created := fork.clone()
+
+	m.mutex.Unlock()
+	m.notifyRemoved(evicted)
+
+	return created, true
+}
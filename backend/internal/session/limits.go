@@ -0,0 +1,180 @@
+package session
+
+import (
+	"log"
+	"time"
+)
+
+// Limits bounds how long sessions live and how much they may hold.
+// A zero value disables the corresponding limit.
+type Limits struct {
+	// TTL is how long a session is kept after its last update
+	TTL time.Duration
+
+	// MaxSessions caps the number of sessions; the least recently used
+	// session is evicted to make room for a new one
+	MaxSessions int
+
+	// MaxMessages caps the messages kept per session; the oldest are dropped
+	MaxMessages int
+
+	// MaxBytes caps the total message content per session; the oldest
+	// messages are dropped until the session fits
+	MaxBytes int
+
+	// MaxDocuments caps the documents attached per session; further
+	// documents are rejected
+	MaxDocuments int
+}
+
+// OnRemove registers a function that is called with every session that is
+// expired, evicted or otherwise removed from the manager
+func (m *Manager) OnRemove(fn func(*Session)) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.onRemove = append(m.onRemove, fn)
+}
+
+// ExpireSessions removes every session whose last update is older than the
+// TTL and returns how many were removed
+func (m *Manager) ExpireSessions() int {
+	if m.limits.TTL <= 0 {
+		return 0
+	}
+
+	m.mutex.Lock()
+	now := time.Now()
+	var expired []*Session
+	for id, session := range m.sessions {
+		if m.expired(session, now) {
+			expired = append(expired, m.remove(id))
+		}
+	}
+	m.mutex.Unlock()
+
+	m.notifyRemoved(expired)
+	return len(expired)
+}
+
+// StartJanitor expires sessions in the background every interval until the
+// returned stop function is called
+func (m *Manager) StartJanitor(interval time.Duration) (stop func()) {
+	if interval <= 0 || m.limits.TTL <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			m.ExpireSessions()
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// evictForNew removes least recently used sessions until there is room for
+// one more. The caller must hold the lock.
+func (m *Manager) evictForNew() []*Session {
+	var evicted []*Session
+	for m.limits.MaxSessions > 0 && len(m.sessions) >= m.limits.MaxSessions {
+		oldest := m.recent.Back()
+		if oldest == nil {
+			break
+		}
+		evicted = append(evicted, m.remove(oldest.Value.(string)))
+	}
+	return evicted
+}
+
+// expired reports whether a session has outlived the TTL
+func (m *Manager) expired(session *Session, now time.Time) bool {
+	return m.limits.TTL > 0 && now.Sub(session.UpdatedAt) > m.limits.TTL
+}
+
+// touch marks a session as most recently used. The caller must hold the lock.
+func (m *Manager) touch(id string) {
+	if element, exists := m.elements[id]; exists {
+		m.recent.MoveToFront(element)
+	}
+}
+
+// remove deletes a session from memory and the store and returns it.
+// The caller must hold the lock and pass the result to notifyRemoved
+// after releasing it.
+func (m *Manager) remove(id string) *Session {
+	session := m.sessions[id]
+	delete(m.sessions, id)
+
+	if element, exists := m.elements[id]; exists {
+		m.recent.Remove(element)
+		delete(m.elements, id)
+	}
+
+	if err := m.store.Delete(id); err != nil {
+		// The session is gone from memory either way; a stale file is
+		// picked up again and expired on the next restart
+		log.Printf("Failed to delete session %s: %v", id, err)
+	}
+
+	return session
+}
+
+// notifyRemoved calls the OnRemove hooks for removed sessions. It must be
+// called without holding the lock.
+func (m *Manager) notifyRemoved(sessions []*Session) {
+	if len(sessions) == 0 {
+		return
+	}
+
+	m.mutex.RLock()
+	hooks := append([]func(*Session){}, m.onRemove...)
+	m.mutex.RUnlock()
+
+	for _, session := range sessions {
+		for _, hook := range hooks {
+			hook(session)
+		}
+	}
+}
+
+// enforceMessageLimits drops the oldest messages of a session until it fits
+// the message and byte caps. The newest message is always kept.
+// The caller must hold the lock.
+func (m *Manager) enforceMessageLimits(session *Session) {
+	drop := 0
+	if m.limits.MaxMessages > 0 && len(session.Messages) > m.limits.MaxMessages {
+		drop = len(session.Messages) - m.limits.MaxMessages
+	}
+
+	if m.limits.MaxBytes > 0 {
+		size := 0
+		for _, msg := range session.Messages[drop:] {
+			size += len(msg.Content)
+		}
+		for size > m.limits.MaxBytes && drop < len(session.Messages)-1 {
+			size -= len(session.Messages[drop].Content)
+			drop++
+		}
+	}
+
+	if drop > 0 {
+		session.Messages = append([]Message{}, session.Messages[drop:]...)
+
+		// The summary still describes the dropped messages, so only the
+		// count of summarized messages that remain has to shift
+		session.SummarizedMessages -= drop
+		if session.SummarizedMessages < 0 {
+			session.SummarizedMessages = 0
+		}
+	}
+}
@@ -1,70 +1,255 @@
 package session
 
 import (
+	"container/list"
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/genterm/backend/internal/llm"
 	"github.com/google/uuid"
 )
 
-// Message represents a single chat message
+var (
+	// ErrNotFound is returned for sessions that do not exist
+	ErrNotFound = errors.New("session not found")
+
+	// ErrTooManyDocuments is returned when a session already holds as many
+	// documents as its limit allows
+	ErrTooManyDocuments = errors.New("session has too many documents")
+)
+
+// Message represents a single chat message. Parts hold its full content;
+// Content is the plain text of the parts, kept for display and for clients
+// that do not read parts.
 type Message struct {
 	Role      string    `json:"role"`
 	Content   string    `json:"content"`
+	Parts     []Part    `json:"parts,omitempty"`
 	Timestamp time.Time `json:"timestamp"`
+
+	// Model and Usage are set on generated assistant messages
+	Model string `json:"model,omitempty"`
+	Usage *Usage `json:"usage,omitempty"`
+
+	// Sources are the context items an assistant message cites
+	Sources []Source `json:"sources,omitempty"`
+}
+
+// Source is a part of a document cited in an answer as [Number]
+type Source struct {
+	Number       int    `json:"number"`
+	DocumentID   string `json:"documentId"`
+	DocumentName string `json:"documentName"`
+	ChunkIndex   int    `json:"chunkIndex"`
+	Offset       int    `json:"offset"`
+	Snippet      string `json:"snippet"`
 }
 
 // Session represents a user session with conversation history
 type Session struct {
-	ID        string    `json:"id"`
-	Messages  []Message `json:"messages"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
+	ID          string     `json:"id"`
+	Owner       string     `json:"owner,omitempty"`
+	Title       string     `json:"title"`
+	Persona     string     `json:"persona,omitempty"`
+	Params      llm.Params `json:"params"`
+	Messages    []Message  `json:"messages"`
+	DocumentIDs []string   `json:"documentIds"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+
+	// HistorySummary condenses the first SummarizedMessages messages once
+	// the history no longer fits the model's context window
+	HistorySummary     string `json:"historySummary,omitempty"`
+	SummarizedMessages int    `json:"summarizedMessages,omitempty"`
+
+	// Usage totals every response generated for the session, including
+	// messages that have since been trimmed or cleared
+	Usage Usage `json:"usage"`
 }
 
 // Manager handles session creation and retrieval
 type Manager struct {
 	sessions map[string]*Session
+	store    Store
+	limits   Limits
 	mutex    sync.RWMutex
+
+	// recent orders session IDs from most to least recently used
+	recent   *list.List
+	elements map[string]*list.Element
+
+	onRemove []func(*Session)
 }
 
-// NewManager creates a new session manager
-func NewManager() *Manager {
-	return &Manager{
-		sessions: make(map[string]*Session),
+// NewManager creates a new session manager and loads existing sessions from the store
+func NewManager(store Store, limits Limits) (*Manager, error) {
+	sessions, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manager{
+		sessions: make(map[string]*Session, len(sessions)),
+		store:    store,
+		limits:   limits,
+		recent:   list.New(),
+		elements: make(map[string]*list.Element, len(sessions)),
+	}
+
+	// Oldest first, so the most recently updated session ends up in front
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].UpdatedAt.Before(sessions[j].UpdatedAt)
+	})
+	for _, session := range sessions {
+		m.sessions[session.ID] = session
+		m.elements[session.ID] = m.recent.PushFront(session.ID)
+	}
+
+	return m, nil
+}
+
+// persist writes a session to the store. The caller must hold the lock.
+func (m *Manager) persist(session *Session) {
+	if err := m.store.Save(session); err != nil {
+		log.Printf("Failed to save session %s: %v", session.ID, err)
 	}
 }
 
-// NewSession creates a new session
-func (m *Manager) NewSession() *Session {
+// NewSession creates a new session owned by a user and answered with the
+// system prompt of a persona, evicting the least recently used session when
+// the session cap has been reached. The owner is empty when authentication
+// is disabled. Like GetSession, it returns a copy.
+func (m *Manager) NewSession(owner, persona string) *Session {
 	m.mutex.Lock()
-	defer m.mutex.Unlock()
+
+	evicted := m.evictForNew()
 
 	sessionID := uuid.New().String()
 	now := time.Now()
 
 	session := &Session{
-		ID:        sessionID,
-		Messages:  []Message{},
-		CreatedAt: now,
-		UpdatedAt: now,
+		ID:          sessionID,
+		Owner:       owner,
+		Persona:     persona,
+		Messages:    []Message{},
+		DocumentIDs: []string{},
+		CreatedAt:   now,
+		UpdatedAt:   now,
 	}
 
 	m.sessions[sessionID] = session
-	return session
+	m.elements[sessionID] = m.recent.PushFront(sessionID)
+	m.persist(session)
+	created := session.clone()
+
+	m.mutex.Unlock()
+	m.notifyRemoved(evicted)
+
+	return created
 }
 
-// GetSession retrieves a session by ID
+// GetSession retrieves a copy of a session by ID. Expired sessions are not
+// returned. The copy is not updated by later changes to the session, and
+// changing it does not change the session.
 func (m *Manager) GetSession(id string) (*Session, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	session, exists := m.sessions[id]
+	if !exists || m.expired(session, time.Now()) {
+		return nil, false
+	}
+
+	m.touch(id)
+	return session.clone(), true
+}
+
+// clone returns a deep copy of a session. The caller must hold the lock.
+func (s *Session) clone() *Session {
+	c := *s
+	c.Params = cloneParams(s.Params)
+	c.DocumentIDs = append([]string{}, s.DocumentIDs...)
+	c.Messages = cloneMessages(s.Messages)
+	return &c
+}
+
+// cloneMessages returns a deep copy of messages
+func cloneMessages(messages []Message) []Message {
+	c := make([]Message, len(messages))
+	for i, msg := range messages {
+		if msg.Parts != nil {
+			msg.Parts = make([]Part, len(messages[i].Parts))
+			for j, part := range messages[i].Parts {
+				if part.ToolCall != nil {
+					call := *part.ToolCall
+					part.ToolCall = &call
+				}
+				if part.ToolResult != nil {
+					result := *part.ToolResult
+					part.ToolResult = &result
+				}
+				msg.Parts[j] = part
+			}
+		}
+		if msg.Usage != nil {
+			usage := *msg.Usage
+			msg.Usage = &usage
+		}
+		if msg.Sources != nil {
+			msg.Sources = append([]Source{}, msg.Sources...)
+		}
+		c[i] = msg
+	}
+	return c
+}
+
+// cloneParams returns a copy of params that shares no memory with it
+func cloneParams(p llm.Params) llm.Params {
+	if p.Temperature != nil {
+		temperature := *p.Temperature
+		p.Temperature = &temperature
+	}
+	if p.TopP != nil {
+		topP := *p.TopP
+		p.TopP = &topP
+	}
+	if p.Seed != nil {
+		seed := *p.Seed
+		p.Seed = &seed
+	}
+	if p.Stop != nil {
+		p.Stop = append([]string{}, p.Stop...)
+	}
+	if p.ResponseSchema != nil {
+		p.ResponseSchema = append(json.RawMessage{}, p.ResponseSchema...)
+	}
+	return p
+}
+
+// HasSession reports whether a session exists, without marking it as used
+func (m *Manager) HasSession(id string) bool {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
 
-	session, exists := m.sessions[id]
-	return session, exists
+	_, exists := m.sessions[id]
+	return exists
 }
 
 // AddMessage adds a message to a session
 func (m *Manager) AddMessage(sessionID string, role, content string) (*Message, bool) {
+	return m.AppendMessage(sessionID, Message{
+		Role:    role,
+		Content: content,
+	})
+}
+
+// AppendMessage adds a message to a session, stamping it with the current
+// time. The message's usage is added to the session's totals.
+func (m *Manager) AppendMessage(sessionID string, message Message) (*Message, bool) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
@@ -74,19 +259,22 @@ func (m *Manager) AddMessage(sessionID string, role, content string) (*Message,
 	}
 
 	now := time.Now()
-	message := Message{
-		Role:      role,
-		Content:   content,
-		Timestamp: now,
+	message.Timestamp = now
+	message.normalize()
+	if message.Usage != nil {
+		session.Usage.Add(*message.Usage)
 	}
 
 	session.Messages = append(session.Messages, message)
 	session.UpdatedAt = now
+	m.enforceMessageLimits(session)
+	m.touch(sessionID)
+	m.persist(session)
 
 	return &message, true
 }
 
-// GetMessages retrieves all messages for a session
+// GetMessages retrieves a copy of all messages for a session
 func (m *Manager) GetMessages(sessionID string) ([]Message, bool) {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
@@ -96,5 +284,111 @@ func (m *Manager) GetMessages(sessionID string) ([]Message, bool) {
 		return nil, false
 	}
 
-	return session.Messages, true
+	return cloneMessages(session.Messages), true
+}
+
+// SetHistorySummary stores a running summary covering the first count messages of a session
+func (m *Manager) SetHistorySummary(sessionID, summary string, count int) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	session, exists := m.sessions[sessionID]
+	if !exists {
+		return false
+	}
+
+	if count > len(session.Messages) {
+		count = len(session.Messages)
+	}
+	session.HistorySummary = summary
+	session.SummarizedMessages = count
+	m.persist(session)
+
+	return true
+}
+
+// AddDocument attaches a document to a session, unless the session already
+// holds as many documents as the limits allow
+func (m *Manager) AddDocument(sessionID, documentID string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	session, exists := m.sessions[sessionID]
+	if !exists {
+		return ErrNotFound
+	}
+	if m.limits.MaxDocuments > 0 && len(session.DocumentIDs) >= m.limits.MaxDocuments {
+		return ErrTooManyDocuments
+	}
+
+	session.DocumentIDs = append(session.DocumentIDs, documentID)
+	session.UpdatedAt = time.Now()
+	m.persist(session)
+
+	return nil
+}
+
+// RemoveDocument detaches a document from a session
+func (m *Manager) RemoveDocument(sessionID, documentID string) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	session, exists := m.sessions[sessionID]
+	if !exists {
+		return false
+	}
+
+	for i, id := range session.DocumentIDs {
+		if id == documentID {
+			session.DocumentIDs = append(session.DocumentIDs[:i], session.DocumentIDs[i+1:]...)
+			session.UpdatedAt = time.Now()
+			m.persist(session)
+			return true
+		}
+	}
+
+	return false
+}
+
+// PruneDocuments detaches every document for which exists returns false
+// and returns how many were detached
+func (m *Manager) PruneDocuments(exists func(sessionID, documentID string) bool) int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	pruned := 0
+	for _, session := range m.sessions {
+		kept := session.DocumentIDs[:0]
+		for _, id := range session.DocumentIDs {
+			if exists(session.ID, id) {
+				kept = append(kept, id)
+			}
+		}
+		if removed := len(session.DocumentIDs) - len(kept); removed > 0 {
+			pruned += removed
+			session.DocumentIDs = kept
+			m.persist(session)
+		}
+	}
+
+	return pruned
+}
+
+// HasDocument reports whether a document is attached to a session
+func (m *Manager) HasDocument(sessionID, documentID string) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	session, exists := m.sessions[sessionID]
+	if !exists {
+		return false
+	}
+
+	for _, id := range session.DocumentIDs {
+		if id == documentID {
+			return true
+		}
+	}
+
+	return false
 }
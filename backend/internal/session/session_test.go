@@ -0,0 +1,242 @@
+package session
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/genterm/backend/internal/llm"
+)
+
+// newManager creates a manager with sessions kept in memory
+func newManager(t *testing.T, limits Limits) *Manager {
+	t.Helper()
+	m, err := NewManager(MemoryStore{}, limits)
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	return m
+}
+
+// contents returns the contents of messages
+func contents(messages []Message) []string {
+	var texts []string
+	for _, msg := range messages {
+		texts = append(texts, msg.Content)
+	}
+	return texts
+}
+
+func TestMessageLimits(t *testing.T) {
+	tests := []struct {
+		name       string
+		limits     Limits
+		messages   []string
+		summarized int
+		want       []string
+		summary    int // summarized messages left
+	}{
+		{"unlimited", Limits{}, []string{"a", "b", "c"}, 0, []string{"a", "b", "c"}, 0},
+		{"message cap", Limits{MaxMessages: 2}, []string{"a", "b", "c"}, 0, []string{"b", "c"}, 0},
+		{"byte cap", Limits{MaxBytes: 5}, []string{"aaa", "bb", "ccc"}, 0, []string{"bb", "ccc"}, 0},
+		{"both caps", Limits{MaxMessages: 3, MaxBytes: 4}, []string{"a", "b", "cc", "dd"}, 0, []string{"cc", "dd"}, 0},
+		{"newest message is kept", Limits{MaxBytes: 2}, []string{"a", "too long"}, 0, []string{"too long"}, 0},
+		{"summary shifts", Limits{MaxMessages: 3}, []string{"a", "b", "c", "d", "e"}, 3, []string{"c", "d", "e"}, 1},
+		{"summary dropped entirely", Limits{MaxMessages: 2}, []string{"a", "b", "c", "d"}, 1, []string{"c", "d"}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newManager(t, tt.limits)
+			s := m.NewSession("", "default")
+
+			// The summary covers messages already in the session, so it is set
+			// before the last message arrives and the caps apply
+			last := len(tt.messages) - 1
+			for _, content := range tt.messages[:last] {
+				m.sessions[s.ID].Messages = append(m.sessions[s.ID].Messages, Message{Role: "user", Content: content})
+			}
+			m.SetHistorySummary(s.ID, "summary", tt.summarized)
+			if _, ok := m.AddMessage(s.ID, "user", tt.messages[last]); !ok {
+				t.Fatal("AddMessage: session not found")
+			}
+
+			got, _ := m.GetSession(s.ID)
+			if strings.Join(contents(got.Messages), ",") != strings.Join(tt.want, ",") {
+				t.Errorf("messages = %q, want %q", contents(got.Messages), tt.want)
+			}
+			if got.SummarizedMessages != tt.summary {
+				t.Errorf("SummarizedMessages = %d, want %d", got.SummarizedMessages, tt.summary)
+			}
+		})
+	}
+}
+
+func TestMaxSessions(t *testing.T) {
+	m := newManager(t, Limits{MaxSessions: 2})
+	var removed []string
+	m.OnRemove(func(s *Session) { removed = append(removed, s.ID) })
+
+	first := m.NewSession("", "default")
+	second := m.NewSession("", "default")
+	m.GetSession(first.ID) // the second session is now the least recently used
+	third := m.NewSession("", "default")
+
+	tests := []struct {
+		name   string
+		id     string
+		exists bool
+	}{
+		{"recently used", first.ID, true},
+		{"least recently used", second.ID, false},
+		{"new", third.ID, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, exists := m.GetSession(tt.id); exists != tt.exists {
+				t.Errorf("GetSession exists = %v, want %v", exists, tt.exists)
+			}
+		})
+	}
+
+	if len(removed) != 1 || removed[0] != second.ID {
+		t.Errorf("OnRemove called with %q, want [%s]", removed, second.ID)
+	}
+}
+
+func TestExpireSessions(t *testing.T) {
+	m := newManager(t, Limits{TTL: time.Hour})
+	idle := m.NewSession("", "default")
+	active := m.NewSession("", "default")
+	m.sessions[idle.ID].UpdatedAt = time.Now().Add(-2 * time.Hour)
+
+	if _, exists := m.GetSession(idle.ID); exists {
+		t.Error("GetSession returned an expired session")
+	}
+	if expired := m.ExpireSessions(); expired != 1 {
+		t.Errorf("ExpireSessions = %d, want 1", expired)
+	}
+	if m.HasSession(idle.ID) || !m.HasSession(active.ID) {
+		t.Error("ExpireSessions removed the wrong sessions")
+	}
+}
+
+func TestAddDocument(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    int
+		existing int
+		err      error
+	}{
+		{"unlimited", 0, 10, nil},
+		{"under the limit", 2, 1, nil},
+		{"at the limit", 2, 2, ErrTooManyDocuments},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newManager(t, Limits{MaxDocuments: tt.limit})
+			s := m.NewSession("", "default")
+			for i := 0; i < tt.existing; i++ {
+				m.sessions[s.ID].DocumentIDs = append(m.sessions[s.ID].DocumentIDs, "doc")
+			}
+
+			if err := m.AddDocument(s.ID, "new"); !errors.Is(err, tt.err) {
+				t.Errorf("AddDocument = %v, want %v", err, tt.err)
+			}
+		})
+	}
+
+	m := newManager(t, Limits{})
+	if err := m.AddDocument("missing", "new"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("AddDocument to a missing session = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestForkSession(t *testing.T) {
+	tests := []struct {
+		name       string
+		upTo       int
+		summarized int
+		want       []string
+		summary    string
+	}{
+		{"whole history", 0, 0, []string{"q1", "a1", "q2", "a2"}, ""},
+		{"past the end", 10, 0, []string{"q1", "a1", "q2", "a2"}, ""},
+		{"first turn", 2, 0, []string{"q1", "a1"}, ""},
+		{"summary before the fork point", 3, 2, []string{"q1", "a1", "q2"}, "summary"},
+		{"summary past the fork point", 2, 3, []string{"q1", "a1"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newManager(t, Limits{})
+			source := m.NewSession("alice", "concise")
+			m.RenameSession(source.ID, "Trip")
+			temperature := 0.5
+			m.SetParams(source.ID, llm.Params{Temperature: &temperature, Stop: []string{"END"}})
+			for i, content := range []string{"q1", "a1", "q2", "a2"} {
+				role := "user"
+				if i%2 == 1 {
+					role = "assistant"
+				}
+				m.AddMessage(source.ID, role, content)
+			}
+			m.AddDocument(source.ID, "doc")
+			if tt.summarized > 0 {
+				m.SetHistorySummary(source.ID, "summary", tt.summarized)
+			}
+
+			fork, ok := m.ForkSession(source.ID, tt.upTo, "bob")
+			if !ok {
+				t.Fatal("ForkSession: source not found")
+			}
+
+			if fork.ID == source.ID || fork.Owner != "bob" || fork.Persona != "concise" || fork.Title != "Trip (fork)" {
+				t.Errorf("fork = %s owned by %q with persona %q and title %q", fork.ID, fork.Owner, fork.Persona, fork.Title)
+			}
+			if strings.Join(contents(fork.Messages), ",") != strings.Join(tt.want, ",") {
+				t.Errorf("fork messages = %q, want %q", contents(fork.Messages), tt.want)
+			}
+			if fork.HistorySummary != tt.summary {
+				t.Errorf("fork summary = %q, want %q", fork.HistorySummary, tt.summary)
+			}
+			if len(fork.DocumentIDs) != 0 {
+				t.Errorf("fork documents = %q, want none", fork.DocumentIDs)
+			}
+
+			// The fork shares no state with its source
+			stored := m.sessions[fork.ID]
+			*stored.Params.Temperature = 1
+			stored.Params.Stop[0] = "STOP"
+			stored.Messages[0].Content = "changed"
+			original, _ := m.GetSession(source.ID)
+			if *original.Params.Temperature != 0.5 || original.Params.Stop[0] != "END" || original.Messages[0].Content != "q1" {
+				t.Error("changing the fork changed its source")
+			}
+		})
+	}
+
+	m := newManager(t, Limits{})
+	if _, ok := m.ForkSession("missing", 0, ""); ok {
+		t.Error("ForkSession of a missing session succeeded")
+	}
+}
+
+func TestGetSessionReturnsCopy(t *testing.T) {
+	m := newManager(t, Limits{})
+	s := m.NewSession("", "default")
+	m.AppendMessage(s.ID, Message{Role: "assistant", Content: "a", Usage: &Usage{TotalTokens: 1}})
+
+	got, _ := m.GetSession(s.ID)
+	got.Messages[0].Content = "changed"
+	got.Messages[0].Usage.TotalTokens = 100
+	got.DocumentIDs = append(got.DocumentIDs, "doc")
+
+	again, _ := m.GetSession(s.ID)
+	if again.Messages[0].Content != "a" || again.Messages[0].Usage.TotalTokens != 1 || len(again.DocumentIDs) != 0 {
+		t.Errorf("changing a copy changed the session: %+v", again)
+	}
+}
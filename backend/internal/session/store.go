@@ -0,0 +1,95 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/genterm/backend/internal/diskstore"
+)
+
+// Store persists sessions so they survive restarts. The Manager keeps all
+// sessions in memory and writes every change through to its Store.
+type Store interface {
+	// Load returns every stored session
+	Load() ([]*Session, error)
+
+	// Save writes a session, replacing any previous version
+	Save(session *Session) error
+
+	// Delete removes a stored session
+	Delete(id string) error
+}
+
+// Supported store kinds for OpenStore
+const (
+	StoreMemory = "memory"
+	StoreFile   = "file"
+)
+
+// OpenStore creates the store of the given kind. path is the directory used
+// by file-backed stores.
+func OpenStore(kind, path string) (Store, error) {
+	switch kind {
+	case "", StoreMemory:
+		return MemoryStore{}, nil
+	case StoreFile:
+		return NewFileStore(path)
+	default:
+		return nil, fmt.Errorf("unsupported session store: %s", kind)
+	}
+}
+
+// MemoryStore keeps sessions only in the Manager's map; nothing is persisted
+type MemoryStore struct{}
+
+// Load returns no sessions
+func (MemoryStore) Load() ([]*Session, error) { return nil, nil }
+
+// Save does nothing
+func (MemoryStore) Save(*Session) error { return nil }
+
+// Delete does nothing
+func (MemoryStore) Delete(string) error { return nil }
+
+// FileStore stores each session as a JSON file in a directory
+type FileStore struct {
+	dir *diskstore.Dir
+}
+
+// NewFileStore creates a file store, creating the directory if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	d, err := diskstore.Open(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error opening session directory: %w", err)
+	}
+
+	return &FileStore{dir: d}, nil
+}
+
+// Load reads every session file in the directory
+func (s *FileStore) Load() ([]*Session, error) {
+	var sessions []*Session
+	err := s.dir.Load(func(id string, data []byte) error {
+		var session Session
+		if err := json.Unmarshal(data, &session); err != nil {
+			return err
+		}
+		sessions = append(sessions, &session)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error loading sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// Save writes a session file
+func (s *FileStore) Save(session *Session) error {
+	return s.dir.Save(session.ID, session)
+}
+
+// Delete removes a session file
+func (s *FileStore) Delete(id string) error {
+	return s.dir.Delete(id)
+}
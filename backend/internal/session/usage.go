@@ -0,0 +1,52 @@
+package session
+
+import "time"
+
+// Usage counts the tokens used to generate responses and what they cost
+type Usage struct {
+	Requests         int     `json:"requests"`
+	PromptTokens     int     `json:"promptTokens"`
+	CompletionTokens int     `json:"completionTokens"`
+	TotalTokens      int     `json:"totalTokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// Add adds the counts of another usage to u
+func (u *Usage) Add(other Usage) {
+	u.Requests += other.Requests
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.TotalTokens += other.TotalTokens
+	u.Cost += other.Cost
+}
+
+// AddUsage charges tokens that are not tied to a message, such as history
+// summaries, to a session
+func (m *Manager) AddUsage(sessionID string, usage Usage) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	session, exists := m.sessions[sessionID]
+	if !exists {
+		return false
+	}
+
+	session.Usage.Add(usage)
+	session.UpdatedAt = time.Now()
+	m.persist(session)
+
+	return true
+}
+
+// GetUsage returns the total usage of a session
+func (m *Manager) GetUsage(sessionID string) (Usage, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	session, exists := m.sessions[sessionID]
+	if !exists {
+		return Usage{}, false
+	}
+
+	return session.Usage, true
+}
@@ -0,0 +1,217 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/genterm/backend/internal/document"
+	"github.com/genterm/backend/internal/extract"
+	"github.com/genterm/backend/internal/media"
+	"github.com/genterm/backend/internal/rag"
+)
+
+// pageRunes is the length of a page of documents without page breaks
+const pageRunes = 3000
+
+// Files gives the file tools access to the documents and images of the
+// current session
+type Files interface {
+	// Documents returns the documents of the session
+	Documents() []*document.Document
+
+	// Images returns the images of the session
+	Images() []*media.Image
+
+	// Search returns the parts of the given documents most relevant to a query
+	Search(ctx context.Context, query string, documentIDs []string) ([]rag.Chunk, error)
+}
+
+// ForSession returns a registry with every built-in tool, the file tools
+// working on the files of one session
+func ForSession(files Files) *Registry {
+	return NewRegistry(
+		Calculator(),
+		SearchDocuments(files),
+		GetDocumentPage(files),
+		ListSessionFiles(files),
+	)
+}
+
+// SearchDocuments returns the search_documents tool, which finds the
+// passages of the session's documents relevant to a query
+func SearchDocuments(files Files) Tool {
+	return Tool{
+		Name:        "search_documents",
+		Description: "Search the documents uploaded to this conversation and return the passages most relevant to a query.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"query": {"type": "string", "description": "What to look for"},
+				"document": {"type": "string", "description": "Name or ID of a single document to search; leave out to search all"}
+			},
+			"required": ["query"]
+		}`),
+		Run: func(ctx context.Context, args json.RawMessage) (string, error) {
+			var params struct {
+				Query    string `json:"query"`
+				Document string `json:"document"`
+			}
+			if err := decodeArgs(args, &params); err != nil {
+				return "", err
+			}
+			if strings.TrimSpace(params.Query) == "" {
+				return "", errors.New("query is required")
+			}
+
+			var ids []string
+			if params.Document != "" {
+				doc, err := findDocument(files, params.Document)
+				if err != nil {
+					return "", err
+				}
+				ids = []string{doc.ID}
+			} else {
+				for _, doc := range files.Documents() {
+					ids = append(ids, doc.ID)
+				}
+			}
+			if len(ids) == 0 {
+				return "No documents have been uploaded.", nil
+			}
+
+			chunks, err := files.Search(ctx, params.Query, ids)
+			if err != nil {
+				return "", err
+			}
+			if len(chunks) == 0 {
+				return "No matching passages found.", nil
+			}
+
+			var result strings.Builder
+			for _, chunk := range chunks {
+				fmt.Fprintf(&result, "[File: %s, part %d]\n%s\n\n", chunk.DocumentName, chunk.Index+1, chunk.Text)
+			}
+			return strings.TrimSpace(result.String()), nil
+		},
+	}
+}
+
+// GetDocumentPage returns the get_document_page tool, which reads one page
+// of a document. PDF files have their own pages; other documents are split
+// into pages of about pageRunes characters.
+func GetDocumentPage(files Files) Tool {
+	return Tool{
+		Name:        "get_document_page",
+		Description: "Read one page of a document uploaded to this conversation. PDF files are read by their own pages; other files are split into pages of about 3000 characters.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"document": {"type": "string", "description": "Name or ID of the document"},
+				"page": {"type": "integer", "minimum": 1, "description": "Page number, starting at 1"}
+			},
+			"required": ["document", "page"]
+		}`),
+		Run: func(ctx context.Context, args json.RawMessage) (string, error) {
+			var params struct {
+				Document string `json:"document"`
+				Page     int    `json:"page"`
+			}
+			if err := decodeArgs(args, &params); err != nil {
+				return "", err
+			}
+
+			doc, err := findDocument(files, params.Document)
+			if err != nil {
+				return "", err
+			}
+
+			pages := Pages(doc.Content)
+			if params.Page < 1 || params.Page > len(pages) {
+				return "", fmt.Errorf("page %d does not exist, %s has %d pages", params.Page, doc.Name, len(pages))
+			}
+
+			text := pages[params.Page-1]
+			if text == "" {
+				text = "[This page has no text]"
+			}
+			return fmt.Sprintf("%s, page %d of %d:\n\n%s", doc.Name, params.Page, len(pages), text), nil
+		},
+	}
+}
+
+// ListSessionFiles returns the list_session_files tool, which lists the
+// documents and images of the session
+func ListSessionFiles(files Files) Tool {
+	return Tool{
+		Name:        "list_session_files",
+		Description: "List the documents and images uploaded to this conversation, with their IDs, types, sizes and page counts.",
+		Parameters:  json.RawMessage(`{"type": "object", "properties": {}}`),
+		Run: func(ctx context.Context, args json.RawMessage) (string, error) {
+			documents := files.Documents()
+			images := files.Images()
+			if len(documents) == 0 && len(images) == 0 {
+				return "No files have been uploaded.", nil
+			}
+
+			var result strings.Builder
+			if len(documents) > 0 {
+				result.WriteString("Documents:\n")
+				for _, doc := range documents {
+					fmt.Fprintf(&result, "- %s (id %s, %s, %d bytes, %d pages)\n",
+						doc.Name, doc.ID, doc.MimeType, doc.Size, len(Pages(doc.Content)))
+				}
+			}
+			if len(images) > 0 {
+				result.WriteString("Images:\n")
+				for _, img := range images {
+					name := img.Name
+					if name == "" {
+						name = "image"
+					}
+					fmt.Fprintf(&result, "- %s (id %s, %s, %dx%d)\n", name, img.ID, img.MimeType, img.Width, img.Height)
+				}
+			}
+			return strings.TrimSpace(result.String()), nil
+		},
+	}
+}
+
+// Pages splits the text of a document into pages
+func Pages(content string) []string {
+	if strings.Contains(content, extract.PageBreak) {
+		pages := strings.Split(content, extract.PageBreak)
+		for i := range pages {
+			pages[i] = strings.TrimSpace(pages[i])
+		}
+		return pages
+	}
+
+	chunks := rag.Split(content, pageRunes, 0)
+	if len(chunks) == 0 {
+		return []string{""}
+	}
+	pages := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		pages[i] = chunk.Text
+	}
+	return pages
+}
+
+// findDocument looks a document up by ID or, ignoring case, by name
+func findDocument(files Files, nameOrID string) (*document.Document, error) {
+	documents := files.Documents()
+	for _, doc := range documents {
+		if doc.ID == nameOrID {
+			return doc, nil
+		}
+	}
+	for _, doc := range documents {
+		if strings.EqualFold(doc.Name, nameOrID) {
+			return doc, nil
+		}
+	}
+	return nil, fmt.Errorf("no document named %q", nameOrID)
+}
@@ -0,0 +1,113 @@
+// Package tools holds the server-side tools the model may call during a turn
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/genterm/backend/internal/llm"
+)
+
+// maxResultRunes limits how much of a tool result is sent back to the model
+const maxResultRunes = 8000
+
+// Tool is a function the model may call
+type Tool struct {
+	Name        string
+	Description string
+
+	// Parameters is the JSON Schema of the arguments object
+	Parameters json.RawMessage
+
+	// Run executes the tool with the JSON encoded arguments of a call
+	Run func(ctx context.Context, args json.RawMessage) (string, error)
+}
+
+// Registry holds the tools offered to the model. It implements
+// llm.ToolRunner.
+type Registry struct {
+	tools map[string]Tool
+}
+
+// NewRegistry creates a registry holding the given tools
+func NewRegistry(tools ...Tool) *Registry {
+	r := &Registry{
+		tools: make(map[string]Tool),
+	}
+	for _, tool := range tools {
+		r.Register(tool)
+	}
+	return r
+}
+
+// Register adds a tool, replacing any tool of the same name
+func (r *Registry) Register(tool Tool) {
+	r.tools[tool.Name] = tool
+}
+
+// Names returns the names of all tools in alphabetical order
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.tools))
+	for name := range r.tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Tools returns the definitions of all tools in the form sent to the model
+func (r *Registry) Tools() []llm.Tool {
+	var definitions []llm.Tool
+	for _, name := range r.Names() {
+		tool := r.tools[name]
+		definitions = append(definitions, llm.Tool{
+			Type: "function",
+			Function: llm.ToolFunction{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+	return definitions
+}
+
+// Run executes a tool call. Unknown tools, invalid arguments and failures
+// are reported to the model as the result of the call.
+func (r *Registry) Run(ctx context.Context, call llm.ToolCall) string {
+	tool, exists := r.tools[call.Function.Name]
+	if !exists {
+		return fmt.Sprintf("Error: unknown tool %q", call.Function.Name)
+	}
+
+	args := json.RawMessage(call.Function.Arguments)
+	if strings.TrimSpace(call.Function.Arguments) == "" {
+		args = json.RawMessage("{}")
+	}
+	if !json.Valid(args) {
+		return "Error: the arguments are not valid JSON"
+	}
+
+	result, err := tool.Run(ctx, args)
+	if err != nil {
+		log.Printf("Tool %s failed: %v", tool.Name, err)
+		return "Error: " + err.Error()
+	}
+
+	if runes := []rune(result); len(runes) > maxResultRunes {
+		result = string(runes[:maxResultRunes]) + "\n[truncated]"
+	}
+	return result
+}
+
+// decodeArgs decodes the arguments of a call into v
+func decodeArgs(args json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(args, v); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+// Package wire defines the JSON request and response bodies of the HTTP API.
+// It is shared by the server and the genterm client, so the client does not
+// have to link the server.
+package wire
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/genterm/backend/internal/config"
+	"github.com/genterm/backend/internal/document"
+	"github.com/genterm/backend/internal/llm"
+	"github.com/genterm/backend/internal/media"
+	"github.com/genterm/backend/internal/quota"
+	"github.com/genterm/backend/internal/session"
+)
+
+// SessionRequest is the structure for session requests
+type SessionRequest struct {
+	Action  string `json:"action"`
+	ID      string `json:"id,omitempty"`
+	Title   string `json:"title,omitempty"`
+	UpTo    int    `json:"upTo,omitempty"`
+	Persona string `json:"persona,omitempty"`
+
+	// Params are merged into the session's generation parameters by the
+	// set action; leaving them out resets the parameters to the defaults
+	Params *llm.Params `json:"params,omitempty"`
+}
+
+// SessionResponse is the structure for session responses
+type SessionResponse struct {
+	ID       string            `json:"id,omitempty"`
+	Title    string            `json:"title,omitempty"`
+	Persona  string            `json:"persona,omitempty"`
+	Params   *llm.Params       `json:"params,omitempty"`
+	Messages []session.Message `json:"messages,omitempty"`
+	Sessions []session.Summary `json:"sessions,omitempty"`
+	Personas []string          `json:"personas,omitempty"`
+}
+
+// MessageContent represents the different types of content in a message
+type MessageContent struct {
+	Type     string   `json:"type"`
+	Text     string   `json:"text,omitempty"`
+	ImageURL ImageURL `json:"image_url,omitempty"`
+}
+
+// ImageURL represents an image URL object
+type ImageURL struct {
+	URL string `json:"url"`
+}
+
+// ChatRequest is the structure for chat requests
+type ChatRequest struct {
+	SessionID      string           `json:"sessionId"`
+	Query          string           `json:"query"`
+	Context        []string         `json:"context"`
+	DocumentIDs    []string         `json:"documentIds,omitempty"`
+	MessageContent []MessageContent `json:"messageContent,omitempty"`
+	ImageIDs       []string         `json:"imageIds,omitempty"`
+	Stream         bool             `json:"stream,omitempty"`
+
+	// Generation parameters for this turn only, on top of the session's
+	llm.Params
+}
+
+// ChatResponse is the structure for chat responses
+type ChatResponse struct {
+	SessionID string           `json:"sessionId"`
+	Response  string           `json:"response"`
+	Sources   []session.Source `json:"sources,omitempty"`
+
+	// Data is the parsed answer of requests with a response schema
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// StreamDelta is sent for every token chunk of a streamed response
+type StreamDelta struct {
+	Delta string `json:"delta"`
+}
+
+// ToolEvent is sent as a tool event whenever the model calls a tool
+type ToolEvent struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// CancelRequest is the structure for cancel requests
+type CancelRequest struct {
+	SessionID string `json:"sessionId"`
+}
+
+// CancelResponse is the structure for cancel responses
+type CancelResponse struct {
+	SessionID string `json:"sessionId"`
+	Cancelled bool   `json:"cancelled"`
+}
+
+// ErrorResponse is the JSON body returned when a request fails
+type ErrorResponse struct {
+	Error      string        `json:"error"`
+	Code       string        `json:"code"`
+	RetryAfter int           `json:"retryAfter,omitempty"`
+	Quota      *quota.Status `json:"quota,omitempty"`
+}
+
+// DocumentUploadRequest is the JSON form of a document upload. Either the
+// extracted text is sent as content, or the raw file as base64 data.
+type DocumentUploadRequest struct {
+	SessionID string `json:"sessionId"`
+	Name      string `json:"name"`
+	MimeType  string `json:"mimeType"`
+	Content   string `json:"content"`
+	Data      []byte `json:"data,omitempty"`
+}
+
+// DocumentResponse is the structure for document responses
+type DocumentResponse struct {
+	Document *document.Document `json:"document,omitempty"`
+}
+
+// DocumentListResponse is the structure for document list responses
+type DocumentListResponse struct {
+	Documents []*document.Document `json:"documents"`
+}
+
+// ImageUploadRequest is the JSON form of an image upload
+type ImageUploadRequest struct {
+	SessionID string `json:"sessionId"`
+	Name      string `json:"name"`
+	Data      []byte `json:"data"`
+}
+
+// ImageResponse is the structure for image responses
+type ImageResponse struct {
+	Image *media.Image `json:"image,omitempty"`
+}
+
+// ImageListResponse is the structure for image list responses
+type ImageListResponse struct {
+	Images []*media.Image `json:"images"`
+}
+
+// UsageResponse is the structure for usage responses. Without a session ID
+// it reports the totals of every request of the client since the server
+// started, or of all clients, which are then also listed one by one.
+type UsageResponse struct {
+	SessionID string                   `json:"sessionId,omitempty"`
+	Usage     session.Usage            `json:"usage"`
+	Models    map[string]session.Usage `json:"models,omitempty"`
+	Clients   map[string]session.Usage `json:"clients,omitempty"`
+	Since     *time.Time               `json:"since,omitempty"`
+}
+
+// ModelsResponse is the structure for model list responses
+type ModelsResponse struct {
+	Default string             `json:"default"`
+	Models  []config.ModelInfo `json:"models"`
+}
+
+// CreateSessionRequest is the body of POST /api/v1/sessions
+type CreateSessionRequest struct {
+	Persona string `json:"persona,omitempty"`
+}
@@ -3,6 +3,9 @@ import FileUploader from './components/FileUploader';
 import sessionService from './services/sessionService';
 import chatService from './services/chatService';
 import fileService from './services/fileService';
+import documentService from './services/documentService';
+import imageService from './services/imageService';
+import authService from './services/authService';
 import './App.css';
 
 function App() {
@@ -17,10 +20,28 @@ function App() {
   const terminalRef = useRef(null);
   const initializedRef = useRef(false);
 
+  // Names accepted by /set and how their values are parsed
+  const sessionParams = {
+    model: { key: 'model', parse: value => value },
+    temperature: { key: 'temperature', parse: Number },
+    top_p: { key: 'topP', parse: Number },
+    max_tokens: { key: 'maxTokens', parse: value => parseInt(value, 10) },
+    seed: { key: 'seed', parse: value => parseInt(value, 10) },
+    stop: { key: 'stop', parse: value => value.split(',').map(stop => stop.trim()) },
+    format: { key: 'responseFormat', parse: value => value }
+  };
+
   const addToTerminal = (text, type = 'system') => {
     setTerminalHistory(prev => [...prev, { text, type }]);
   };
 
+  const appendToLastLine = (text) => {
+    setTerminalHistory(prev => {
+      const last = prev[prev.length - 1];
+      return [...prev.slice(0, -1), { ...last, text: last.text + text }];
+    });
+  };
+
   const createSession = useCallback(async () => {
     try {
       const id = await sessionService.createSession();
@@ -72,6 +93,23 @@ function App() {
     }
   }, [terminalHistory]);
 
+  // Ctrl+C cancels the running query. The input is disabled while a query
+  // runs, so listen on the window instead.
+  useEffect(() => {
+    if (!isProcessing || !sessionId) return undefined;
+
+    const handleInterrupt = (e) => {
+      if (e.ctrlKey && e.key === 'c' && !window.getSelection().toString()) {
+        e.preventDefault();
+        addToTerminal('^C', 'system');
+        chatService.cancelQuery(sessionId);
+      }
+    };
+
+    window.addEventListener('keydown', handleInterrupt);
+    return () => window.removeEventListener('keydown', handleInterrupt);
+  }, [isProcessing, sessionId]);
+
   const handleInputChange = (e) => {
     setCurrentInput(e.target.value);
   };
@@ -128,6 +166,21 @@ function App() {
       return;
     }
 
+    if (command === '/set' || command.startsWith('/set ')) {
+      await setParam(command.slice('/set'.length).trim());
+      return;
+    }
+
+    if (command === 'persona' || command.startsWith('persona ')) {
+      await switchPersona(command.slice('persona'.length).trim());
+      return;
+    }
+
+    if (command.startsWith('login ')) {
+      login(command.slice('login '.length).trim());
+      return;
+    }
+
     switch (command) {
       case 'clear':
         setTerminalHistory([]);
@@ -141,6 +194,16 @@ function App() {
       case 'source':
         showSource();
         break;
+      case 'usage':
+        await showUsage();
+        break;
+      case 'models':
+        await listModels();
+        break;
+      case 'logout':
+        authService.clearKey();
+        addToTerminal('API key removed.', 'system');
+        break;
       default:
         await processQuery(command);
         break;
@@ -152,11 +215,114 @@ function App() {
     addToTerminal('clear - Clear the terminal', 'system');
     addToTerminal('files - List uploaded files', 'system');
     addToTerminal('source - Show source code', 'system');
+    addToTerminal('usage - Show tokens and cost of this session', 'system');
+    addToTerminal('models - List models available with /set model', 'system');
+    addToTerminal('persona [name] - List personas, or start a new session with one', 'system');
+    addToTerminal(`/set <name> <value> - Set ${Object.keys(sessionParams).join(', ')} for this session`, 'system');
+    addToTerminal('/set reset - Restore the default parameters', 'system');
+    addToTerminal('login <key> - Authenticate with an API key', 'system');
+    addToTerminal('logout - Remove the stored API key', 'system');
     addToTerminal('Type "help" to display this list of commands.', 'system');
+    addToTerminal('Press Ctrl+C to cancel a running query.', 'system');
     addToTerminal('', 'system');
     addToTerminal('Any other input will be treated as a question for the AI.', 'system');
   };
 
+  const setParam = async (args) => {
+    if (!sessionId) {
+      addToTerminal('No active session. Please refresh the page.', 'error');
+      return;
+    }
+
+    const [name, ...rest] = args.split(/\s+/);
+    const value = rest.join(' ');
+    let params = null;
+    if (name !== 'reset') {
+      const param = sessionParams[name];
+      if (!param || !value) {
+        addToTerminal(`Usage: /set <${Object.keys(sessionParams).join('|')}> <value> or /set reset`, 'error');
+        return;
+      }
+      const parsed = param.parse(value);
+      if (typeof parsed === 'number' && Number.isNaN(parsed)) {
+        addToTerminal(`Error: ${name} must be a number`, 'error');
+        return;
+      }
+      params = { [param.key]: parsed };
+    }
+
+    try {
+      const updated = await sessionService.setParams(sessionId, params);
+      const entries = Object.entries(updated);
+      addToTerminal(entries.length === 0
+        ? 'Using default parameters.'
+        : `Parameters: ${entries.map(([key, val]) => `${key}=${JSON.stringify(val)}`).join(' ')}`, 'system');
+    } catch (error) {
+      addToTerminal(`Error: ${error.message}`, 'error');
+    }
+  };
+
+  const switchPersona = async (persona) => {
+    try {
+      if (!persona) {
+        const personas = await sessionService.listPersonas();
+        addToTerminal(`Personas: ${personas.join(', ')}`, 'system');
+        return;
+      }
+
+      const id = await sessionService.createSession(persona);
+      setSessionId(id);
+      setUploadedFiles([]);
+      addToTerminal(`Session connected: ${id} (persona: ${persona})`, 'system');
+    } catch (error) {
+      addToTerminal(`Error: ${error.message}`, 'error');
+    }
+  };
+
+  const login = async (key) => {
+    if (!key) {
+      addToTerminal('Usage: login <key>', 'error');
+      return;
+    }
+
+    // Sessions belong to the user they were created by, so start a new one
+    authService.setKey(key);
+    addToTerminal('API key stored.', 'system');
+    setUploadedFiles([]);
+    await createSession();
+  };
+
+  const listModels = async () => {
+    try {
+      const { default: defaultModel, models } = await sessionService.listModels();
+      addToTerminal('Available Models:', 'system');
+      models.forEach(model => {
+        const details = [model.provider, `${model.contextWindow} tokens`];
+        if (model.vision) details.push('images');
+        if (model.name === defaultModel) details.push('default');
+        addToTerminal(` - ${model.name} (${details.join(', ')})`, 'system');
+      });
+    } catch (error) {
+      addToTerminal(`Error: ${error.message}`, 'error');
+    }
+  };
+
+  const showUsage = async () => {
+    if (!sessionId) {
+      addToTerminal('No active session. Please refresh the page.', 'error');
+      return;
+    }
+
+    try {
+      const usage = await sessionService.getUsage(sessionId);
+      addToTerminal(`Requests: ${usage.requests}`, 'system');
+      addToTerminal(`Tokens: ${usage.totalTokens} (${usage.promptTokens} prompt, ${usage.completionTokens} completion)`, 'system');
+      addToTerminal(`Cost: $${usage.cost.toFixed(4)}`, 'system');
+    } catch (error) {
+      addToTerminal(`Error: ${error.message}`, 'error');
+    }
+  };
+
   const listFiles = () => {
     if (uploadedFiles.length === 0) {
       addToTerminal('No files uploaded.', 'system');
@@ -173,6 +339,15 @@ function App() {
     addToTerminal('Source Code: https://github.com/brij2001/GenTerm', 'system');
   };
 
+  // Print the document parts an answer cites as footnotes
+  const printSources = (sources) => {
+    if (!sources || sources.length === 0) return;
+    addToTerminal('Sources:', 'system');
+    sources.forEach(source => {
+      addToTerminal(`[${source.number}] ${source.documentName}, part ${source.chunkIndex + 1}: ${source.snippet}`, 'system');
+    });
+  };
+
   const processQuery = async (query) => {
     if (!sessionId) {
       addToTerminal('No active session. Please refresh the page.', 'error');
@@ -183,45 +358,33 @@ function App() {
     addToTerminal(`Processing query... ${uploadedFiles.length} files in context.`, 'system');
 
     try {
-      // Extract context from files
-      const contexts = await Promise.all(
-        uploadedFiles.map(file => fileService.extractContent(file))
-      );
-
-      const flattenedContext = contexts
-        .filter(content => content) // Remove nulls
-        .map((content, index) => `[File: ${uploadedFiles[index].name}]\n${content}`)
-        .join('\n\n');
-
-      // Check if there's an image selected for this query
-      const imageFiles = uploadedFiles.filter(file => 
-        file.type.includes('image/') || file.name.match(/\.(jpg|jpeg|png)$/i)
-      );
-      
-      let response;
-      
-      if (imageFiles.length > 0 && query.toLowerCase().includes('image')) {
-        // Get the last uploaded image file
-        const imageFile = imageFiles[imageFiles.length - 1];
-        addToTerminal(`Processing image: ${imageFile.name}...`, 'system');
-        
-        // Convert image to base64
-        const base64Image = await fileService.imageToBase64(imageFile);
-        
-        // Get AI response with image
-        addToTerminal('Analyzing image...', 'system');
-        response = await chatService.sendImageQuery(sessionId, query, base64Image, flattenedContext);
-      } else {
-        // Regular text query
-        addToTerminal('Thinking...', 'system');
-        response = await chatService.sendQuery(sessionId, query, flattenedContext);
-      }
-      
-      // Display response
+      // Documents are stored on the server and referenced by ID
+      const documentIds = uploadedFiles
+        .filter(file => file.documentId)
+        .map(file => file.documentId);
+
+      // Images are sent with the first query after their upload; the server
+      // keeps them in the session and resends them with follow-up questions
+      const newImages = uploadedFiles.filter(file => file.imageId && !file.imageSent);
+      const imageIds = newImages.map(file => file.imageId);
+      newImages.forEach(file => {
+        addToTerminal(`Attaching image: ${file.name}`, 'system');
+      });
+
+      // Streamed into the terminal as it arrives
+      addToTerminal('Thinking...', 'system');
       addToTerminal('AI Response:', 'system');
       addToTerminal('------------', 'system');
-      addToTerminal(response, 'assistant');
-      
+      addToTerminal('', 'assistant');
+      const { sources } = await chatService.streamQuery(sessionId, query, documentIds, imageIds, appendToLastLine, (tool) => {
+        // The answer continues on a fresh line after the tool note
+        addToTerminal(`Using tool: ${tool.name}`, 'system');
+        addToTerminal('', 'assistant');
+      });
+      newImages.forEach(file => {
+        file.imageSent = true;
+      });
+      printSources(sources);
     } catch (error) {
       console.error('Error processing query:', error);
       addToTerminal(`Error: ${error.message || 'Failed to process query'}`, 'error');
@@ -230,11 +393,36 @@ function App() {
     }
   };
 
-  const handleFilesUploaded = (files) => {
-    setUploadedFiles(prevFiles => [...prevFiles, ...files]);
-    
-    addToTerminal(`Uploaded ${files.length} file(s):`, 'system');
-    files.forEach(file => {
+  const handleFilesUploaded = async (files) => {
+    if (!sessionId) {
+      addToTerminal('No active session. Please refresh the page.', 'error');
+      return;
+    }
+
+    const stored = [];
+    for (const file of files) {
+      try {
+        if (file.type.includes('image/') || file.name.match(/\.(jpg|jpeg|png|gif)$/i)) {
+          const image = await imageService.uploadImage(sessionId, file);
+          file.imageId = image.id;
+        } else {
+          const document = await documentService.uploadDocument(sessionId, file);
+          file.documentId = document.id;
+        }
+        stored.push(file);
+      } catch (error) {
+        addToTerminal(`Error: ${error.message}`, 'error');
+      }
+    }
+
+    if (stored.length === 0) {
+      return;
+    }
+
+    setUploadedFiles(prevFiles => [...prevFiles, ...stored]);
+
+    addToTerminal(`Uploaded ${stored.length} file(s):`, 'system');
+    stored.forEach(file => {
       addToTerminal(` - ${file.name} (${fileService.formatFileSize(file.size)})`, 'system');
     });
   };
@@ -2,6 +2,15 @@ import React, { useRef, useState } from 'react';
 import { FontAwesomeIcon } from '@fortawesome/react-fontawesome';
 import { faUpload, faSpinner } from '@fortawesome/free-solid-svg-icons';
 
+// Documents are converted to text by the server; images are scaled down by it
+const DOCUMENT_EXTENSIONS = [
+  '.txt', '.md', '.pdf', '.docx', '.odt', '.html', '.htm', '.csv', '.tsv',
+  '.json', '.yaml', '.yml', '.go', '.py', '.js', '.ts', '.java', '.c', '.cpp',
+  '.rs', '.rb', '.sh', '.sql'
+];
+const IMAGE_EXTENSIONS = ['.png', '.jpg', '.jpeg', '.gif'];
+const ACCEPTED_EXTENSIONS = [...DOCUMENT_EXTENSIONS, ...IMAGE_EXTENSIONS];
+
 const FileUploader = ({ onFilesUploaded }) => {
   const [isDragging, setIsDragging] = useState(false);
   const [isUploading, setIsUploading] = useState(false);
@@ -37,16 +46,10 @@ const FileUploader = ({ onFilesUploaded }) => {
     try {
       const files = Array.from(fileList);
       const validFiles = files.filter(file => {
-        const fileType = file.type;
+        const name = file.name.toLowerCase();
         return (
-          fileType.includes('image/') || 
-          fileType === 'application/pdf' || 
-          fileType === 'text/plain' ||
-          file.name.endsWith('.txt') ||
-          file.name.endsWith('.pdf') ||
-          file.name.endsWith('.png') ||
-          file.name.endsWith('.jpg') ||
-          file.name.endsWith('.jpeg')
+          file.type.includes('image/') ||
+          ACCEPTED_EXTENSIONS.some(ext => name.endsWith(ext))
         );
       });
 
@@ -73,9 +76,8 @@ const FileUploader = ({ onFilesUploaded }) => {
     >
       <h3>Upload Files</h3>
       <p>Drag & drop files here or click to browse</p>
-      <p>Supported formats: .txt, .pdf</p>
-      <p>Unstable: .png, .jpg</p>
-      <p>Note: working on fixing image support</p>
+      <p>Supported formats: text, Markdown, PDF, DOCX, ODT, HTML, CSV/TSV, source code</p>
+      <p>Images: .png, .jpg, .gif (sent with your next question)</p>
       <button 
         className="upload-button" 
         onClick={handleButtonClick}
@@ -97,7 +99,7 @@ const FileUploader = ({ onFilesUploaded }) => {
         onChange={handleFileInputChange}
         style={{ display: 'none' }}
         multiple
-        accept=".txt,.pdf,.png,.jpg,.jpeg"
+        accept={ACCEPTED_EXTENSIONS.join(',')}
       />
     </div>
   );
@@ -0,0 +1,42 @@
+import axios from 'axios';
+
+const STORAGE_KEY = 'genterm.apiKey';
+
+/**
+ * Auth service for keeping the API key used with every backend request
+ */
+const authService = {
+  /**
+   * Store an API key or token and send it with all further requests
+   * @param {string} key - API key or JWT
+   */
+  setKey: (key) => {
+    localStorage.setItem(STORAGE_KEY, key);
+    axios.defaults.headers.common['Authorization'] = `Bearer ${key}`;
+  },
+
+  /**
+   * Forget the stored API key
+   */
+  clearKey: () => {
+    localStorage.removeItem(STORAGE_KEY);
+    delete axios.defaults.headers.common['Authorization'];
+  },
+
+  /**
+   * Headers for requests made without axios
+   * @returns {object} Authorization header, if a key is stored
+   */
+  headers: () => {
+    const key = localStorage.getItem(STORAGE_KEY);
+    return key ? { Authorization: `Bearer ${key}` } : {};
+  }
+};
+
+// Restore the key from a previous visit
+const storedKey = localStorage.getItem(STORAGE_KEY);
+if (storedKey) {
+  axios.defaults.headers.common['Authorization'] = `Bearer ${storedKey}`;
+}
+
+export default authService;
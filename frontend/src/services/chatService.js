@@ -1,4 +1,5 @@
 import axios from 'axios';
+import authService from './authService';
 
 const API_URL = process.env.REACT_APP_API_URL || '';
 
@@ -10,62 +11,115 @@ const chatService = {
    * Send a query to the LLM with context
    * @param {string} sessionId - Session ID
    * @param {string} query - User query
-   * @param {string} context - Content from files
-   * @returns {Promise<string>} LLM response
+   * @param {string[]} documentIds - IDs of uploaded documents to use as context
+   * @returns {Promise<{response: string, sources: Array}>} LLM response and the document parts it cites
    */
-  sendQuery: async (sessionId, query, context) => {
+  sendQuery: async (sessionId, query, documentIds) => {
     try {
-      const contextArray = context ? [context] : [];
-      // console.log axios url
-      console.log(axios.defaults.baseURL);
       const response = await axios.post(`${API_URL}/api/chat`, {
         sessionId,
         query,
-        context: contextArray
+        documentIds
       });
       
-      return response.data.response;
+      return { response: response.data.response, sources: response.data.sources || [] };
     } catch (error) {
       console.error('Error sending query:', error);
-      throw new Error('Failed to get AI response');
+      throw new Error(error.response?.data?.error || 'Failed to get AI response');
     }
   },
   
   /**
-   * Send a query with an image to the LLM
+   * Send a query to the LLM and receive the response as it is generated
    * @param {string} sessionId - Session ID
    * @param {string} query - User query
-   * @param {string} base64Image - Base64 encoded image data
-   * @param {string} context - Content from files
-   * @returns {Promise<string>} LLM response
+   * @param {string[]} documentIds - IDs of uploaded documents to use as context
+   * @param {string[]} imageIds - IDs of uploaded images to send with the query
+   * @param {function(string): void} onDelta - Called with each chunk of text
+   * @param {function({name: string, arguments: string}): void} [onTool] - Called when the AI runs a server-side tool
+   * @returns {Promise<{response: string, sources: Array}>} Full LLM response and the document parts it cites
    */
-  sendImageQuery: async (sessionId, query, base64Image, context) => {
+  streamQuery: async (sessionId, query, documentIds, imageIds, onDelta, onTool) => {
+    const response = await fetch(`${API_URL}/api/chat`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json', ...authService.headers() },
+      body: JSON.stringify({ sessionId, query, documentIds, imageIds, stream: true })
+    });
+
+    if (!response.ok || !response.body) {
+      console.error('Error streaming query:', response.status);
+      const body = await response.json().catch(() => ({}));
+      throw new Error(body.error || 'Failed to get AI response');
+    }
+
+    const reader = response.body.getReader();
+    const decoder = new TextDecoder();
+    let buffer = '';
+    let fullResponse = '';
+
+    for (;;) {
+      const { done, value } = await reader.read();
+      if (done) break;
+      buffer += decoder.decode(value, { stream: true });
+
+      let boundary;
+      while ((boundary = buffer.indexOf('\n\n')) !== -1) {
+        const { event, data } = parseEvent(buffer.slice(0, boundary));
+        buffer = buffer.slice(boundary + 2);
+        if (!data) continue;
+
+        const payload = JSON.parse(data);
+        if (event === 'error') {
+          throw new Error(payload.error || 'Failed to get AI response');
+        }
+        if (event === 'done') {
+          return { response: payload.response, sources: payload.sources || [] };
+        }
+        if (event === 'tool') {
+          if (onTool) onTool(payload);
+          continue;
+        }
+
+        fullResponse += payload.delta;
+        onDelta(payload.delta);
+      }
+    }
+
+    return { response: fullResponse, sources: [] };
+  },
+
+  /**
+   * Cancel the query currently running for a session
+   * @param {string} sessionId - Session ID
+   * @returns {Promise<boolean>} Whether a running query was cancelled
+   */
+  cancelQuery: async (sessionId) => {
     try {
-      const contextArray = context ? [context] : [];
-      
-      const messageContent = [
-        { type: "text", text: query },
-        {
-          type: "image_url",
-          image_url: {
-            url: `data:image/jpeg;base64,${base64Image}`
-          }
-        },
-      ];
-      
-      const response = await axios.post(`${API_URL}/api/chat`, {
-        sessionId,
-        query,
-        context: contextArray,
-        messageContent
-      });
-      
-      return response.data.response;
+      await axios.post(`${API_URL}/api/chat/cancel`, { sessionId });
+      return true;
     } catch (error) {
-      console.error('Error sending image query:', error);
-      throw new Error('Failed to get AI response for image');
+      console.error('Error cancelling query:', error);
+      return false;
     }
   }
 };
 
+/**
+ * Parse a single Server-Sent Event block
+ * @param {string} block - Raw event text
+ * @returns {{event: string, data: string}} Event name and data
+ */
+const parseEvent = (block) => {
+  let event = 'message';
+  const data = [];
+  block.split('\n').forEach(line => {
+    if (line.startsWith('event:')) {
+      event = line.slice(6).trim();
+    } else if (line.startsWith('data:')) {
+      data.push(line.slice(5).trim());
+    }
+  });
+  return { event, data: data.join('\n') };
+};
+
 export default chatService; 
\ No newline at end of file
@@ -0,0 +1,67 @@
+import axios from 'axios';
+
+const API_URL = process.env.REACT_APP_API_URL || '';
+
+/**
+ * Document service for storing files on the server
+ */
+const documentService = {
+  /**
+   * Upload a document to a session; the server extracts its text
+   * @param {string} sessionId - Session ID
+   * @param {File} file - File object
+   * @returns {Promise<object>} Stored document
+   */
+  uploadDocument: async (sessionId, file) => {
+    try {
+      const formData = new FormData();
+      formData.append('sessionId', sessionId);
+      formData.append('file', file);
+
+      const response = await axios.post(`${API_URL}/api/documents`, formData);
+
+      return response.data.document;
+    } catch (error) {
+      console.error('Error uploading document:', error);
+      const message = error.response?.data?.error || `Failed to upload ${file.name}`;
+      throw new Error(message);
+    }
+  },
+
+  /**
+   * List the documents of a session
+   * @param {string} sessionId - Session ID
+   * @returns {Promise<Array>} Stored documents
+   */
+  listDocuments: async (sessionId) => {
+    try {
+      const response = await axios.get(`${API_URL}/api/documents`, {
+        params: { sessionId }
+      });
+
+      return response.data.documents;
+    } catch (error) {
+      console.error('Error listing documents:', error);
+      throw new Error('Failed to list documents');
+    }
+  },
+
+  /**
+   * Delete a document from a session
+   * @param {string} sessionId - Session ID
+   * @param {string} documentId - Document ID
+   * @returns {Promise<void>}
+   */
+  deleteDocument: async (sessionId, documentId) => {
+    try {
+      await axios.delete(`${API_URL}/api/documents`, {
+        params: { sessionId, id: documentId }
+      });
+    } catch (error) {
+      console.error('Error deleting document:', error);
+      throw new Error('Failed to delete document');
+    }
+  }
+};
+
+export default documentService;
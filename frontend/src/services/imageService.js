@@ -0,0 +1,32 @@
+import axios from 'axios';
+
+const API_URL = process.env.REACT_APP_API_URL || '';
+
+/**
+ * Image service for storing images on the server
+ */
+const imageService = {
+  /**
+   * Upload an image to a session; the server scales down large images
+   * @param {string} sessionId - Session ID
+   * @param {File} file - Image file
+   * @returns {Promise<object>} Stored image
+   */
+  uploadImage: async (sessionId, file) => {
+    try {
+      const formData = new FormData();
+      formData.append('sessionId', sessionId);
+      formData.append('file', file);
+
+      const response = await axios.post(`${API_URL}/api/images`, formData);
+
+      return response.data.image;
+    } catch (error) {
+      console.error('Error uploading image:', error);
+      const message = error.response?.data?.error || `Failed to upload ${file.name}`;
+      throw new Error(message);
+    }
+  }
+};
+
+export default imageService;
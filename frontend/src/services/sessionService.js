@@ -8,18 +8,37 @@ const API_URL = process.env.REACT_APP_API_URL || '';
 const sessionService = {
   /**
    * Create a new chat session
+   * @param {string} [persona] - Persona whose system prompt the session uses
    * @returns {Promise<string>} Session ID
    */
-  createSession: async () => {
+  createSession: async (persona) => {
     try {
       const response = await axios.post(`${API_URL}/api/session`, {
-        action: 'create'
+        action: 'create',
+        persona
       });
       
       return response.data.id;
     } catch (error) {
       console.error('Error creating session:', error);
-      throw new Error('Failed to create session');
+      throw new Error(error.response?.data?.error || 'Failed to create session');
+    }
+  },
+
+  /**
+   * List the personas available for new sessions
+   * @returns {Promise<string[]>} Persona names
+   */
+  listPersonas: async () => {
+    try {
+      const response = await axios.post(`${API_URL}/api/session`, {
+        action: 'personas'
+      });
+
+      return response.data.personas || [];
+    } catch (error) {
+      console.error('Error listing personas:', error);
+      throw new Error('Failed to list personas');
     }
   },
 
@@ -40,6 +59,60 @@ const sessionService = {
       console.error('Error getting session:', error);
       throw new Error('Failed to get session');
     }
+  },
+
+  /**
+   * Update the generation parameters of a session
+   * @param {string} sessionId - Session ID
+   * @param {object|null} params - Parameters to change, or null to reset all
+   * @returns {Promise<object>} The session's parameters after the update
+   */
+  setParams: async (sessionId, params) => {
+    try {
+      const response = await axios.post(`${API_URL}/api/session`, {
+        action: 'set',
+        id: sessionId,
+        params
+      });
+
+      return response.data.params || {};
+    } catch (error) {
+      console.error('Error setting parameters:', error);
+      throw new Error(error.response?.data?.error || 'Failed to set parameters');
+    }
+  },
+
+  /**
+   * List the models available for sessions
+   * @returns {Promise<object>} Default model name and model catalog
+   */
+  listModels: async () => {
+    try {
+      const response = await axios.get(`${API_URL}/api/models`);
+
+      return response.data;
+    } catch (error) {
+      console.error('Error listing models:', error);
+      throw new Error('Failed to list models');
+    }
+  },
+
+  /**
+   * Get token usage and cost of a session
+   * @param {string} sessionId - Session ID
+   * @returns {Promise<object>} Usage totals
+   */
+  getUsage: async (sessionId) => {
+    try {
+      const response = await axios.get(`${API_URL}/api/usage`, {
+        params: { sessionId }
+      });
+
+      return response.data.usage;
+    } catch (error) {
+      console.error('Error getting usage:', error);
+      throw new Error('Failed to get usage');
+    }
   }
 };
 